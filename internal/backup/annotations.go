@@ -0,0 +1,59 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+)
+
+// The annotations recording the details of a backup on the Backup object
+const (
+	// snapshotIDsAnnotationName contains the IDs of the Kopia snapshots,
+	// as a comma-separated list of name=ID pairs
+	snapshotIDsAnnotationName = "pvc-backup.cloudnative-pg.io/snapshot-ids"
+
+	// sizeAnnotationName contains the size of the files backed up, in bytes
+	sizeAnnotationName = "pvc-backup.cloudnative-pg.io/size-bytes"
+
+	// durationAnnotationName contains the duration of the backup
+	durationAnnotationName = "pvc-backup.cloudnative-pg.io/duration"
+)
+
+// annotateBackup records the details of a backup on the Backup object.
+// The backup has already been completed, so a failure is only logged
+func (impl Implementation) annotateBackup(
+	ctx context.Context,
+	backupObject *apiv1.Backup,
+	snapshots []catalog.Snapshot,
+	duration time.Duration,
+	sizeBytes int64,
+) {
+	if impl.Client == nil {
+		return
+	}
+
+	snapshotIDs := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		snapshotIDs = append(snapshotIDs, fmt.Sprintf("%s=%s", snapshot.Name, snapshot.ID))
+	}
+
+	origin := backupObject.DeepCopy()
+	if backupObject.Annotations == nil {
+		backupObject.Annotations = make(map[string]string)
+	}
+	backupObject.Annotations[snapshotIDsAnnotationName] = strings.Join(snapshotIDs, ",")
+	backupObject.Annotations[sizeAnnotationName] = strconv.FormatInt(sizeBytes, 10)
+	backupObject.Annotations[durationAnnotationName] = duration.Round(time.Second).String()
+
+	if err := impl.Client.Patch(ctx, backupObject, client.MergeFrom(origin)); err != nil {
+		logging.FromContext(ctx).Error(err, "Error while recording the backup details on the Backup object")
+	}
+}
@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/cnpgtest"
+)
+
+// newAnnotatedTestBackup creates a Backup with an annotation
+// that is not set by the plugin, which must be kept
+func newAnnotatedTestBackup() *apiv1.Backup {
+	backup := cnpgtest.NewBackup()
+	backup.Annotations = map[string]string{"team": "dba"}
+	return backup
+}
+
+func TestAnnotateBackup(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := apiv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	kubernetesClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(newAnnotatedTestBackup()).Build()
+
+	backupObject := &apiv1.Backup{}
+	key := client.ObjectKey{Namespace: cnpgtest.Namespace, Name: cnpgtest.BackupName}
+	if err := kubernetesClient.Get(context.Background(), key, backupObject); err != nil {
+		t.Fatal(err)
+	}
+
+	impl := Implementation{Client: kubernetesClient}
+	impl.annotateBackup(
+		context.Background(),
+		backupObject,
+		[]catalog.Snapshot{
+			{Name: "pgdata", ID: "k1a2b3"},
+			{Name: "tablespace-tbs1", ID: "k4d5e6"},
+		},
+		90*time.Second+400*time.Millisecond,
+		1024,
+	)
+
+	var updated apiv1.Backup
+	if err := kubernetesClient.Get(context.Background(), key, &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"team":                    "dba",
+		snapshotIDsAnnotationName: "pgdata=k1a2b3,tablespace-tbs1=k4d5e6",
+		sizeAnnotationName:        "1024",
+		durationAnnotationName:    "1m30s",
+	}
+	for name, value := range expected {
+		if updated.Annotations[name] != value {
+			t.Errorf("expected annotation %s to be %q, got %q", name, value, updated.Annotations[name])
+		}
+	}
+}
+
+func TestAnnotateBackupWithoutClient(t *testing.T) {
+	backupObject := newAnnotatedTestBackup()
+
+	Implementation{}.annotateBackup(context.Background(), backupObject, nil, time.Minute, 1024)
+	if len(backupObject.Annotations) != 1 {
+		t.Errorf("expected the Backup object not to be changed, got %v", backupObject.Annotations)
+	}
+}
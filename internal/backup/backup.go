@@ -2,20 +2,47 @@ package backup
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"time"
 
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/pluginhelper"
 	"github.com/cloudnative-pg/cnpg-i/pkg/backup"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
 	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/migration"
 	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/events"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/lock"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/metrics"
 	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
 )
 
+// backupLockStaleTimeout is the time after which the lock of a
+// backup whose instance died is taken over. The lock is refreshed
+// while the backup is running, so this doesn't limit the backup duration
+const backupLockStaleTimeout = 5 * time.Minute
+
+// ErrBackupInProgress is returned when a backup is requested
+// while another one of the same cluster is still running
+var ErrBackupInProgress = errors.New("backup already in progress")
+
 // Implementation is the implementation of the identity service
 type Implementation struct {
 	backup.BackupServer
+
+	// Client is used to record the details of the backups on the
+	// Backup objects. When nil, the details are only logged
+	Client client.Client
+
+	// Events emits the Events reporting the backups
+	Events *events.Recorder
 }
 
 // GetCapabilities gets the capabilities of the Backup service
@@ -37,7 +64,7 @@ func (Implementation) GetCapabilities(
 }
 
 // Backup take a physical backup using Kopia
-func (Implementation) Backup(
+func (impl Implementation) Backup(
 	ctx context.Context,
 	request *backup.BackupRequest,
 ) (*backup.BackupResult, error) {
@@ -55,13 +82,73 @@ func (Implementation) Backup(
 		return nil, err
 	}
 
+	result, err := impl.takeBackup(ctx, helper, backupObject)
+	if err != nil {
+		metrics.ObserveBackupFailure(helper.GetCluster().Name)
+		impl.Events.BackupFailed(helper.GetCluster(), backupObject, err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// takeBackup takes a backup of the cluster, unless
+// another one of the same cluster is running
+func (impl Implementation) takeBackup(
+	ctx context.Context,
+	helper *pluginhelper.Data,
+	backupObject *apiv1.Backup,
+) (*backup.BackupResult, error) {
+	contextLogger := logging.FromContext(ctx)
+
 	cluster := helper.GetCluster()
-	rep, err := executor.NewRepository(
-		ctx,
-		storage.GetBasePath(cluster.Name),
-		storage.GetKopiaConfigFilePath(cluster.Name),
-		storage.GetKopiaCacheDirectory(cluster.Name),
-	)
+	backupLock, err := AcquireBackupLock(ctx, cluster.Name, "backup "+backupObject.Name)
+	if err != nil {
+		contextLogger.Error(err, "Cannot start backup")
+		return nil, err
+	}
+	defer func() {
+		if err := backupLock.Release(); err != nil {
+			contextLogger.Error(err, "Error while releasing backup lock")
+		}
+	}()
+
+	metrics.SetBackupInProgress(cluster.Name, true)
+	defer metrics.SetBackupInProgress(cluster.Name, false)
+	impl.Events.BackupStarted(cluster, backupObject)
+
+	configuration, err := config.FromParameters(helper.Parameters)
+	if err != nil {
+		contextLogger.Error(err, "Error while parsing the plugin parameters")
+		return nil, err
+	}
+
+	backend, err := storage.NewBackend(configuration.Storage)
+	if err != nil {
+		contextLogger.Error(err, "Error while creating the storage backend")
+		return nil, err
+	}
+
+	location, err := executor.GetRepositoryLocation(cluster.Name, configuration.Storage)
+	if err != nil {
+		contextLogger.Error(err, "Error while detecting the repository location")
+		return nil, err
+	}
+
+	passwords, err := executor.GetRepositoryPasswords(configuration.SecretKey, configuration.NewSecretKey)
+	if err != nil {
+		contextLogger.Error(err, "Error while reading the repository passwords")
+		return nil, err
+	}
+
+	rep, err := executor.NewRepository(ctx, executor.RepositoryOptions{
+		Location:       location,
+		ConfigFile:     storage.GetKopiaConfigFilePath(cluster.Name),
+		CacheDirectory: storage.GetKopiaCacheDirectory(cluster.Name),
+		Passwords:      passwords,
+		Format:         configuration.Format,
+		Throttling:     &configuration.Throttling,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -70,19 +157,127 @@ func (Implementation) Backup(
 		cluster,
 		backupObject,
 		rep,
+		configuration.BackupConcurrency,
+		configuration.Hooks,
 	)
 
+	// While migrating from the previous PVC, the first backup taken
+	// once the WAL files have been copied completes the migration
+	var pvcMigration *migration.Migration
+	if configuration.Storage.Type == storage.BackendTypePVC && len(configuration.PreviousPVCName) > 0 {
+		pvcMigration, err = prepareMigration(ctx, cluster.Name, configuration.PreviousPVCName, backend)
+		if err != nil {
+			contextLogger.Error(err, "Error while migrating the backups from the previous PVC")
+			return nil, err
+		}
+	}
+
+	// The free space can only be checked when the
+	// backups are stored in the backup volume
+	var spaceGuard *executor.SpaceGuard
+	if configuration.Storage.Type == storage.BackendTypePVC {
+		spaceGuard = executor.NewSpaceGuard(cluster.Name, configuration.SpaceThresholds)
+		if err := exec.CheckSpace(ctx, spaceGuard); err != nil {
+			contextLogger.Error(err, "Cannot start backup")
+			return nil, err
+		}
+	}
+
+	backupCatalog := catalog.New(backend, cluster.Name)
 	startedAt := time.Now()
 	backupInfo, err := exec.TakeBackup(ctx)
 	if err != nil {
+		// The failed backup is recorded to keep the
+		// outcome of the hooks that were run
+		if catalogErr := backupCatalog.Put(ctx, &catalog.Entry{
+			BackupName:  backupObject.Name,
+			ClusterName: cluster.Name,
+			StartedAt:   startedAt,
+			StoppedAt:   time.Now(),
+			Hooks:       exec.GetHookResults(),
+			Error:       err.Error(),
+		}); catalogErr != nil {
+			contextLogger.Error(catalogErr, "Error while recording the failed backup in the catalog")
+		}
 		return nil, err
 	}
 
+	stoppedAt := time.Now()
+	metrics.ObserveBackup(cluster.Name, stoppedAt.Sub(startedAt), exec.GetSize())
+
+	if spaceGuard != nil {
+		if err := spaceGuard.RecordBackup(ctx); err != nil {
+			contextLogger.Error(err, "Error while recording the space used by the backup")
+		}
+	}
+
+	// The snapshots have been taken and the backup can be restored
+	// using the information stored in the Backup object, so a catalog
+	// error doesn't make the backup fail
+	if err := backupCatalog.Put(ctx, &catalog.Entry{
+		BackupName:        backupObject.Name,
+		ClusterName:       cluster.Name,
+		StartedAt:         startedAt,
+		StoppedAt:         stoppedAt,
+		BeginWal:          exec.GetBeginWal(),
+		EndWal:            exec.GetEndWal(),
+		BeginLSN:          string(backupInfo.BeginLSN),
+		EndLSN:            string(backupInfo.EndLSN),
+		BackupLabelFile:   backupInfo.LabelFile,
+		TablespaceMapFile: backupInfo.SpcmapFile,
+		Snapshots:         exec.GetSnapshots(),
+		Hooks:             exec.GetHookResults(),
+	}); err != nil {
+		contextLogger.Error(err, "Error while recording the backup in the catalog")
+	}
+
+	if pvcMigration != nil {
+		snapshots := exec.GetSnapshots()
+		err := pvcMigration.Complete(ctx, backupObject.Name, func(ctx context.Context) error {
+			snapshotIDs := make([]string, 0, len(snapshots))
+			for _, snapshot := range snapshots {
+				snapshotIDs = append(snapshotIDs, snapshot.ID)
+			}
+			return rep.VerifySnapshots(ctx, snapshotIDs...)
+		})
+		switch {
+		case errors.Is(err, lock.ErrLocked):
+			contextLogger.Info(
+				"Not completing the migration from the previous PVC, another instance is migrating it",
+				"reason", err.Error())
+		case err != nil:
+			// Like the catalog, the migration doesn't make the
+			// backup fail, and is retried by the next backups
+			contextLogger.Error(err, "Error while completing the migration from the previous PVC")
+			impl.Events.MigrationFailed(cluster, configuration.PreviousPVCName, err)
+		default:
+			impl.Events.MigrationCompleted(cluster, configuration.PreviousPVCName, backupObject.Name)
+		}
+	}
+
+	impl.Events.BackupCompleted(cluster, backupObject, stoppedAt.Sub(startedAt), exec.GetSize())
+	impl.annotateBackup(ctx, backupObject, exec.GetSnapshots(), stoppedAt.Sub(startedAt), exec.GetSize())
+
+	// The maintenance may take a long time, and there's no need
+	// to delay the completion of the backup while it runs
+	maintenance := executor.NewMaintenance(
+		rep,
+		configuration.Maintenance,
+		storage.GetMaintenanceStatusFilePath(cluster.Name),
+		storage.GetMaintenanceLockFilePath(cluster.Name),
+	)
+	go func(ctx context.Context) {
+		if err := maintenance.RunIfDue(ctx); err != nil {
+			logging.FromContext(ctx).Error(err, "Error while running the scheduled maintenance")
+		}
+		publishRepositorySize(ctx, backend, cluster.Name)
+	}(context.WithoutCancel(ctx))
+
 	return &backup.BackupResult{
 		BackupId:          backupInfo.BackupName,
 		BackupName:        backupInfo.BackupName,
 		StartedAt:         startedAt.Unix(),
-		StoppedAt:         time.Now().Unix(),
+		StoppedAt:         stoppedAt.Unix(),
 		BeginWal:          exec.GetBeginWal(),
 		EndWal:            exec.GetEndWal(),
 		BeginLsn:          string(backupInfo.BeginLSN),
@@ -92,3 +287,84 @@ func (Implementation) Backup(
 		Online:            true,
 	}, nil
 }
+
+// publishRepositorySize publishes the space used by the Kopia repository
+// of the cluster, that changes after backups and maintenance runs
+func publishRepositorySize(ctx context.Context, backend storage.Backend, clusterName string) {
+	objects, err := backend.List(ctx, storage.GetBasePrefixKey(clusterName))
+	if err != nil {
+		logging.FromContext(ctx).Error(err, "Error while measuring the size of the repository")
+		return
+	}
+
+	var sizeBytes int64
+	for _, object := range objects {
+		sizeBytes += object.Size
+	}
+	metrics.SetRepositorySize(clusterName, sizeBytes)
+}
+
+// prepareMigration returns the migration from the previous PVC when
+// the WAL files have been copied, so that the backup being taken can
+// complete it. Otherwise, the WAL files are copied in the background,
+// without holding the backup lock, and nil is returned. Nil is also
+// returned when the migration has already been completed, or the previous
+// PVC is not mounted yet because the Pod predates the migration
+func prepareMigration(
+	ctx context.Context,
+	clusterName string,
+	previousPVCName string,
+	backend storage.Backend,
+) (*migration.Migration, error) {
+	previous, err := storage.NewPreviousBackend()
+	if errors.Is(err, storage.ErrNotFound) {
+		logging.FromContext(ctx).Info(
+			"The previous PVC is not mounted, the migration will start once the Pod is recreated",
+			"previousPVCName", previousPVCName)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := migration.New(clusterName, previousPVCName, previous, backend)
+	completed, err := migration.IsCompleted(clusterName, previousPVCName)
+	if err != nil || completed {
+		return nil, err
+	}
+
+	canComplete, err := result.CanComplete()
+	if err != nil {
+		return nil, err
+	}
+	if canComplete {
+		return result, nil
+	}
+
+	go func(ctx context.Context) {
+		if err := result.CopyWALs(ctx); err != nil {
+			logging.FromContext(ctx).Error(err, "Error while copying the WAL files from the previous PVC")
+		}
+	}(context.WithoutCancel(ctx))
+
+	return nil, nil
+}
+
+// AcquireBackupLock prevents other backups of the same cluster from
+// running concurrently, even from other instances. It's also acquired
+// by the operations changing the archive, described by operation,
+// which must not run while a backup is being taken
+func AcquireBackupLock(ctx context.Context, clusterName string, operation string) (*lock.Lock, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	owner := fmt.Sprintf("%s on %s", operation, hostname)
+	result, err := lock.Acquire(ctx, storage.GetBackupLockFilePath(clusterName), owner, backupLockStaleTimeout)
+	if errors.Is(err, lock.ErrLocked) {
+		return nil, fmt.Errorf("%w: %s", ErrBackupInProgress, err.Error())
+	}
+
+	return result, err
+}
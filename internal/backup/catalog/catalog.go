@@ -0,0 +1,198 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+// Snapshot is a Kopia snapshot taken by a backup
+type Snapshot struct {
+	// Name is "PGDATA" for the data directory, or the
+	// OID of the tablespace
+	Name string `json:"name"`
+
+	// Path is the directory that was snapshotted
+	Path string `json:"path"`
+
+	// ID is the ID of the Kopia snapshot
+	ID string `json:"id"`
+}
+
+// HookResult is the outcome of a hook run around a backup
+type HookResult struct {
+	// Name is the name of the hook
+	Name string `json:"name"`
+
+	// Phase is either "pre" or "post"
+	Phase string `json:"phase"`
+
+	// StartedAt is the time when the hook was started
+	StartedAt time.Time `json:"startedAt"`
+
+	// StoppedAt is the time when the hook was completed
+	StoppedAt time.Time `json:"stoppedAt"`
+
+	// Output is the beginning of the output of the hook
+	Output string `json:"output,omitempty"`
+
+	// Error is the error that made the hook fail, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Entry is a backup recorded in the catalog
+type Entry struct {
+	// BackupName is the name of the Backup object
+	BackupName string `json:"backupName"`
+
+	// ClusterName is the name of the backed up cluster
+	ClusterName string `json:"clusterName"`
+
+	// StartedAt is the time when the backup was started
+	StartedAt time.Time `json:"startedAt"`
+
+	// StoppedAt is the time when the backup was completed
+	StoppedAt time.Time `json:"stoppedAt"`
+
+	// BeginWal is the first WAL file needed to restore the backup
+	BeginWal string `json:"beginWal"`
+
+	// EndWal is the last WAL file needed to restore the backup
+	EndWal string `json:"endWal"`
+
+	// BeginLSN is the LSN where the backup was started
+	BeginLSN string `json:"beginLSN"`
+
+	// EndLSN is the LSN where the backup was completed
+	EndLSN string `json:"endLSN"`
+
+	// BackupLabelFile is the content of the backup_label file
+	BackupLabelFile []byte `json:"backupLabelFile,omitempty"`
+
+	// TablespaceMapFile is the content of the tablespace_map file
+	TablespaceMapFile []byte `json:"tablespaceMapFile,omitempty"`
+
+	// Snapshots are the snapshots of the data directory
+	// and of the tablespaces
+	Snapshots []Snapshot `json:"snapshots"`
+
+	// Hooks are the outcome of the hooks run around the backup
+	Hooks []HookResult `json:"hooks,omitempty"`
+
+	// Error is the error that made the backup fail, if any. A failed
+	// backup is recorded to keep the outcome of its hooks, and can't
+	// be restored
+	Error string `json:"error,omitempty"`
+}
+
+// Failed checks if the backup failed
+func (entry *Entry) Failed() bool {
+	return len(entry.Error) > 0
+}
+
+// Catalog is the list of the backups of a cluster, stored
+// alongside the backups themselves
+type Catalog struct {
+	backend     storage.Backend
+	clusterName string
+}
+
+// New creates a new Catalog for the backups of a cluster
+func New(backend storage.Backend, clusterName string) *Catalog {
+	return &Catalog{
+		backend:     backend,
+		clusterName: clusterName,
+	}
+}
+
+// Put adds a backup to the catalog, replacing any
+// existing entry with the same name
+func (catalog *Catalog) Put(ctx context.Context, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return catalog.backend.Put(
+		ctx,
+		storage.GetCatalogKey(catalog.clusterName, entry.BackupName),
+		bytes.NewReader(data),
+		int64(len(data)),
+	)
+}
+
+// Get gets a backup from the catalog. Returns storage.ErrNotFound
+// when the backup is not in the catalog
+func (catalog *Catalog) Get(ctx context.Context, backupName string) (*Entry, error) {
+	return catalog.get(ctx, storage.GetCatalogKey(catalog.clusterName, backupName))
+}
+
+func (catalog *Catalog) get(ctx context.Context, key string) (*Entry, error) {
+	content, err := catalog.backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	var result Entry
+	if err := json.NewDecoder(content).Decode(&result); err != nil {
+		return nil, fmt.Errorf("while decoding catalog entry %s: %w", key, err)
+	}
+
+	return &result, nil
+}
+
+// List gets every backup in the catalog, including the
+// failed ones, from the oldest to the newest
+func (catalog *Catalog) List(ctx context.Context) ([]Entry, error) {
+	objects, err := catalog.backend.List(ctx, storage.GetCatalogPrefixKey(catalog.clusterName))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Entry, 0, len(objects))
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+
+		entry, err := catalog.get(ctx, object.Key)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *entry)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+
+	return result, nil
+}
+
+// ListCompleted gets the backups in the catalog that can be
+// restored, from the oldest to the newest
+func (catalog *Catalog) ListCompleted(ctx context.Context) ([]Entry, error) {
+	entries, err := catalog.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(entries, func(entry Entry) bool {
+		return entry.Failed()
+	}), nil
+}
+
+// Delete removes a backup from the catalog
+func (catalog *Catalog) Delete(ctx context.Context, backupName string) error {
+	return catalog.backend.Delete(ctx, storage.GetCatalogKey(catalog.clusterName, backupName))
+}
@@ -0,0 +1,3 @@
+// Package catalog keeps the list of the backups taken by the plugin,
+// together with the information needed to restore them
+package catalog
@@ -7,30 +7,57 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/cloudnative-pg/cloudnative-pg/pkg/management/url"
 	"github.com/cloudnative-pg/cloudnative-pg/pkg/utils"
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing"
 )
 
+// instanceStatusConnectionTimeout is the maximum time
+// waited to connect to the instance HTTP endpoint
+const instanceStatusConnectionTimeout = 2 * time.Second
+
+// CheckInstanceStatusEndpoint checks that the instance HTTP endpoint,
+// used to get the pg_controldata, accepts connections
+func CheckInstanceStatusEndpoint(ctx context.Context) error {
+	return checkEndpoint(ctx, net.JoinHostPort(podIP, strconv.Itoa(url.StatusPort)))
+}
+
+func checkEndpoint(ctx context.Context, address string) error {
+	dialer := &net.Dialer{Timeout: instanceStatusConnectionTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("instance status endpoint not reachable: %w", err)
+	}
+
+	return conn.Close()
+}
+
 // getPgControlData obtains the pg_controldata from the instance HTTP endpoint
 func getPgControlData(
 	ctx context.Context,
-) (map[string]string, error) {
+) (controlData map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "getPgControlData")
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	contextLogger := logging.FromContext(ctx)
 
-	const (
-		connectionTimeout = 2 * time.Second
-		requestTimeout    = 30 * time.Second
-	)
+	const requestTimeout = 30 * time.Second
 
 	// We want a connection timeout to prevent waiting for the default
 	// TCP connection timeout (30 seconds) on lost SYN packets
 	timeoutClient := &http.Client{
 		Transport: &http.Transport{
 			DialContext: (&net.Dialer{
-				Timeout: connectionTimeout,
+				Timeout: instanceStatusConnectionTimeout,
 			}).DialContext,
 		},
 		Timeout: requestTimeout,
@@ -41,6 +68,7 @@ func getPgControlData(
 	if err != nil {
 		return nil, err
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := timeoutClient.Do(req)
 	if err != nil {
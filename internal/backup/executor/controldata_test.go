@@ -0,0 +1,24 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestCheckEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	if err := checkEndpoint(context.Background(), address); err != nil {
+		t.Errorf("expected the endpoint to be reachable, got %v", err)
+	}
+
+	_ = listener.Close()
+	if err := checkEndpoint(context.Background(), address); err == nil {
+		t.Errorf("expected an error once the endpoint is closed")
+	}
+}
@@ -2,17 +2,24 @@ package executor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path"
+	"sync"
 	"time"
 
 	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
 	"github.com/cloudnative-pg/cloudnative-pg/pkg/management/postgres/webserver"
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/retry"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing"
 )
 
 var (
@@ -20,6 +27,11 @@ var (
 	errBackupNotStopped = fmt.Errorf("backup not stopped")
 )
 
+// dataDirectoryProgressName is the name used to report the progress
+// of the snapshot of the data directory, while tablespaces are
+// reported using their OID
+const dataDirectoryProgressName = "PGDATA"
+
 var backupModeBackoff = wait.Backoff{
 	Steps:    10,
 	Duration: 1 * time.Second,
@@ -39,6 +51,16 @@ type Executor struct {
 	repository           *Repository
 	backupClientEndpoint string
 
+	// concurrency is the number of snapshots taken at the same time
+	concurrency int
+
+	// hooks are run before and after the backup
+	hooks       BackupHooks
+	hookResults []catalog.HookResult
+
+	// snapshots are the snapshots taken by the backup
+	snapshots []*snapshotJob
+
 	executed bool
 }
 
@@ -68,40 +90,126 @@ type tablespace struct {
 }
 
 // newExecutor creates a new backup Executor
-func newExecutor(cluster *apiv1.Cluster, backup *apiv1.Backup, repo *Repository, endpoint string) *Executor {
+func newExecutor(
+	cluster *apiv1.Cluster,
+	backup *apiv1.Backup,
+	repo *Repository,
+	endpoint string,
+	concurrency int,
+	hooks BackupHooks,
+) *Executor {
 	return &Executor{
 		backupClient:         webserver.NewBackupClient(),
 		cluster:              cluster,
 		backup:               backup,
 		repository:           repo,
 		backupClientEndpoint: endpoint,
+		concurrency:          concurrency,
+		hooks:                hooks,
 	}
 }
 
-// NewLocalExecutor creates a new backup Executor
-func NewLocalExecutor(cluster *apiv1.Cluster, backup *apiv1.Backup, repo *Repository) *Executor {
-	return newExecutor(cluster, backup, repo, podIP)
+// NewLocalExecutor creates a new backup Executor, taking at most
+// concurrency snapshots at the same time and running the passed hooks
+func NewLocalExecutor(
+	cluster *apiv1.Cluster,
+	backup *apiv1.Backup,
+	repo *Repository,
+	concurrency int,
+	hooks BackupHooks,
+) *Executor {
+	return newExecutor(cluster, backup, repo, podIP, concurrency, hooks)
+}
+
+// GetSize gets the size of the files backed up by the
+// snapshots, panics if the executor was not executed
+func (executor *Executor) GetSize() int64 {
+	if !executor.executed {
+		panic("size: please run take backup before trying to access this value")
+	}
+
+	var result int64
+	for _, job := range executor.snapshots {
+		result += job.sizeBytes
+	}
+	return result
+}
+
+// GetHookResults gets the outcome of the hooks that were run
+func (executor *Executor) GetHookResults() []catalog.HookResult {
+	return executor.hookResults
+}
+
+// GetSnapshots gets the snapshots taken by the backup, panics
+// if the executor was not executed
+func (executor *Executor) GetSnapshots() []catalog.Snapshot {
+	if !executor.executed {
+		panic("snapshots: please run take backup before trying to access this value")
+	}
+
+	result := make([]catalog.Snapshot, 0, len(executor.snapshots))
+	for _, job := range executor.snapshots {
+		result = append(result, catalog.Snapshot{
+			Name: job.name,
+			Path: job.path,
+			ID:   job.snapshotID,
+		})
+	}
+	return result
 }
 
 // TakeBackup executes a backup. Returns the result and any error encountered
-func (executor *Executor) TakeBackup(ctx context.Context) (*webserver.BackupResultData, error) {
+func (executor *Executor) TakeBackup(ctx context.Context) (result *webserver.BackupResultData, err error) {
+	ctx, span := tracing.Start(ctx, "backup",
+		attribute.String("backup.name", executor.backup.Name),
+		attribute.String("cluster.name", executor.cluster.Name))
 	defer func() {
 		executor.executed = true
+		tracing.End(span, err)
 	}()
 
 	contextLogger := logging.FromContext(ctx)
+	if err := executor.runPhase(ctx, "pre-backup hooks", func(ctx context.Context) error {
+		return executor.runHooks(ctx, hookPhasePre, executor.hooks.Pre)
+	}); err != nil {
+		return nil, err
+	}
+
 	contextLogger.Info("Preparing physical backup")
-	if err := executor.setBackupMode(ctx); err != nil {
+	if err := executor.runPhase(ctx, "start backup mode", executor.setBackupMode); err != nil {
 		return nil, err
 	}
 
 	contextLogger.Info("Copying files")
-	if err := executor.execSnapshot(ctx); err != nil {
+	if err := executor.runPhase(ctx, "snapshots", executor.execSnapshot); err != nil {
 		return nil, err
 	}
 
 	contextLogger.Info("Finishing backup")
-	return executor.unsetBackupMode(ctx)
+	if err := executor.runPhase(ctx, "stop backup mode", func(ctx context.Context) error {
+		var err error
+		result, err = executor.unsetBackupMode(ctx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := executor.runPhase(ctx, "post-backup hooks", func(ctx context.Context) error {
+		return executor.runHooks(ctx, hookPhasePost, executor.hooks.Post)
+	}); err != nil {
+		executor.removeSnapshots(ctx, executor.snapshots)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// runPhase runs a phase of the backup inside its own span
+func (executor *Executor) runPhase(ctx context.Context, name string, phase func(context.Context) error) error {
+	ctx, span := tracing.Start(ctx, name)
+	err := phase(ctx)
+	tracing.End(span, err)
+	return err
 }
 
 // setBackupMode starts a backup by setting PostgreSQL in backup mode
@@ -124,9 +232,15 @@ func (executor *Executor) setBackupMode(ctx context.Context) error {
 		return err
 	}
 
+	// The immediate checkpoint is requested by the start of the
+	// backup, and the backup is started once it's completed
 	logger.Info("Requesting PostgreSQL Backup mode")
-	if err := retry.OnError(backupModeBackoff, retryOnBackupNotStarted, func() error {
-		response, err := executor.backupClient.StatusWithErrors(ctx, executor.backupClientEndpoint)
+	waitCtx, waitSpan := tracing.Start(ctx, "wait for checkpoint")
+	attempt := 0
+	err := retry.OnError(backupModeBackoff, retryOnBackupNotStarted, func() error {
+		attempt++
+		waitSpan.AddEvent("status request", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		response, err := executor.backupClient.StatusWithErrors(waitCtx, executor.backupClientEndpoint)
 		if err != nil {
 			return err
 		}
@@ -137,7 +251,9 @@ func (executor *Executor) setBackupMode(ctx context.Context) error {
 		}
 
 		return nil
-	}); err != nil {
+	})
+	tracing.End(waitSpan, err)
+	if err != nil {
 		return err
 	}
 
@@ -145,6 +261,24 @@ func (executor *Executor) setBackupMode(ctx context.Context) error {
 	return nil
 }
 
+// snapshotJob is the snapshot of the data directory or of a tablespace
+type snapshotJob struct {
+	// name is the name used to report the progress of the snapshot
+	name string
+
+	// path is the directory to be snapshotted
+	path string
+
+	// tags are the tags added to the snapshot
+	tags map[string]string
+
+	// snapshotID is the ID of the snapshot, once taken
+	snapshotID string
+
+	// sizeBytes is the size of the files in the snapshot, once taken
+	sizeBytes int64
+}
+
 // execSnapshot takes the snapshot of the data directory and the tablespace folder
 func (executor *Executor) execSnapshot(ctx context.Context) error {
 	const snapshotTablespaceOidName = "oid"
@@ -155,33 +289,116 @@ func (executor *Executor) execSnapshot(ctx context.Context) error {
 		snapshotTypeTablespace = "tablespace"
 	)
 
-	logger := logging.FromContext(ctx)
-
 	tablespaces, err := executor.getTablespaces(ctx)
 	if err != nil {
 		return err
 	}
 
-	logger.Info("Taking snapshot of data directory")
-	err = executor.repository.takeSnapshot(ctx, pgDataLocation, map[string]string{
-		snapshotTypeName: snapshotTypeBase,
+	jobs := make([]*snapshotJob, 0, len(tablespaces)+1)
+	jobs = append(jobs, &snapshotJob{
+		name: dataDirectoryProgressName,
+		path: pgDataLocation,
+		tags: map[string]string{
+			snapshotTypeName:   snapshotTypeBase,
+			snapshotBackupName: executor.backup.Name,
+		},
 	})
-	if err != nil {
+	for i := range tablespaces {
+		jobs = append(jobs, &snapshotJob{
+			name: tablespaces[i].oid,
+			path: tablespaces[i].path,
+			tags: map[string]string{
+				snapshotTypeName:          snapshotTypeTablespace,
+				snapshotTablespaceOidName: tablespaces[i].oid,
+				snapshotBackupName:        executor.backup.Name,
+			},
+		})
+	}
+
+	reporter := newProgressReporter(executor.cluster.Name)
+	reporterCtx, stopReporter := context.WithCancel(ctx)
+	defer func() {
+		stopReporter()
+		reporter.log(ctx)
+		reporter.close()
+	}()
+	go reporter.run(reporterCtx)
+
+	if err := executor.runSnapshotJobs(ctx, jobs, reporter); err != nil {
+		executor.removeSnapshots(ctx, jobs)
 		return err
 	}
 
-	for i := range tablespaces {
-		logger.Info("Taking snapshot of tablespace", "tablespace", tablespaces[i])
-		err := executor.repository.takeSnapshot(ctx, tablespaces[i].path, map[string]string{
-			snapshotTypeName:          snapshotTypeTablespace,
-			snapshotTablespaceOidName: tablespaces[i].oid,
-		})
-		if err != nil {
-			return err
+	executor.snapshots = jobs
+	return nil
+}
+
+// runSnapshotJobs takes the snapshots, running at most executor.concurrency
+// of them at the same time. Once a snapshot fails, no other snapshot is
+// started, and the errors of the ones already running are aggregated
+func (executor *Executor) runSnapshotJobs(ctx context.Context, jobs []*snapshotJob, reporter *progressReporter) error {
+	logger := logging.FromContext(ctx)
+
+	var (
+		wg        sync.WaitGroup
+		errorsMu  sync.Mutex
+		jobErrors []error
+	)
+	failed := func() bool {
+		errorsMu.Lock()
+		defer errorsMu.Unlock()
+		return len(jobErrors) > 0
+	}
+
+	semaphore := make(chan struct{}, executor.concurrency)
+	for _, job := range jobs {
+		semaphore <- struct{}{}
+		if failed() {
+			<-semaphore
+			break
 		}
+
+		wg.Add(1)
+		go func(job *snapshotJob) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			logger.Info("Taking snapshot", "name", job.name, "path", job.path)
+			manifest, err := executor.repository.takeSnapshot(ctx, job.path, job.tags, reporter.forTablespace(job.name))
+			if err != nil {
+				errorsMu.Lock()
+				jobErrors = append(jobErrors, fmt.Errorf("while taking snapshot of %s: %w", job.name, err))
+				errorsMu.Unlock()
+				return
+			}
+
+			logger.Info("Snapshot taken", "name", job.name, "snapshotID", manifest.ID)
+			job.snapshotID = manifest.ID
+			job.sizeBytes = manifest.Stats.TotalSize
+		}(job)
 	}
+	wg.Wait()
 
-	return nil
+	return errors.Join(jobErrors...)
+}
+
+// removeSnapshots removes the snapshots that were taken by a failed
+// backup, as they are not usable without the other ones
+func (executor *Executor) removeSnapshots(ctx context.Context, jobs []*snapshotJob) {
+	logger := logging.FromContext(ctx)
+
+	for _, job := range jobs {
+		if len(job.snapshotID) == 0 {
+			continue
+		}
+
+		logger.Info("Removing partial snapshot", "name", job.name, "snapshotID", job.snapshotID)
+		if err := executor.repository.DeleteSnapshot(ctx, job.snapshotID); err != nil {
+			logger.Error(err, "Error while removing partial snapshot", "snapshotID", job.snapshotID)
+		}
+	}
 }
 
 // GetTablespaces read the list of tablespaces
@@ -226,8 +443,12 @@ func (executor *Executor) unsetBackupMode(ctx context.Context) (*webserver.Backu
 
 	logger.Info("Stopping PostgreSQL Backup mode")
 	var backupStatus webserver.BackupResultData
-	if err := retry.OnError(backupModeBackoff, retryOnBackupNotStopped, func() error {
-		response, err := executor.backupClient.StatusWithErrors(ctx, executor.backupClientEndpoint)
+	waitCtx, waitSpan := tracing.Start(ctx, "wait for backup stop")
+	attempt := 0
+	err := retry.OnError(backupModeBackoff, retryOnBackupNotStopped, func() error {
+		attempt++
+		waitSpan.AddEvent("status request", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		response, err := executor.backupClient.StatusWithErrors(waitCtx, executor.backupClientEndpoint)
 		if err != nil {
 			return err
 		}
@@ -240,12 +461,13 @@ func (executor *Executor) unsetBackupMode(ctx context.Context) (*webserver.Backu
 		backupStatus = *response.Data
 
 		return nil
-	}); err != nil {
+	})
+	tracing.End(waitSpan, err)
+	if err != nil {
 		return nil, err
 	}
 	logger.Info("PostgreSQL Backup mode stopped")
 
-	var err error
 	executor.endWal, err = executor.getCurrentWALFile(ctx)
 	if err != nil {
 		return nil, err
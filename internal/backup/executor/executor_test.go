@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"go.opentelemetry.io/otel/codes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing/tracingtest"
+)
+
+func TestTakeBackupAbortedSpans(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	exec := newExecutor(
+		&apiv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster-example"}},
+		&apiv1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup-example"}},
+		nil,
+		"",
+		1,
+		BackupHooks{
+			Pre: []Hook{
+				{Name: "freeze", Command: []string{"false"}, Timeout: time.Minute, AbortOnFailure: true},
+			},
+		},
+	)
+
+	_, err := exec.TakeBackup(context.Background())
+	if !errors.Is(err, errHookAborted) {
+		t.Fatalf("expected the backup to be aborted by the hook, got %v", err)
+	}
+
+	backupSpan := tracingtest.FindSpan(t, recorder, "backup")
+	if value := tracingtest.GetAttribute(t, backupSpan, "backup.name"); value.AsString() != "backup-example" {
+		t.Errorf("unexpected backup.name attribute %q", value.AsString())
+	}
+	if value := tracingtest.GetAttribute(t, backupSpan, "cluster.name"); value.AsString() != "cluster-example" {
+		t.Errorf("unexpected cluster.name attribute %q", value.AsString())
+	}
+	if status := backupSpan.Status(); status.Code != codes.Error || status.Description != err.Error() {
+		t.Errorf("unexpected status %v", status)
+	}
+
+	hooksSpan := tracingtest.FindSpan(t, recorder, "pre-backup hooks")
+	if hooksSpan.Parent().SpanID() != backupSpan.SpanContext().SpanID() {
+		t.Error("expected the phase span to be started inside the backup span")
+	}
+	if hooksSpan.Status().Code != codes.Error {
+		t.Errorf("unexpected status %v", hooksSpan.Status())
+	}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "start backup mode" {
+			t.Error("expected the backup to stop after the pre-backup hooks")
+		}
+	}
+}
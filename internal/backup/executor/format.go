@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"fmt"
+)
+
+// SupportedEncryptions are the encryption algorithms supported by Kopia
+var SupportedEncryptions = []string{
+	"AES256-GCM-HMAC-SHA256",
+	"CHACHA20-POLY1305-HMAC-SHA256",
+}
+
+// SupportedHashes are the hash algorithms supported by Kopia
+var SupportedHashes = []string{
+	"BLAKE2B-256",
+	"BLAKE2B-256-128",
+	"BLAKE2S-128",
+	"BLAKE2S-256",
+	"BLAKE3-256",
+	"BLAKE3-256-128",
+	"HMAC-SHA224",
+	"HMAC-SHA256",
+	"HMAC-SHA256-128",
+	"HMAC-SHA3-224",
+	"HMAC-SHA3-256",
+}
+
+// SupportedSplitters are the object splitters supported by Kopia
+var SupportedSplitters = []string{
+	"FIXED-1M",
+	"FIXED-2M",
+	"FIXED-4M",
+	"FIXED-8M",
+	"DYNAMIC-1M-BUZHASH",
+	"DYNAMIC-2M-BUZHASH",
+	"DYNAMIC-4M-BUZHASH",
+	"DYNAMIC-8M-BUZHASH",
+	"DYNAMIC-1M-RABINKARP",
+	"DYNAMIC-2M-RABINKARP",
+	"DYNAMIC-4M-RABINKARP",
+	"DYNAMIC-8M-RABINKARP",
+}
+
+// compressors maps the supported compressions
+// to the corresponding Kopia compressor
+var compressors = map[string]string{
+	"zstd": "zstd",
+	"s2":   "s2-default",
+	"none": "none",
+}
+
+// SupportedCompressions are the supported compressions
+var SupportedCompressions = []string{"zstd", "s2", "none"}
+
+// RepositoryFormat contains the algorithms used by a repository.
+// Empty values select the Kopia defaults
+type RepositoryFormat struct {
+	Encryption  string
+	Hash        string
+	Splitter    string
+	Compression string
+}
+
+// kopiaCreateArgs gets the flags to be passed to "kopia repository create"
+// to apply this format
+func (format RepositoryFormat) kopiaCreateArgs() []string {
+	var result []string
+	if len(format.Encryption) > 0 {
+		result = append(result, fmt.Sprintf("--encryption=%s", format.Encryption))
+	}
+	if len(format.Hash) > 0 {
+		result = append(result, fmt.Sprintf("--block-hash=%s", format.Hash))
+	}
+	if len(format.Splitter) > 0 {
+		result = append(result, fmt.Sprintf("--object-splitter=%s", format.Splitter))
+	}
+	return result
+}
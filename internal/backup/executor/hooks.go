@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+)
+
+const (
+	hookPhasePre  = "pre"
+	hookPhasePost = "post"
+
+	// hookOutputLimit is the number of bytes of the output
+	// of a hook that are recorded in the catalog
+	hookOutputLimit = 4096
+
+	// postgresSocketDirectory is where the instance manager creates the
+	// PostgreSQL socket, shared with the sidecar through the scratch volume
+	postgresSocketDirectory = "/controller/run"
+
+	// hookDefaultDatabase is the database where the SQL hooks are run
+	// when no database is specified
+	hookDefaultDatabase = "postgres"
+)
+
+// Environment variables passed to the command hooks
+const (
+	hookClusterNameEnvironment = "CNPG_CLUSTER_NAME"
+	hookBackupNameEnvironment  = "CNPG_BACKUP_NAME"
+	hookPhaseEnvironment       = "CNPG_BACKUP_HOOK_PHASE"
+)
+
+// errHookAborted is returned when a hook whose failure aborts the backup fails
+var errHookAborted = errors.New("backup aborted by hook")
+
+// Hook is a command or an SQL statement run around a backup
+type Hook struct {
+	// Name identifies the hook in the logs and in the catalog
+	Name string
+
+	// Command is the command to be run in the sidecar, with its arguments
+	Command []string
+
+	// SQL is the statement to be run in the instance
+	SQL string
+
+	// Database is the database where SQL is run, defaults to "postgres"
+	Database string
+
+	// Timeout is the maximum duration of the hook
+	Timeout time.Duration
+
+	// AbortOnFailure makes the backup fail when the hook fails.
+	// A failed post-backup hook removes the snapshots just taken
+	AbortOnFailure bool
+}
+
+// BackupHooks are the hooks run around a backup
+type BackupHooks struct {
+	Pre  []Hook
+	Post []Hook
+}
+
+// runHooks runs the hooks of a phase in order, recording their outcome.
+// It stops at the first failed hook whose failure aborts the backup
+func (executor *Executor) runHooks(ctx context.Context, phase string, hooks []Hook) error {
+	contextLogger := logging.FromContext(ctx)
+
+	for i := range hooks {
+		hook := &hooks[i]
+		hookLogger := contextLogger.WithValues("hookName", hook.Name, "hookPhase", phase)
+
+		hookLogger.Info("Running backup hook")
+		result := executor.runHook(ctx, phase, hook)
+		executor.hookResults = append(executor.hookResults, result)
+
+		if len(result.Error) == 0 {
+			hookLogger.Info("Backup hook completed")
+			continue
+		}
+
+		hookLogger.Info("Backup hook failed", "error", result.Error, "output", result.Output)
+		if hook.AbortOnFailure {
+			return fmt.Errorf("%w: %s hook %s: %s", errHookAborted, phase, hook.Name, result.Error)
+		}
+	}
+
+	return nil
+}
+
+func (executor *Executor) runHook(ctx context.Context, phase string, hook *Hook) catalog.HookResult {
+	result := catalog.HookResult{
+		Name:      hook.Name,
+		Phase:     phase,
+		StartedAt: time.Now(),
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	var output string
+	var err error
+	if len(hook.Command) > 0 {
+		output, err = executor.runCommandHook(hookCtx, phase, hook)
+	} else {
+		output, err = runSQLHook(hookCtx, hook)
+	}
+
+	result.StoppedAt = time.Now()
+	if len(output) > hookOutputLimit {
+		output = output[:hookOutputLimit]
+	}
+	result.Output = output
+	if errors.Is(hookCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", hook.Timeout)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func (executor *Executor) runCommandHook(ctx context.Context, phase string, hook *Hook) (string, error) {
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...) // nolint:gosec
+	cmd.Env = append(
+		os.Environ(),
+		fmt.Sprintf("%s=%s", hookClusterNameEnvironment, executor.cluster.Name),
+		fmt.Sprintf("%s=%s", hookBackupNameEnvironment, executor.backup.Name),
+		fmt.Sprintf("%s=%s", hookPhaseEnvironment, phase),
+	)
+
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func runSQLHook(ctx context.Context, hook *Hook) (string, error) {
+	database := hook.Database
+	if len(database) == 0 {
+		database = hookDefaultDatabase
+	}
+
+	config, err := pgx.ParseConfig(fmt.Sprintf("host=%s user=postgres", postgresSocketDirectory))
+	if err != nil {
+		return "", err
+	}
+	config.Database = database
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = conn.Close(context.WithoutCancel(ctx))
+	}()
+
+	tag, err := conn.Exec(ctx, hook.SQL)
+	return tag.String(), err
+}
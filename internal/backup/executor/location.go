@@ -0,0 +1,143 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+)
+
+const (
+	// kopiaS3FormatBlob is the name of the blob Kopia writes when
+	// a repository is created in an S3 bucket
+	kopiaS3FormatBlob = "kopia.repository"
+
+	// kopiaFilesystemFormatBlob is the name of the file Kopia writes
+	// when a repository is created in a directory
+	kopiaFilesystemFormatBlob = "kopia.repository.f"
+)
+
+// RepositoryLocation is the storage where Kopia keeps
+// the repository content
+type RepositoryLocation interface {
+	// kopiaStorageArgs gets the storage type and flags to be passed
+	// to "kopia repository create" and "kopia repository connect"
+	kopiaStorageArgs() []string
+
+	// exists checks if a repository has already been created
+	// in this location
+	exists(ctx context.Context) (bool, error)
+}
+
+// FilesystemLocation is a repository stored in a local directory,
+// such as one inside the backup PVC
+type FilesystemLocation struct {
+	path string
+}
+
+// NewFilesystemLocation creates a repository location pointing
+// to a local directory
+func NewFilesystemLocation(path string) *FilesystemLocation {
+	return &FilesystemLocation{path: path}
+}
+
+func (location *FilesystemLocation) kopiaStorageArgs() []string {
+	return []string{
+		"filesystem",
+		fmt.Sprintf("--path=%s", location.path),
+	}
+}
+
+func (location *FilesystemLocation) exists(context.Context) (bool, error) {
+	// The directory may exist without containing a repository,
+	// i.e. when the repository content was wiped
+	return fileutils.FileExists(path.Join(location.path, kopiaFilesystemFormatBlob))
+}
+
+// S3Location is a repository stored in an S3-compatible object store
+type S3Location struct {
+	options   storage.S3Options
+	keyPrefix string
+	backend   storage.Backend
+}
+
+// NewS3Location creates a repository location pointing to the
+// passed key prefix inside an S3-compatible object store
+func NewS3Location(options storage.S3Options, keyPrefix string) (*S3Location, error) {
+	backend, err := storage.NewS3Backend(options, storage.GetS3CredentialsFromEnvironment(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Location{
+		options:   options,
+		keyPrefix: keyPrefix,
+		backend:   backend,
+	}, nil
+}
+
+func (location *S3Location) kopiaStorageArgs() []string {
+	// Kopia concatenates the prefix and the blob names, so
+	// we need the prefix to end with a slash
+	prefix := strings.Trim(path.Join(location.options.Prefix, location.keyPrefix), "/") + "/"
+
+	result := []string{
+		"s3",
+		fmt.Sprintf("--bucket=%s", location.options.Bucket),
+		fmt.Sprintf("--prefix=%s", prefix),
+		fmt.Sprintf("--region=%s", location.options.Region),
+	}
+
+	// The endpoint has already been validated by the operator
+	// webhook, so we can ignore parsing errors here
+	if endpointURL, err := url.Parse(location.options.Endpoint); err == nil && len(endpointURL.Host) > 0 {
+		result = append(result, fmt.Sprintf("--endpoint=%s", endpointURL.Host))
+		if endpointURL.Scheme == "http" {
+			result = append(result, "--disable-tls")
+		}
+	}
+
+	if len(location.options.CAFile) > 0 {
+		result = append(result, fmt.Sprintf("--root-ca-pem-path=%s", location.options.CAFile))
+	}
+
+	return result
+}
+
+func (location *S3Location) exists(ctx context.Context) (bool, error) {
+	_, err := location.backend.Stat(ctx, path.Join(location.keyPrefix, kopiaS3FormatBlob))
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetRepositoryLocation gets the location of the Kopia repository
+// of a cluster, as selected by the storage options
+func GetRepositoryLocation(clusterName string, options storage.Options) (RepositoryLocation, error) {
+	switch options.Type {
+	case storage.BackendTypePVC:
+		return NewFilesystemLocation(storage.GetBasePath(clusterName)), nil
+
+	case storage.BackendTypeS3:
+		return NewS3Location(options.S3, storage.GetBasePrefixKey(clusterName))
+
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", options.Type)
+	}
+}
+
+// RepositoryExists checks if a repository has already been
+// created in a location
+func RepositoryExists(ctx context.Context, location RepositoryLocation) (bool, error) {
+	return location.exists(ctx)
+}
@@ -0,0 +1,248 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/lock"
+)
+
+// maintenanceLockStaleTimeout is the time after which the maintenance
+// lock of an instance that died is taken over
+const maintenanceLockStaleTimeout = 10 * time.Minute
+
+// MaintenanceSchedule contains how often the maintenance tasks
+// should run. A zero interval disables the corresponding task
+type MaintenanceSchedule struct {
+	QuickInterval time.Duration
+	FullInterval  time.Duration
+}
+
+// MaintenanceRun is the outcome of a maintenance run
+type MaintenanceRun struct {
+	// Owner is the instance that ran the maintenance
+	Owner string `json:"owner"`
+
+	// StartedAt is the time when the maintenance was started
+	StartedAt time.Time `json:"startedAt"`
+
+	// StoppedAt is the time when the maintenance was completed
+	StoppedAt time.Time `json:"stoppedAt"`
+
+	// Error is the error that made the maintenance fail, if any
+	Error string `json:"error,omitempty"`
+}
+
+// isDue checks if a maintenance whose last run is this
+// one should run again
+func (run *MaintenanceRun) isDue(interval time.Duration) bool {
+	if interval == 0 {
+		return false
+	}
+
+	if run == nil || len(run.Error) > 0 {
+		return true
+	}
+
+	return time.Since(run.StartedAt) >= interval
+}
+
+// MaintenanceStatus is the outcome of the last maintenance runs,
+// shared between the instances using the repository
+type MaintenanceStatus struct {
+	LastQuick *MaintenanceRun `json:"lastQuick,omitempty"`
+	LastFull  *MaintenanceRun `json:"lastFull,omitempty"`
+}
+
+// Maintenance runs the Kopia maintenance tasks on a repository
+type Maintenance struct {
+	repository *Repository
+	schedule   MaintenanceSchedule
+	statusFile string
+	lockFile   string
+}
+
+// NewMaintenance creates a new Maintenance for a repository. The status
+// and the lock files should be shared among every instance using the
+// repository
+func NewMaintenance(
+	repository *Repository,
+	schedule MaintenanceSchedule,
+	statusFile string,
+	lockFile string,
+) *Maintenance {
+	return &Maintenance{
+		repository: repository,
+		schedule:   schedule,
+		statusFile: statusFile,
+		lockFile:   lockFile,
+	}
+}
+
+// RunIfDue runs the maintenance tasks whose interval has elapsed.
+// When another instance is already running the maintenance, nothing is done
+func (maintenance *Maintenance) RunIfDue(ctx context.Context) error {
+	contextLogger := logging.FromContext(ctx)
+
+	status, err := maintenance.readStatus()
+	if err != nil {
+		return err
+	}
+
+	full := status.LastFull.isDue(maintenance.schedule.FullInterval)
+	quick := status.LastQuick.isDue(maintenance.schedule.QuickInterval)
+	if !full && !quick {
+		contextLogger.V(4).Info("No maintenance is due")
+		return nil
+	}
+
+	owner, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	maintenanceLock, err := lock.Acquire(ctx, maintenance.lockFile, owner, maintenanceLockStaleTimeout)
+	if errors.Is(err, lock.ErrLocked) {
+		contextLogger.Info("Skipping maintenance, another instance is running it", "reason", err.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := maintenanceLock.Release(); err != nil {
+			contextLogger.Error(err, "Error while releasing maintenance lock")
+		}
+	}()
+
+	// Another instance may have run the maintenance while
+	// we were waiting for the lock
+	if status, err = maintenance.readStatus(); err != nil {
+		return err
+	}
+	full = status.LastFull.isDue(maintenance.schedule.FullInterval)
+	quick = status.LastQuick.isDue(maintenance.schedule.QuickInterval)
+	if !full && !quick {
+		return nil
+	}
+
+	return maintenance.run(ctx, owner, status, full)
+}
+
+// Run runs the maintenance tasks now, regardless of the schedule.
+// When another instance is already running the maintenance, lock.ErrLocked
+// is returned
+func (maintenance *Maintenance) Run(ctx context.Context, full bool) error {
+	contextLogger := logging.FromContext(ctx)
+
+	owner, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	maintenanceLock, err := lock.Acquire(ctx, maintenance.lockFile, owner, maintenanceLockStaleTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := maintenanceLock.Release(); err != nil {
+			contextLogger.Error(err, "Error while releasing maintenance lock")
+		}
+	}()
+
+	status, err := maintenance.readStatus()
+	if err != nil {
+		return err
+	}
+
+	return maintenance.run(ctx, owner, status, full)
+}
+
+// run runs the maintenance tasks and records their outcome in the
+// status file. The maintenance lock must be held by the caller
+func (maintenance *Maintenance) run(ctx context.Context, owner string, status *MaintenanceStatus, full bool) error {
+	contextLogger := logging.FromContext(ctx)
+
+	run := &MaintenanceRun{
+		Owner:     owner,
+		StartedAt: time.Now(),
+	}
+	contextLogger.Info("Starting Kopia maintenance", "full", full)
+	runErr := maintenance.repository.runMaintenance(ctx, full)
+	run.StoppedAt = time.Now()
+	if runErr != nil {
+		run.Error = runErr.Error()
+		contextLogger.Error(runErr, "Kopia maintenance failed", "full", full)
+	} else {
+		contextLogger.Info(
+			"Kopia maintenance completed",
+			"full", full,
+			"duration", run.StoppedAt.Sub(run.StartedAt).String())
+	}
+
+	// A full maintenance includes the quick maintenance tasks
+	if full {
+		status.LastFull = run
+	}
+	status.LastQuick = run
+
+	if err := maintenance.writeStatus(status); err != nil {
+		return err
+	}
+
+	return runErr
+}
+
+func (maintenance *Maintenance) readStatus() (*MaintenanceStatus, error) {
+	var result MaintenanceStatus
+
+	data, err := os.ReadFile(maintenance.statusFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return &result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("while decoding maintenance status: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (maintenance *Maintenance) writeStatus(status *MaintenanceStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return fileutils.WriteFileAtomic(maintenance.statusFile, bytes.NewReader(data))
+}
+
+// runMaintenance runs the Kopia maintenance. Kopia only runs the
+// maintenance when the current user is the maintenance owner,
+// and all the instances share the same Kopia configuration. We
+// take the ownership every time, as concurrent runs are already
+// prevented by the maintenance lock
+func (repo *Repository) runMaintenance(ctx context.Context, full bool) error {
+	if _, err := repo.runKopia(ctx, "maintenance", "set", "--owner=me"); err != nil {
+		return err
+	}
+
+	args := []string{"maintenance", "run"}
+	if full {
+		args = append(args, "--full")
+	}
+
+	_, err := repo.runKopia(ctx, args...)
+	return err
+}
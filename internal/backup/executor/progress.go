@@ -0,0 +1,247 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/metrics"
+)
+
+const (
+	// progressLogInterval is how often the progress of a running
+	// backup is written in the logs
+	progressLogInterval = 30 * time.Second
+
+	// kopiaProgressUpdateInterval is how often Kopia reports
+	// the progress of a snapshot
+	kopiaProgressUpdateInterval = 5 * time.Second
+)
+
+// kopiaProgressRegexp matches the progress lines Kopia writes while
+// taking a snapshot, i.e.:
+//
+//	| 2 hashing, 1234 hashed (1.2 GB), 56 cached (3.4 MB), uploaded 1.1 GB, estimated 10 GB (12.3%) 5m left
+var kopiaProgressRegexp = regexp.MustCompile(
+	`(\d+) hashing, (\d+) hashed \(([^)]*)\), (\d+) cached \(([^)]*)\), uploaded ([^,(]*)` +
+		`(?:.*, estimated ([^(]*) \(([\d.]+)%\))?`)
+
+// SnapshotProgress is the progress of a Kopia snapshot
+type SnapshotProgress struct {
+	HashedFiles    int64
+	HashedBytes    int64
+	CachedFiles    int64
+	CachedBytes    int64
+	UploadedBytes  int64
+	EstimatedBytes int64
+	Percent        float64
+}
+
+// parseKopiaProgress parses a progress line written by Kopia,
+// returning false if the line doesn't contain the progress
+func parseKopiaProgress(line string) (SnapshotProgress, bool) {
+	matches := kopiaProgressRegexp.FindStringSubmatch(line)
+	if matches == nil {
+		return SnapshotProgress{}, false
+	}
+
+	result := SnapshotProgress{
+		HashedFiles:   parseInt(matches[2]),
+		HashedBytes:   parseBytes(matches[3]),
+		CachedFiles:   parseInt(matches[4]),
+		CachedBytes:   parseBytes(matches[5]),
+		UploadedBytes: parseBytes(matches[6]),
+	}
+
+	if len(matches[7]) > 0 {
+		result.EstimatedBytes = parseBytes(matches[7])
+		result.Percent, _ = strconv.ParseFloat(matches[8], 64)
+	}
+
+	return result, true
+}
+
+func parseInt(value string) int64 {
+	result, _ := strconv.ParseInt(value, 10, 64)
+	return result
+}
+
+// byteUnits are the units used by Kopia when writing sizes
+var byteUnits = map[string]float64{
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"PB":  1e15,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+	"PiB": 1 << 50,
+}
+
+// parseBytes parses a size written by Kopia, such as "1.2 GB"
+func parseBytes(value string) int64 {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0
+	}
+
+	number, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+
+	return int64(number * byteUnits[fields[1]])
+}
+
+// scanProgressLines is a bufio.SplitFunc splitting on both
+// carriage returns and new lines, as Kopia rewrites the
+// progress line using carriage returns
+func scanProgressLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[0:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// readKopiaProgress reads the output of Kopia invoking the callback for
+// every progress line. Every other line is written into the passed writer
+func readKopiaProgress(output io.Reader, onProgress func(SnapshotProgress), others io.Writer) {
+	scanner := bufio.NewScanner(output)
+	scanner.Split(scanProgressLines)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if progress, ok := parseKopiaProgress(line); ok {
+			onProgress(progress)
+			continue
+		}
+
+		if len(strings.TrimSpace(line)) > 0 {
+			_, _ = io.WriteString(others, line+"\n")
+		}
+	}
+
+	// Kopia must not block on a full pipe if we stopped scanning,
+	// i.e. because of a line too long for the scanner buffer
+	_, _ = io.Copy(io.Discard, output)
+}
+
+// progressReporter collects the progress of the snapshots
+// composing a backup, publishing it in the logs and in the metrics
+type progressReporter struct {
+	clusterName string
+
+	mu         sync.Mutex
+	snapshots  map[string]SnapshotProgress
+	tablespace string
+}
+
+func newProgressReporter(clusterName string) *progressReporter {
+	return &progressReporter{
+		clusterName: clusterName,
+		snapshots:   make(map[string]SnapshotProgress),
+	}
+}
+
+// forTablespace gets a callback updating the progress of the
+// snapshot of the passed tablespace
+func (reporter *progressReporter) forTablespace(tablespace string) func(SnapshotProgress) {
+	return func(progress SnapshotProgress) {
+		reporter.mu.Lock()
+		reporter.snapshots[tablespace] = progress
+		reporter.tablespace = tablespace
+		reporter.mu.Unlock()
+
+		metrics.SetBackupProgress(reporter.clusterName, tablespace, metrics.BackupProgress{
+			HashedBytes:    progress.HashedBytes,
+			CachedBytes:    progress.CachedBytes,
+			UploadedBytes:  progress.UploadedBytes,
+			EstimatedBytes: progress.EstimatedBytes,
+			Files:          progress.HashedFiles + progress.CachedFiles,
+		})
+	}
+}
+
+// total gets the progress of the whole backup
+func (reporter *progressReporter) total() SnapshotProgress {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	var result SnapshotProgress
+	for _, progress := range reporter.snapshots {
+		result.HashedFiles += progress.HashedFiles
+		result.HashedBytes += progress.HashedBytes
+		result.CachedFiles += progress.CachedFiles
+		result.CachedBytes += progress.CachedBytes
+		result.UploadedBytes += progress.UploadedBytes
+		result.EstimatedBytes += progress.EstimatedBytes
+	}
+
+	return result
+}
+
+// log writes the current progress in the logs
+func (reporter *progressReporter) log(ctx context.Context) {
+	contextLogger := logging.FromContext(ctx)
+
+	total := reporter.total()
+
+	reporter.mu.Lock()
+	tablespaces := make([]string, 0, len(reporter.snapshots))
+	for tablespace := range reporter.snapshots {
+		tablespaces = append(tablespaces, tablespace)
+	}
+	currentTablespace := reporter.tablespace
+	reporter.mu.Unlock()
+	sort.Strings(tablespaces)
+
+	contextLogger.Info(
+		"Backup progress",
+		"currentTablespace", currentTablespace,
+		"startedTablespaces", tablespaces,
+		"files", total.HashedFiles+total.CachedFiles,
+		"hashedBytes", total.HashedBytes,
+		"cachedBytes", total.CachedBytes,
+		"uploadedBytes", total.UploadedBytes,
+	)
+}
+
+// run logs the progress periodically, until the context is cancelled
+func (reporter *progressReporter) run(ctx context.Context) {
+	ticker := time.NewTicker(progressLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reporter.log(ctx)
+		}
+	}
+}
+
+// close removes the progress from the metrics
+func (reporter *progressReporter) close() {
+	metrics.ClearBackupProgress(reporter.clusterName)
+}
@@ -0,0 +1,177 @@
+package executor
+
+import (
+	"bufio"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The progress lines below follow the output of "kopia snapshot create",
+// with the spinner before the counters, the SI or base 2 units depending
+// on KOPIA_BYTES_STRING_BASE_2 and the count of the ignored errors
+const (
+	kopiaEstimatingLine = ` | 3 hashing, 120 hashed (45.6 MB), 0 cached (0 B), uploaded 12.3 MB, estimating...`
+	kopiaEstimatedLine  = ` / 1 hashing, 1530 hashed (1.2 GB), 15 cached (3.4 MB), uploaded 1.1 GB, ` +
+		`estimated 10 GB (12.3%) 5m12s left`
+	kopiaBase2Line = ` - 0 hashing, 12 hashed (1.5 GiB), 4 cached (512 KiB), uploaded 768 MiB, ` +
+		`estimated 2 GiB (75.0%) 10s left`
+	kopiaErrorsLine = ` \ 0 hashing, 7 hashed (900 B), 1 cached (2 KB), uploaded 900 B (2 errors ignored), ` +
+		`estimated 1 MB (0.1%) 1h left`
+)
+
+func TestParseKopiaProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected SnapshotProgress
+		ok       bool
+	}{
+		{
+			name: "estimate in progress",
+			line: kopiaEstimatingLine,
+			expected: SnapshotProgress{
+				HashedFiles:   120,
+				HashedBytes:   45_600_000,
+				UploadedBytes: 12_300_000,
+			},
+			ok: true,
+		},
+		{
+			name: "estimated size",
+			line: kopiaEstimatedLine,
+			expected: SnapshotProgress{
+				HashedFiles:    1530,
+				HashedBytes:    1_200_000_000,
+				CachedFiles:    15,
+				CachedBytes:    3_400_000,
+				UploadedBytes:  1_100_000_000,
+				EstimatedBytes: 10_000_000_000,
+				Percent:        12.3,
+			},
+			ok: true,
+		},
+		{
+			name: "base 2 units",
+			line: kopiaBase2Line,
+			expected: SnapshotProgress{
+				HashedFiles:    12,
+				HashedBytes:    1536 << 20,
+				CachedFiles:    4,
+				CachedBytes:    512 << 10,
+				UploadedBytes:  768 << 20,
+				EstimatedBytes: 2 << 30,
+				Percent:        75,
+			},
+			ok: true,
+		},
+		{
+			name: "ignored errors",
+			line: kopiaErrorsLine,
+			expected: SnapshotProgress{
+				HashedFiles:    7,
+				HashedBytes:    900,
+				CachedFiles:    1,
+				CachedBytes:    2000,
+				UploadedBytes:  900,
+				EstimatedBytes: 1_000_000,
+				Percent:        0.1,
+			},
+			ok: true,
+		},
+		{
+			name: "other output",
+			line: "Snapshotting postgres@cluster:/var/lib/postgresql/data/pgdata ...",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			progress, ok := parseKopiaProgress(test.line)
+			if ok != test.ok {
+				t.Fatalf("expected the line to be parsed: %v, got %v", test.ok, ok)
+			}
+			if progress != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, progress)
+			}
+		})
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := map[string]int64{
+		"0 B":     0,
+		"900 B":   900,
+		"1.5 KB":  1500,
+		"2.3 TB":  2_300_000_000_000,
+		"1 KiB":   1024,
+		"1.5 MiB": 1536 << 10,
+		"4 PiB":   4 << 50,
+		"12":      0,
+		"a lot":   0,
+		"":        0,
+	}
+
+	for value, expected := range tests {
+		if result := parseBytes(value); result != expected {
+			t.Errorf("expected %q to be parsed as %d, got %d", value, expected, result)
+		}
+	}
+}
+
+func TestScanProgressLines(t *testing.T) {
+	output := "\r" + kopiaEstimatingLine + "\r" + kopiaEstimatedLine + "   \n" + "Created snapshot\r\n" + "last"
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Split(scanProgressLines)
+	var tokens []string
+	for scanner.Scan() {
+		tokens = append(tokens, scanner.Text())
+	}
+
+	expected := []string{"", kopiaEstimatingLine, kopiaEstimatedLine + "   ", "Created snapshot", "", "last"}
+	if !slices.Equal(tokens, expected) {
+		t.Errorf("expected tokens %q, got %q", expected, tokens)
+	}
+}
+
+func TestReadKopiaProgress(t *testing.T) {
+	// Kopia rewrites the progress line with carriage returns while the
+	// snapshot is running, and moves to a new line when it's done
+	output := "Snapshotting postgres@cluster:/var/lib/postgresql/data/pgdata ...\n" +
+		"\r" + kopiaEstimatingLine +
+		"\r" + kopiaEstimatedLine + "      " +
+		"\r" + kopiaBase2Line + "\n" +
+		"Created snapshot with root k1234 and ID 5678 in 1m2s\n"
+
+	var progress []SnapshotProgress
+	var others strings.Builder
+	readKopiaProgress(strings.NewReader(output), func(snapshotProgress SnapshotProgress) {
+		progress = append(progress, snapshotProgress)
+	}, &others)
+
+	var uploaded []int64
+	for _, snapshotProgress := range progress {
+		uploaded = append(uploaded, snapshotProgress.UploadedBytes)
+	}
+	if expected := []int64{12_300_000, 1_100_000_000, 768 << 20}; !slices.Equal(uploaded, expected) {
+		t.Errorf("expected the uploaded bytes %v, got %v", expected, uploaded)
+	}
+
+	expectedOthers := "Snapshotting postgres@cluster:/var/lib/postgresql/data/pgdata ...\n" +
+		"Created snapshot with root k1234 and ID 5678 in 1m2s\n"
+	if others.String() != expectedOthers {
+		t.Errorf("expected the other lines %q, got %q", expectedOthers, others.String())
+	}
+}
+
+func TestReadKopiaProgressLongLine(t *testing.T) {
+	// A line too long for the scanner stops the parsing,
+	// but the output is still drained
+	reader := strings.NewReader(strings.Repeat("x", bufio.MaxScanTokenSize+1) + "\n" + kopiaEstimatedLine + "\n")
+
+	readKopiaProgress(reader, func(SnapshotProgress) {}, &strings.Builder{})
+	if reader.Len() > 0 {
+		t.Errorf("expected the whole output to be read, %d bytes left", reader.Len())
+	}
+}
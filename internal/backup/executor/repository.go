@@ -1,14 +1,21 @@
 package executor
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"path"
+	"strings"
 
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing"
 )
 
 const (
@@ -17,33 +24,223 @@ const (
 	walFolder         = "pg_wal"
 )
 
+// ignoredFolders are the folders of the data directory that are not
+// snapshotted: the WAL files are archived on their own, and each
+// tablespace is snapshotted separately
+var ignoredFolders = []string{
+	path.Join(pgDataLocation, walFolder),
+	path.Join(pgDataLocation, tablespacesFolder),
+}
+
+// kopiaInvalidPasswordMessage is the message Kopia emits when
+// the repository cannot be opened with the passed password
+const kopiaInvalidPasswordMessage = "invalid repository password"
+
+const (
+	// passwordEnvironment is the environment variable Kopia
+	// reads the current password of the repository from
+	passwordEnvironment = "KOPIA_PASSWORD"
+
+	// newPasswordEnvironment is the environment variable Kopia reads
+	// the password the repository should be rotated to from
+	newPasswordEnvironment = "KOPIA_NEW_PASSWORD"
+)
+
+// PasswordMountPath is where the Secret holding the repository passwords
+// is mounted. The whole Secret is mounted, rather than the configured
+// keys, so that the sidecars that were started before a password rotation
+// was configured can read the new password too, as Kubernetes updates the
+// content of the mounted Secrets without restarting the Pods
+const PasswordMountPath = "/repository-secret"
+
+// ErrInvalidRepositoryPassword is returned when the repository
+// exists but the password in the Kopia Secret doesn't open it
+var ErrInvalidRepositoryPassword = errors.New(
+	"the repository password doesn't match the one the repository was created with")
+
+// repositoryState is the state of a repository from
+// the point of view of this plugin instance
+type repositoryState string
+
+const (
+	// repositoryStateAbsent means that the repository has
+	// never been created
+	repositoryStateAbsent repositoryState = "absent"
+
+	// repositoryStateDisconnected means that the repository
+	// exists, but there's no Kopia configuration pointing
+	// to it, i.e. because the cache was wiped or because a
+	// new cluster is using an existing repository
+	repositoryStateDisconnected repositoryState = "disconnected"
+
+	// repositoryStateConnected means that the repository exists
+	// and the Kopia configuration file points to it
+	repositoryStateConnected repositoryState = "connected"
+)
+
+// RepositoryPasswords are the passwords that can be used to
+// open a repository
+type RepositoryPasswords struct {
+	// Current is the password the repository is protected with
+	Current string
+
+	// New is the password the repository should be rotated to.
+	// While the rotation is in progress, both passwords are accepted
+	New string
+}
+
+// GetRepositoryPasswords reads the repository passwords from the keys
+// of the mounted Secret. The new password is only read when a rotation
+// is configured
+func GetRepositoryPasswords(secretKey, newSecretKey string) (RepositoryPasswords, error) {
+	return readRepositoryPasswords(PasswordMountPath, secretKey, newSecretKey)
+}
+
+func readRepositoryPasswords(directory, secretKey, newSecretKey string) (RepositoryPasswords, error) {
+	var result RepositoryPasswords
+
+	current, err := os.ReadFile(path.Join(directory, secretKey)) // nolint:gosec
+	if err != nil {
+		return result, fmt.Errorf("while reading the repository password: %w", err)
+	}
+	result.Current = string(current)
+
+	if len(newSecretKey) == 0 {
+		return result, nil
+	}
+
+	// A sidecar can only take part in the rotation once the new key is
+	// in its copy of the Secret, which Kubernetes updates with a delay
+	newPassword, err := os.ReadFile(path.Join(directory, newSecretKey)) // nolint:gosec
+	if err != nil {
+		return result, fmt.Errorf("while reading the new repository password: %w", err)
+	}
+	result.New = string(newPassword)
+
+	return result, nil
+}
+
+// CheckRepositorySecret checks that the Secret holding
+// the repository passwords is mounted
+func CheckRepositorySecret(context.Context) error {
+	return checkRepositorySecret(PasswordMountPath)
+}
+
+func checkRepositorySecret(directory string) error {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return fmt.Errorf("repository Secret not found: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("the repository Secret mounted on %s is empty", directory)
+	}
+
+	return nil
+}
+
+// candidates gets the passwords to be tried when opening the repository,
+// in order of preference
+func (passwords RepositoryPasswords) candidates() []string {
+	if len(passwords.New) == 0 || passwords.New == passwords.Current {
+		return []string{passwords.Current}
+	}
+
+	return []string{passwords.New, passwords.Current}
+}
+
+// RepositoryOptions are the options used to open a repository
+type RepositoryOptions struct {
+	// Location is where the repository content is stored
+	Location RepositoryLocation
+
+	// ConfigFile is the Kopia configuration file
+	ConfigFile string
+
+	// CacheDirectory is the directory used by Kopia for its cache and logs
+	CacheDirectory string
+
+	// Passwords are the passwords that can open the repository
+	Passwords RepositoryPasswords
+
+	// Format contains the algorithms used when creating the repository
+	Format RepositoryFormat
+
+	// Throttling contains the limits applied when taking snapshots.
+	// When nil, the limits stored in the Kopia configuration are left
+	// untouched, which is what the commands not taking backups need
+	Throttling *Throttling
+}
+
 // Repository represents a backup repository where
 // base directories are stored
 type Repository struct {
-	path           string
+	location       RepositoryLocation
 	cacheDirectory string
 	configFile     string
+
+	passwords  RepositoryPasswords
+	format     RepositoryFormat
+	throttling Throttling
+
+	// password is the password that is known to open the repository
+	password string
 }
 
 // NewRepository creates a new repository in a certain
-// path, ensuring that the repository is initialized and
+// location, ensuring that the repository is initialized and
 // ready to accept backups
-func NewRepository(ctx context.Context, path string, configFile string, cacheDirectory string) (*Repository, error) {
+func NewRepository(ctx context.Context, options RepositoryOptions) (*Repository, error) {
+	contextLogger := logging.FromContext(ctx)
+
 	result := &Repository{
-		path:           path,
-		configFile:     configFile,
-		cacheDirectory: cacheDirectory,
+		location:       options.Location,
+		configFile:     options.ConfigFile,
+		cacheDirectory: options.CacheDirectory,
+		passwords:      options.Passwords,
+		format:         options.Format,
 	}
+	passwords := options.Passwords
 
-	// We initialize the repository if it is not initialized
-	ok, err := fileutils.IsDir(path)
+	state, err := result.getState(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if !ok {
+	contextLogger.Info("Opening Kopia repository", "state", state)
+	switch state {
+	case repositoryStateAbsent:
+		// A new repository is directly created with the
+		// preferred password
+		result.password = passwords.candidates()[0]
 		err = result.initializeRepository(ctx)
-		if err != nil {
+
+	case repositoryStateDisconnected:
+		err = result.withAnyPassword(ctx, result.connectRepository)
+
+	case repositoryStateConnected:
+		err = result.withAnyPassword(ctx, result.validatePassword)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passwords.New) > 0 && result.password != passwords.New {
+		if err := result.rotatePassword(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// The compression is a policy and not a property of the repository
+	// format, so it can be changed and applies to the next snapshots
+	if len(result.format.Compression) > 0 {
+		if err := result.setCompression(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Throttling != nil {
+		result.throttling = *options.Throttling
+		if err := result.applyThrottling(ctx); err != nil {
 			return nil, err
 		}
 	}
@@ -51,108 +248,360 @@ func NewRepository(ctx context.Context, path string, configFile string, cacheDir
 	return result, nil
 }
 
-func (repo *Repository) initializeRepository(ctx context.Context) error {
-	logger := logging.FromContext(ctx)
+// withAnyPassword runs an operation opening the repository with each
+// password candidate, stopping at the first one that is accepted
+func (repo *Repository) withAnyPassword(ctx context.Context, operation func(context.Context) error) error {
+	var err error
+	for _, candidate := range repo.passwords.candidates() {
+		repo.password = candidate
+		err = operation(ctx)
+		if !errors.Is(err, ErrInvalidRepositoryPassword) {
+			return err
+		}
+	}
 
-	args := []string{
-		"kopia",
-		"Repository",
-		"create",
-		"filesystem",
-		fmt.Sprintf("--path=%s", repo.path),
+	return err
+}
+
+// rotatePassword changes the repository password to the new one,
+// verifying that the repository can be opened with it
+func (repo *Repository) rotatePassword(ctx context.Context) error {
+	contextLogger := logging.FromContext(ctx)
+
+	contextLogger.Info("Rotating Kopia repository password")
+	if _, err := repo.runKopia(ctx, "repository", "change-password"); err != nil {
+		return fmt.Errorf("while changing the repository password: %w", err)
+	}
+
+	// From now on, the old password doesn't open the repository anymore
+	previousPassword := repo.password
+	repo.password = repo.passwords.New
+	if err := repo.validatePassword(ctx); err != nil {
+		repo.password = previousPassword
+		return fmt.Errorf("while verifying the new repository password: %w", err)
+	}
+
+	contextLogger.Info("Kopia repository password rotated")
+	return nil
+}
+
+// getState detects the state of the repository
+func (repo *Repository) getState(ctx context.Context) (repositoryState, error) {
+	exists, err := repo.location.exists(ctx)
+	if err != nil {
+		return "", fmt.Errorf("while checking if the repository exists: %w", err)
+	}
+
+	hasConfig, err := fileutils.FileExists(repo.configFile)
+	if err != nil {
+		return "", fmt.Errorf("while checking the Kopia configuration file: %w", err)
+	}
+
+	switch {
+	case exists && hasConfig:
+		return repositoryStateConnected, nil
+
+	case exists:
+		return repositoryStateDisconnected, nil
+
+	case hasConfig:
+		// The configuration file is pointing to a repository that
+		// doesn't exist anymore. We remove it, as otherwise Kopia
+		// would refuse to create a new repository
+		if err := os.Remove(repo.configFile); err != nil {
+			return "", fmt.Errorf("while removing stale Kopia configuration file: %w", err)
+		}
+		return repositoryStateAbsent, nil
+
+	default:
+		return repositoryStateAbsent, nil
+	}
+}
+
+// CheckKopia checks that the Kopia binary can be run
+func CheckKopia(ctx context.Context) error {
+	output, err := exec.CommandContext(ctx, "kopia", "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot run kopia: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// kopiaCommand creates the command running Kopia against
+// this repository
+func (repo *Repository) kopiaCommand(ctx context.Context, args ...string) *exec.Cmd {
+	fullArgs := append([]string{"kopia"}, args...)
+	fullArgs = append(fullArgs,
 		fmt.Sprintf("--config-file=%s", repo.configFile),
 		fmt.Sprintf("--log-dir=%s/log", repo.cacheDirectory),
-		fmt.Sprintf("--cache-directory=%s", repo.cacheDirectory),
-	}
+	)
+
+	// The passwords are passed through the environment,
+	// so they don't appear in the logged arguments
+	cmd := exec.CommandContext(ctx, fullArgs[0], fullArgs[1:]...) // nolint:gosec
+	cmd.Env = append(
+		os.Environ(),
+		fmt.Sprintf("%s=%s", passwordEnvironment, repo.password),
+		fmt.Sprintf("%s=%s", newPasswordEnvironment, repo.passwords.New),
+	)
 
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // nolint:gosec
-	output, err := cmd.CombinedOutput()
+	return cmd
+}
+
+// runKopia runs a Kopia command against this repository,
+// returning its combined output
+func (repo *Repository) runKopia(ctx context.Context, args ...string) (output []byte, err error) {
+	ctx, span := tracing.Start(ctx, fmt.Sprintf("kopia %s %s", args[0], args[1]))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	logger := logging.FromContext(ctx)
+
+	cmd := repo.kopiaCommand(ctx, args...)
+	output, err = cmd.CombinedOutput()
 	if err != nil {
 		logger.Error(
 			err,
-			"Error invoking kopia create filesystem command",
-			"args", args,
+			fmt.Sprintf("Error invoking kopia %s %s command", args[0], args[1]),
+			"args", cmd.Args,
 			"output", string(output))
-		return err
+		return output, wrapKopiaError(err, output)
 	}
 
-	return repo.configureIgnoreFolders(ctx)
+	return output, nil
 }
 
-func (repo *Repository) configureIgnoreFolders(ctx context.Context) error {
-	if err := repo.addIgnoreFolder(ctx, path.Join(pgDataLocation, walFolder)); err != nil {
-		return err
+// runKopiaWithProgress runs a Kopia command against this repository,
+// invoking the callback every time Kopia reports its progress. The
+// standard output of the command is returned
+func (repo *Repository) runKopiaWithProgress(
+	ctx context.Context,
+	onProgress func(SnapshotProgress),
+	args ...string,
+) ([]byte, error) {
+	logger := logging.FromContext(ctx)
+
+	var stdout, stderr bytes.Buffer
+	cmd := repo.kopiaCommand(ctx, args...)
+	cmd.Stdout = &stdout
+	progressOutput, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// The pipe must be fully read before waiting for the command
+	readKopiaProgress(progressOutput, onProgress, &stderr)
+	err = cmd.Wait()
+	if err != nil {
+		logger.Error(
+			err,
+			fmt.Sprintf("Error invoking kopia %s %s command", args[0], args[1]),
+			"args", cmd.Args,
+			"output", stderr.String())
+		return stdout.Bytes(), wrapKopiaError(err, stderr.Bytes())
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// wrapKopiaError translates the well-known Kopia errors
+// into errors that can be checked by the callers
+func wrapKopiaError(err error, output []byte) error {
+	if strings.Contains(string(output), kopiaInvalidPasswordMessage) {
+		return fmt.Errorf("%w: %s", ErrInvalidRepositoryPassword, err.Error())
 	}
 
-	if err := repo.addIgnoreFolder(ctx, path.Join(pgDataLocation, tablespacesFolder)); err != nil {
+	return err
+}
+
+func (repo *Repository) initializeRepository(ctx context.Context) error {
+	args := []string{"repository", "create"}
+	args = append(args, repo.location.kopiaStorageArgs()...)
+	args = append(args, repo.format.kopiaCreateArgs()...)
+	args = append(args,
+		fmt.Sprintf("--cache-directory=%s", repo.cacheDirectory),
+		"--no-persist-credentials")
+
+	if _, err := repo.runKopia(ctx, args...); err != nil {
 		return err
 	}
 
+	return repo.configureIgnoreFolders(ctx)
+}
+
+func (repo *Repository) connectRepository(ctx context.Context) error {
+	args := []string{"repository", "connect"}
+	args = append(args, repo.location.kopiaStorageArgs()...)
+	args = append(args,
+		fmt.Sprintf("--cache-directory=%s", repo.cacheDirectory),
+		"--no-persist-credentials")
+
+	// Connecting opens the repository, and this validates the password
+	_, err := repo.runKopia(ctx, args...)
+	return err
+}
+
+// validatePassword checks that the repository can be opened
+// with the current password
+func (repo *Repository) validatePassword(ctx context.Context) error {
+	_, err := repo.runKopia(ctx, "repository", "status")
+	return err
+}
+
+func (repo *Repository) configureIgnoreFolders(ctx context.Context) error {
+	for _, folder := range ignoredFolders {
+		if err := repo.addIgnoreFolder(ctx, folder); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (repo *Repository) setCompression(ctx context.Context) error {
+	_, err := repo.runKopia(
+		ctx,
+		"policy", "set", "--global",
+		fmt.Sprintf("--compression=%s", compressors[repo.format.Compression]))
+	return err
+}
+
 func (repo *Repository) addIgnoreFolder(ctx context.Context, folder string) error {
-	logger := logging.FromContext(ctx)
+	_, err := repo.runKopia(ctx, "policy", "set", folder, "--add-ignore=.")
+	return err
+}
+
+// snapshotBackupName is the tag recording the name of
+// the backup a snapshot belongs to
+const snapshotBackupName = "backup"
+
+// kopiaTagPrefix is the prefix Kopia adds to the
+// name of the tags stored in the snapshot manifests
+const kopiaTagPrefix = "tag:"
+
+// snapshotManifest is the part of the manifest of a
+// Kopia snapshot used by the plugin
+type snapshotManifest struct {
+	// ID is the ID of the snapshot
+	ID string `json:"id"`
+
+	// Tags are the tags of the snapshot
+	Tags map[string]string `json:"tags,omitempty"`
+
+	Stats struct {
+		// TotalSize is the size of the files in the snapshot
+		TotalSize int64 `json:"totalSize"`
+	} `json:"stats"`
+}
+
+// takeSnapshot takes a Kopia snapshot of a certain path, adding a set of tags,
+// and returns the manifest of the snapshot.
+// The callback is invoked every time Kopia reports its progress
+func (repo *Repository) takeSnapshot(
+	ctx context.Context,
+	path string,
+	tags map[string]string,
+	onProgress func(SnapshotProgress),
+) (result *snapshotManifest, err error) {
+	ctx, span := tracing.Start(ctx, "kopia snapshot create", attribute.String("snapshot.path", path))
+	defer func() {
+		if result != nil {
+			span.SetAttributes(
+				attribute.String("snapshot.id", result.ID),
+				attribute.Int64("snapshot.size_bytes", result.Stats.TotalSize))
+		}
+		tracing.End(span, err)
+	}()
 
 	args := []string{
-		"kopia",
-		"policy",
-		"set",
-		folder,
-		fmt.Sprintf("--log-dir=%s/log", repo.cacheDirectory),
-		"--add-ignore=.",
-		fmt.Sprintf("--config-file=%s", repo.configFile),
+		"snapshot", "create", path,
+		"--json",
+		"--progress",
+		fmt.Sprintf("--progress-update-interval=%s", kopiaProgressUpdateInterval),
+	}
+	args = append(args, repo.throttling.snapshotArgs()...)
+	for k, v := range tags {
+		args = append(args, fmt.Sprintf("--tags=%s:%v", k, v))
 	}
 
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // nolint:gosec
-	output, err := cmd.CombinedOutput()
+	output, err := repo.runKopiaWithProgress(ctx, onProgress, args...)
 	if err != nil {
-		logger.Error(
-			err,
-			"Error invoking kopia policy set command",
-			"args", args,
-			"output", string(output))
-		return err
+		return nil, err
 	}
 
-	return nil
+	var manifest snapshotManifest
+	if err := json.Unmarshal(output, &manifest); err != nil {
+		return nil, fmt.Errorf("while decoding the snapshot manifest: %w", err)
+	}
+
+	return &manifest, nil
 }
 
-// takeSnapshot takes a Kopia snapshot of a certain path, adding a set of tags
-func (repo *Repository) takeSnapshot(ctx context.Context, path string, tags map[string]string) error {
-	logger := logging.FromContext(ctx)
+// ListBackupSnapshots gets the IDs of the snapshots in the repository,
+// by the name of the backup they belong to. The snapshots that were not
+// taken by a backup are skipped
+func (repo *Repository) ListBackupSnapshots(ctx context.Context) (map[string][]string, error) {
+	output, err := repo.runKopia(ctx, "snapshot", "list", "--all", "--json")
+	if err != nil {
+		return nil, err
+	}
 
-	args := []string{
-		"kopia",
-		"snapshot",
-		"create",
-		fmt.Sprintf("--log-dir=%s/log", repo.cacheDirectory),
-		fmt.Sprintf("--config-file=%s", repo.configFile),
-		path,
+	return parseBackupSnapshots(output)
+}
+
+// parseBackupSnapshots groups the snapshots listed by
+// Kopia by the name of the backup they belong to
+func parseBackupSnapshots(output []byte) (map[string][]string, error) {
+	var manifests []snapshotManifest
+	if err := json.Unmarshal(output, &manifests); err != nil {
+		return nil, fmt.Errorf("while decoding the snapshot list: %w", err)
 	}
 
-	tagsOption := ""
-	for k, v := range tags {
-		if len(tagsOption) > 0 {
-			tagsOption += ","
+	result := make(map[string][]string)
+	for _, manifest := range manifests {
+		backupName := manifest.Tags[kopiaTagPrefix+snapshotBackupName]
+		if len(backupName) == 0 {
+			continue
 		}
-		tagsOption += fmt.Sprintf("%s:%v", k, v)
+		result[backupName] = append(result[backupName], manifest.ID)
 	}
 
-	if len(tagsOption) > 0 {
-		args = append(args, "--tags="+tagsOption)
-	}
+	return result, nil
+}
 
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // nolint:gosec
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		logger.Error(
-			err,
-			"Error invoking kopia snapshot create command",
-			"args", args,
-			"output", string(output))
-		return err
+// DeleteSnapshot deletes a snapshot given its ID
+func (repo *Repository) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	_, err := repo.runKopia(ctx, "snapshot", "delete", snapshotID, "--delete")
+	return err
+}
+
+// RestoreSnapshot restores the content of a snapshot into
+// the target directory
+func (repo *Repository) RestoreSnapshot(ctx context.Context, snapshotID string, targetDirectory string) error {
+	_, err := repo.runKopia(ctx, "snapshot", "restore", snapshotID, targetDirectory)
+	return err
+}
+
+// kopiaVerifyFilesPercent is the percentage of the files whose
+// content is read while verifying snapshots
+const kopiaVerifyFilesPercent = 10
+
+// VerifySnapshots checks that every object referenced by the passed
+// snapshots is present in the repository, reading the content of a
+// sample of the files to detect corruption
+func (repo *Repository) VerifySnapshots(ctx context.Context, snapshotIDs ...string) error {
+	args := []string{
+		"snapshot", "verify",
+		fmt.Sprintf("--verify-files-percent=%d", kopiaVerifyFilesPercent),
 	}
+	args = append(args, snapshotIDs...)
 
-	return nil
+	_, err := repo.runKopia(ctx, args...)
+	return err
 }
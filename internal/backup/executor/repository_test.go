@@ -0,0 +1,169 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestParseBackupSnapshots(t *testing.T) {
+	output := []byte(`[
+  {
+    "id": "k1a2b3",
+    "source": {"host": "cluster-example-1", "userName": "postgres", "path": "/var/lib/postgresql/data/pgdata"},
+    "startTime": "2024-02-01T10:00:00Z",
+    "tags": {"tag:backup": "backup-1", "tag:type": "base"}
+  },
+  {
+    "id": "k4d5e6",
+    "source": {"host": "cluster-example-1", "userName": "postgres", "path": "/var/lib/postgresql/tablespaces/tbs1"},
+    "startTime": "2024-02-01T10:00:00Z",
+    "tags": {"tag:backup": "backup-1", "tag:oid": "16385", "tag:type": "tablespace"}
+  },
+  {
+    "id": "k7f8a9",
+    "source": {"host": "cluster-example-1", "userName": "postgres", "path": "/var/lib/postgresql/data/pgdata"},
+    "startTime": "2024-02-02T10:00:00Z",
+    "tags": {"tag:backup": "backup-2", "tag:type": "base"}
+  },
+  {
+    "id": "kb0c1d",
+    "source": {"host": "cluster-example-1", "userName": "postgres", "path": "/tmp"},
+    "startTime": "2024-02-02T11:00:00Z"
+  }
+]`)
+
+	result, err := parseBackupSnapshots(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"backup-1": {"k1a2b3", "k4d5e6"},
+		"backup-2": {"k7f8a9"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseBackupSnapshotsInvalid(t *testing.T) {
+	if _, err := parseBackupSnapshots([]byte("Repository not connected")); err == nil {
+		t.Error("expected an error parsing an invalid snapshot list")
+	}
+}
+
+func TestReadRepositoryPasswords(t *testing.T) {
+	directory := t.TempDir()
+	for key, value := range map[string]string{"password": "current", "new-password": "rotated"} {
+		if err := os.WriteFile(path.Join(directory, key), []byte(value), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		secretKey    string
+		newSecretKey string
+		expected     RepositoryPasswords
+		expectError  bool
+	}{
+		{
+			name:      "no rotation",
+			secretKey: "password",
+			expected:  RepositoryPasswords{Current: "current"},
+		},
+		{
+			name:         "rotation",
+			secretKey:    "password",
+			newSecretKey: "new-password",
+			expected:     RepositoryPasswords{Current: "current", New: "rotated"},
+		},
+		{
+			name:        "missing key",
+			secretKey:   "missing",
+			expectError: true,
+		},
+		{
+			name:         "new key not mounted yet",
+			secretKey:    "password",
+			newSecretKey: "missing",
+			expectError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			passwords, err := readRepositoryPasswords(directory, test.secretKey, test.newSecretKey)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", passwords)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if passwords != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, passwords)
+			}
+		})
+	}
+}
+
+func TestCheckRepositorySecret(t *testing.T) {
+	directory := t.TempDir()
+	if err := checkRepositorySecret(path.Join(directory, "missing")); err == nil {
+		t.Errorf("expected an error when the Secret is not mounted")
+	}
+	if err := checkRepositorySecret(directory); err == nil {
+		t.Errorf("expected an error when the Secret is empty")
+	}
+
+	if err := os.WriteFile(path.Join(directory, "password"), []byte("current"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRepositorySecret(directory); err != nil {
+		t.Errorf("expected the mounted Secret to pass the check, got %v", err)
+	}
+}
+
+func TestCheckKopia(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      string
+		expectError bool
+	}{
+		{
+			name:   "kopia runs",
+			script: "#!/bin/sh\necho 0.17.0\n",
+		},
+		{
+			name:        "kopia fails",
+			script:      "#!/bin/sh\necho broken >&2\nexit 1\n",
+			expectError: true,
+		},
+		{
+			name:        "kopia is missing",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			if len(test.script) > 0 {
+				if err := os.WriteFile(path.Join(directory, "kopia"), []byte(test.script), 0o700); err != nil { // nolint:gosec
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("PATH", directory)
+
+			if err := CheckKopia(context.Background()); (err != nil) != test.expectError {
+				t.Errorf("expected error: %v, got %v", test.expectError, err)
+			}
+		})
+	}
+}
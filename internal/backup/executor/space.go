@@ -0,0 +1,306 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/metrics"
+)
+
+// spaceHistorySize is the number of backups whose written space
+// is used to estimate the size of the next one
+const spaceHistorySize = 5
+
+// ErrInsufficientSpace is returned when there is not enough space
+// in the backup volume
+var ErrInsufficientSpace = errors.New("insufficient space in the backup volume")
+
+// SpaceThresholds are the percentages of usage of the backup volume
+// over which warnings are logged and backups are refused. WAL archiving
+// is never refused while the WAL file fits, as that would make pg_wal
+// grow on the primary
+type SpaceThresholds struct {
+	Warning  int
+	Critical int
+}
+
+// spaceLevel is how full the backup volume would be after writing some data
+type spaceLevel int
+
+const (
+	spaceLevelNormal spaceLevel = iota
+	spaceLevelWarning
+	spaceLevelCritical
+	spaceLevelFull
+)
+
+// getLevel gets how full the backup volume would be after writing
+// neededBytes, comparing the projected usage with the thresholds
+func (thresholds SpaceThresholds) getLevel(usage storage.VolumeUsage, neededBytes int64) spaceLevel {
+	projectedUsage := usage.UsedPercentage(neededBytes)
+	switch {
+	case neededBytes > usage.AvailableBytes:
+		return spaceLevelFull
+
+	case projectedUsage >= float64(thresholds.Critical):
+		return spaceLevelCritical
+
+	case projectedUsage >= float64(thresholds.Warning):
+		return spaceLevelWarning
+
+	default:
+		return spaceLevelNormal
+	}
+}
+
+// SpaceHistoryEntry is the space written by a backup
+type SpaceHistoryEntry struct {
+	// Time is when the backup was completed
+	Time time.Time `json:"time"`
+
+	// SourceBytes is the size of the data directory and of the tablespaces
+	SourceBytes int64 `json:"sourceBytes"`
+
+	// WrittenBytes is the space the backup used in the backup volume
+	WrittenBytes int64 `json:"writtenBytes"`
+}
+
+// SpaceHistory is the space written by the last backups of a cluster
+type SpaceHistory struct {
+	Backups []SpaceHistoryEntry `json:"backups"`
+}
+
+// estimate estimates the space a backup of sourceBytes will need, using
+// the deduplication ratio of the last backups. Without history we
+// expect the whole source to be written
+func (history *SpaceHistory) estimate(sourceBytes int64) int64 {
+	var totalSource, totalWritten int64
+	for _, entry := range history.Backups {
+		totalSource += entry.SourceBytes
+		totalWritten += entry.WrittenBytes
+	}
+
+	if totalSource == 0 {
+		return sourceBytes
+	}
+
+	return int64(float64(sourceBytes) * float64(totalWritten) / float64(totalSource))
+}
+
+func (history *SpaceHistory) add(entry SpaceHistoryEntry) {
+	history.Backups = append(history.Backups, entry)
+	if len(history.Backups) > spaceHistorySize {
+		history.Backups = history.Backups[len(history.Backups)-spaceHistorySize:]
+	}
+}
+
+// SpaceGuard checks that a backup fits in the backup volume before
+// it is started, and records the space it used once completed
+type SpaceGuard struct {
+	clusterName string
+	thresholds  SpaceThresholds
+	historyFile string
+
+	// sourceBytes and usedBytes are measured before the backup
+	sourceBytes int64
+	usedBytes   int64
+}
+
+// NewSpaceGuard creates a new SpaceGuard for the backups of a cluster
+func NewSpaceGuard(clusterName string, thresholds SpaceThresholds) *SpaceGuard {
+	return &SpaceGuard{
+		clusterName: clusterName,
+		thresholds:  thresholds,
+		historyFile: storage.GetSpaceHistoryFilePath(clusterName),
+	}
+}
+
+// CheckSpace estimates the space the backup will need from the size of
+// the data directory and of the tablespaces, and the deduplication
+// ratio of the last backups. The backup is refused when it would
+// make the backup volume usage cross the critical threshold
+func (executor *Executor) CheckSpace(ctx context.Context, guard *SpaceGuard) error {
+	contextLogger := logging.FromContext(ctx)
+
+	sourceBytes, err := executor.getSourceSize(ctx)
+	if err != nil {
+		return fmt.Errorf("while measuring the data to be backed up: %w", err)
+	}
+
+	history, err := guard.readHistory()
+	if err != nil {
+		return err
+	}
+
+	usage, err := storage.GetVolumeUsage()
+	if err != nil {
+		return fmt.Errorf("while reading the backup volume usage: %w", err)
+	}
+	metrics.SetBackupVolumeUsage(guard.clusterName, usage.TotalBytes, usage.AvailableBytes)
+
+	estimatedBytes := history.estimate(sourceBytes)
+	metrics.SetEstimatedBackupSize(guard.clusterName, estimatedBytes)
+
+	guard.sourceBytes = sourceBytes
+	guard.usedBytes = usage.UsedBytes
+
+	projectedUsage := usage.UsedPercentage(estimatedBytes)
+	contextLogger = contextLogger.WithValues(
+		"sourceBytes", sourceBytes,
+		"estimatedBytes", estimatedBytes,
+		"availableBytes", usage.AvailableBytes,
+		"projectedUsage", fmt.Sprintf("%.1f%%", projectedUsage),
+	)
+
+	switch guard.thresholds.getLevel(usage, estimatedBytes) {
+	case spaceLevelFull, spaceLevelCritical:
+		return fmt.Errorf(
+			"%w: the backup is estimated to need %d bytes, and would bring the volume usage to %.1f%%, "+
+				"over the critical threshold of %d%%",
+			ErrInsufficientSpace, estimatedBytes, projectedUsage, guard.thresholds.Critical)
+
+	case spaceLevelWarning:
+		contextLogger.Info(
+			"WARNING: the backup volume usage is over the warning threshold",
+			"warningThreshold", guard.thresholds.Warning)
+
+	default:
+		contextLogger.Info("Enough space in the backup volume")
+	}
+
+	return nil
+}
+
+// RecordBackup records the space used by the backup that was just
+// completed, to estimate the size of the next ones, and publishes
+// the space used by the cluster
+func (guard *SpaceGuard) RecordBackup(ctx context.Context) error {
+	usage, err := storage.GetVolumeUsage()
+	if err != nil {
+		return fmt.Errorf("while reading the backup volume usage: %w", err)
+	}
+	metrics.SetBackupVolumeUsage(guard.clusterName, usage.TotalBytes, usage.AvailableBytes)
+
+	clusterUsage, err := storage.GetClusterUsage(guard.clusterName)
+	if err != nil {
+		return fmt.Errorf("while measuring the space used by the cluster: %w", err)
+	}
+	metrics.SetBackupVolumeClusterUsage(guard.clusterName, clusterUsage)
+
+	// WAL files archived while the backup was running are counted
+	// too, which makes the estimate a bit more conservative
+	writtenBytes := max(usage.UsedBytes-guard.usedBytes, 0)
+
+	history, err := guard.readHistory()
+	if err != nil {
+		return err
+	}
+	history.add(SpaceHistoryEntry{
+		Time:         time.Now(),
+		SourceBytes:  guard.sourceBytes,
+		WrittenBytes: writtenBytes,
+	})
+
+	logging.FromContext(ctx).Info(
+		"Backup volume usage",
+		"writtenBytes", writtenBytes,
+		"clusterUsedBytes", clusterUsage,
+		"availableBytes", usage.AvailableBytes)
+
+	return guard.writeHistory(history)
+}
+
+func (guard *SpaceGuard) readHistory() (*SpaceHistory, error) {
+	var result SpaceHistory
+
+	data, err := os.ReadFile(guard.historyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return &result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("while decoding space history: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (guard *SpaceGuard) writeHistory(history *SpaceHistory) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	return fileutils.WriteFileAtomic(guard.historyFile, bytes.NewReader(data))
+}
+
+// getSourceSize gets the size of the data directory and of the
+// tablespaces, without the folders that are not backed up
+func (executor *Executor) getSourceSize(ctx context.Context) (int64, error) {
+	tablespaces, err := executor.getTablespaces(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := storage.GetDirectorySize(pgDataLocation, ignoredFolders...)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range tablespaces {
+		size, err := storage.GetDirectorySize(tablespaces[i].path)
+		if err != nil {
+			return 0, err
+		}
+		result += size
+	}
+
+	return result, nil
+}
+
+// CheckArchiveSpace checks that a WAL file of walSize bytes fits in the
+// backup volume. Archiving is refused only when the file doesn't fit,
+// while crossing the thresholds is just reported
+func CheckArchiveSpace(ctx context.Context, clusterName string, thresholds SpaceThresholds, walSize int64) error {
+	contextLogger := logging.FromContext(ctx)
+
+	usage, err := storage.GetVolumeUsage()
+	if err != nil {
+		return fmt.Errorf("while reading the backup volume usage: %w", err)
+	}
+	metrics.SetBackupVolumeUsage(clusterName, usage.TotalBytes, usage.AvailableBytes)
+
+	projectedUsage := usage.UsedPercentage(walSize)
+	switch thresholds.getLevel(usage, walSize) {
+	case spaceLevelFull:
+		return fmt.Errorf(
+			"%w: the WAL file needs %d bytes, but only %d are available",
+			ErrInsufficientSpace, walSize, usage.AvailableBytes)
+
+	case spaceLevelCritical:
+		contextLogger.Info(
+			"WARNING: the backup volume usage is over the critical threshold, base backups will be refused",
+			"usage", fmt.Sprintf("%.1f%%", projectedUsage),
+			"criticalThreshold", thresholds.Critical)
+
+	case spaceLevelWarning:
+		contextLogger.Info(
+			"WARNING: the backup volume usage is over the warning threshold",
+			"usage", fmt.Sprintf("%.1f%%", projectedUsage),
+			"warningThreshold", thresholds.Warning)
+	}
+
+	return nil
+}
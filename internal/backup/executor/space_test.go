@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+func TestSpaceHistoryEstimate(t *testing.T) {
+	var history SpaceHistory
+	if estimate := history.estimate(1000); estimate != 1000 {
+		t.Errorf("expected the whole source without history, got %d", estimate)
+	}
+
+	// The backups wrote 30% of their source on average
+	history.add(SpaceHistoryEntry{SourceBytes: 1000, WrittenBytes: 100})
+	history.add(SpaceHistoryEntry{SourceBytes: 1000, WrittenBytes: 500})
+	if estimate := history.estimate(2000); estimate != 600 {
+		t.Errorf("expected the deduplication ratio to be applied, got %d", estimate)
+	}
+}
+
+func TestSpaceHistoryKeepsLastBackups(t *testing.T) {
+	var history SpaceHistory
+	for i := 0; i < spaceHistorySize+2; i++ {
+		history.add(SpaceHistoryEntry{SourceBytes: int64(i + 1), WrittenBytes: 1})
+	}
+
+	if len(history.Backups) != spaceHistorySize {
+		t.Fatalf("expected %d backups in the history, got %d", spaceHistorySize, len(history.Backups))
+	}
+	if history.Backups[0].SourceBytes != 3 {
+		t.Errorf("expected the oldest backups to be dropped, got %+v", history.Backups[0])
+	}
+}
+
+func TestSpaceThresholdsGetLevel(t *testing.T) {
+	thresholds := SpaceThresholds{Warning: 80, Critical: 95}
+	usage := storage.VolumeUsage{TotalBytes: 1000, UsedBytes: 500, AvailableBytes: 500}
+
+	tests := []struct {
+		name        string
+		neededBytes int64
+		expected    spaceLevel
+	}{
+		{name: "below the warning threshold", neededBytes: 200, expected: spaceLevelNormal},
+		{name: "on the warning threshold", neededBytes: 300, expected: spaceLevelWarning},
+		{name: "on the critical threshold", neededBytes: 450, expected: spaceLevelCritical},
+		{name: "filling the volume", neededBytes: 500, expected: spaceLevelCritical},
+		{name: "not fitting", neededBytes: 501, expected: spaceLevelFull},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if level := thresholds.getLevel(usage, test.neededBytes); level != test.expected {
+				t.Errorf("expected level %d, got %d", test.expected, level)
+			}
+		})
+	}
+}
+
+func TestSpaceGuardHistory(t *testing.T) {
+	guard := &SpaceGuard{historyFile: filepath.Join(t.TempDir(), "space-history.json")}
+
+	history, err := guard.readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Backups) != 0 {
+		t.Fatalf("expected an empty history, got %+v", history)
+	}
+
+	history.add(SpaceHistoryEntry{Time: time.Now(), SourceBytes: 1000, WrittenBytes: 200})
+	if err := guard.writeHistory(history); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = guard.readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate := history.estimate(500); estimate != 100 {
+		t.Errorf("expected the stored history to be used, got an estimate of %d", estimate)
+	}
+}
@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// kopiaUnlimitedThrottle is the value removing a Kopia throttling limit
+const kopiaUnlimitedThrottle = "unlimited"
+
+// Throttling contains the limits applied while taking a backup.
+// Zero values mean no limit. Kopia reads the PostgreSQL volumes itself
+// and can't cap the read throughput, so only the upload throughput and
+// the parallelism can be limited
+type Throttling struct {
+	// UploadBytesPerSecond is the maximum number of bytes
+	// per second written into the repository
+	UploadBytesPerSecond int64
+
+	// Parallelism is the number of files hashed and
+	// uploaded in parallel by each snapshot
+	Parallelism int
+}
+
+// snapshotArgs gets the flags to be passed to "kopia snapshot create"
+func (throttling Throttling) snapshotArgs() []string {
+	if throttling.Parallelism == 0 {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("--parallel=%d", throttling.Parallelism)}
+}
+
+// applyThrottling configures the upload limit of the repository. The
+// limit is stored in the Kopia configuration, so we always set it to
+// remove a limit that is not configured anymore
+func (repo *Repository) applyThrottling(ctx context.Context) error {
+	uploadLimit := kopiaUnlimitedThrottle
+	if repo.throttling.UploadBytesPerSecond > 0 {
+		uploadLimit = strconv.FormatInt(repo.throttling.UploadBytesPerSecond, 10)
+	}
+
+	_, err := repo.runKopia(
+		ctx,
+		"repository", "throttle", "set",
+		fmt.Sprintf("--upload-bytes-per-second=%s", uploadLimit),
+	)
+	return err
+}
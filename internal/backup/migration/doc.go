@@ -0,0 +1,3 @@
+// Package migration moves the backups of a cluster from a previous
+// backup PVC to a new one, without recreating the cluster
+package migration
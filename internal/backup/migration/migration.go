@@ -0,0 +1,351 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/lock"
+)
+
+// lockStaleTimeout is the time after which the lock of a migration
+// that was not refreshed is considered abandoned
+const lockStaleTimeout = 5 * time.Minute
+
+// Phase is the phase of a migration
+type Phase string
+
+const (
+	// PhaseCopyingWALs is set while the WAL files are copied
+	// from the previous PVC
+	PhaseCopyingWALs Phase = "CopyingWALs"
+
+	// PhaseTakingBackup is set once the WAL files have been copied,
+	// until a base backup on the new PVC is taken and verified
+	PhaseTakingBackup Phase = "TakingBackup"
+
+	// PhaseFailed is set when the base backup could not be verified.
+	// The migration is retried by the next backup
+	PhaseFailed Phase = "Failed"
+
+	// PhaseCompleted is set once the new PVC contains every WAL file
+	// of the previous one and a verified base backup
+	PhaseCompleted Phase = "Completed"
+)
+
+// Status is the progress of the migration from the previous backup
+// PVC, recorded in the new one
+type Status struct {
+	// PreviousPVCName is the name of the PVC the backups are migrated from
+	PreviousPVCName string `json:"previousPVCName"`
+
+	// Phase is the current phase of the migration
+	Phase Phase `json:"phase"`
+
+	// StartedAt is the time when the migration was started
+	StartedAt time.Time `json:"startedAt"`
+
+	// CompletedAt is the time when the migration was completed
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+
+	// CopiedWALs is the number of WAL files copied from the previous PVC
+	CopiedWALs int `json:"copiedWALs"`
+
+	// BackupName is the name of the base backup taken on the new PVC
+	BackupName string `json:"backupName,omitempty"`
+
+	// Error is the error that made the migration fail, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Migration moves the backups of a cluster from the previous backup PVC.
+// The WAL files are copied, while the Kopia repository is initialized
+// again on the new PVC and a fresh base backup is taken. Until the
+// migration is completed, the WAL files are archived in both PVCs, so
+// that the previous one stays usable if the copy can't be verified.
+// The backups taken before the migration stay in the previous PVC,
+// that can be used for restores
+type Migration struct {
+	clusterName     string
+	previousPVCName string
+	previous        storage.Backend
+	current         storage.Backend
+	statusFile      string
+	lockFile        string
+}
+
+// New creates a new Migration of the backups of a cluster
+// from the previous PVC to the current one
+func New(
+	clusterName string,
+	previousPVCName string,
+	previous storage.Backend,
+	current storage.Backend,
+) *Migration {
+	return &Migration{
+		clusterName:     clusterName,
+		previousPVCName: previousPVCName,
+		previous:        previous,
+		current:         current,
+		statusFile:      storage.GetMigrationStatusFilePath(clusterName),
+		lockFile:        storage.GetMigrationLockFilePath(clusterName),
+	}
+}
+
+// IsCompleted checks whether the migration of the backups of
+// a cluster from the passed previous PVC has been completed
+func IsCompleted(clusterName string, previousPVCName string) (bool, error) {
+	status, err := readStatus(storage.GetMigrationStatusFilePath(clusterName))
+	if err != nil {
+		return false, err
+	}
+
+	return status.PreviousPVCName == previousPVCName && status.Phase == PhaseCompleted, nil
+}
+
+// CanComplete checks whether the WAL files have been copied from the
+// previous PVC, so that the backup being taken can complete the migration
+func (migration *Migration) CanComplete() (bool, error) {
+	status, err := migration.readStatus()
+	if err != nil {
+		return false, err
+	}
+
+	return status.PreviousPVCName == migration.previousPVCName && status.Phase == PhaseTakingBackup, nil
+}
+
+// CopyWALs copies the WAL files from the previous PVC, unless they have
+// already been copied. When another instance is already copying them,
+// nothing is done
+func (migration *Migration) CopyWALs(ctx context.Context) error {
+	contextLogger := logging.FromContext(ctx).WithValues("previousPVCName", migration.previousPVCName)
+
+	migrationLock, err := migration.acquireLock(ctx)
+	if errors.Is(err, lock.ErrLocked) {
+		contextLogger.Info("Skipping the WAL files copy, another instance is migrating them", "reason", err.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := migrationLock.Release(); err != nil {
+			contextLogger.Error(err, "Error while releasing migration lock")
+		}
+	}()
+
+	status, err := migration.readStatus()
+	if err != nil {
+		return err
+	}
+
+	if status.PreviousPVCName == migration.previousPVCName &&
+		(status.Phase == PhaseCompleted || status.Phase == PhaseTakingBackup) {
+		return nil
+	}
+
+	if status.PreviousPVCName != migration.previousPVCName {
+		status = &Status{
+			PreviousPVCName: migration.previousPVCName,
+			StartedAt:       time.Now(),
+		}
+	}
+
+	contextLogger.Info("Migrating the backups from the previous PVC")
+	status.Phase = PhaseCopyingWALs
+	status.Error = ""
+	if err := migration.writeStatus(status); err != nil {
+		return err
+	}
+
+	copied, err := migration.copyWALs(ctx)
+	if err != nil {
+		return migration.fail(status, fmt.Errorf("while copying the WAL files: %w", err))
+	}
+	contextLogger.Info("WAL files copied from the previous PVC", "copiedWALs", copied)
+
+	status.CopiedWALs += copied
+	status.Phase = PhaseTakingBackup
+	return migration.writeStatus(status)
+}
+
+// Complete verifies that the new PVC contains every WAL file of the
+// previous one, and that the base backup just taken can be read, before
+// marking the migration as completed. The passed function verifies the
+// base backup. When another instance is copying the WAL files,
+// lock.ErrLocked is returned
+func (migration *Migration) Complete(
+	ctx context.Context,
+	backupName string,
+	verifyBackup func(context.Context) error,
+) error {
+	migrationLock, err := migration.acquireLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := migrationLock.Release(); err != nil {
+			logging.FromContext(ctx).Error(err, "Error while releasing migration lock")
+		}
+	}()
+
+	status, err := migration.readStatus()
+	if err != nil {
+		return err
+	}
+
+	// The WAL files may have been copied again, or the migration
+	// completed, by another instance since the backup was started
+	if status.PreviousPVCName != migration.previousPVCName || status.Phase != PhaseTakingBackup {
+		return nil
+	}
+	status.BackupName = backupName
+
+	if err := migration.verifyWALs(ctx); err != nil {
+		return migration.fail(status, err)
+	}
+
+	if err := verifyBackup(ctx); err != nil {
+		return migration.fail(status, fmt.Errorf("while verifying backup %s: %w", backupName, err))
+	}
+
+	completedAt := time.Now()
+	status.Phase = PhaseCompleted
+	status.CompletedAt = &completedAt
+	status.Error = ""
+	if err := migration.writeStatus(status); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info(
+		"Migration from the previous PVC completed, the previous PVC can be detached",
+		"previousPVCName", migration.previousPVCName,
+		"backupName", backupName)
+	return nil
+}
+
+// copyWALs copies the WAL files that are not already in the
+// current PVC, and returns how many were copied
+func (migration *Migration) copyWALs(ctx context.Context) (int, error) {
+	objects, err := migration.previous.List(ctx, storage.GetWALPrefixKey(migration.clusterName))
+	if err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for _, object := range objects {
+		current, err := migration.current.Stat(ctx, object.Key)
+		if err == nil && current.Size == object.Size {
+			continue
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return copied, err
+		}
+
+		if err := migration.copyObject(ctx, object); err != nil {
+			return copied, fmt.Errorf("while copying %s: %w", object.Key, err)
+		}
+		copied++
+	}
+
+	return copied, nil
+}
+
+func (migration *Migration) copyObject(ctx context.Context, object storage.ObjectInfo) error {
+	content, err := migration.previous.Get(ctx, object.Key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	return migration.current.Put(ctx, object.Key, content, object.Size)
+}
+
+// verifyWALs checks that every WAL file of the previous
+// PVC has been copied to the current one
+func (migration *Migration) verifyWALs(ctx context.Context) error {
+	objects, err := migration.previous.List(ctx, storage.GetWALPrefixKey(migration.clusterName))
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		current, err := migration.current.Stat(ctx, object.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("WAL file %s has not been copied from the previous PVC", object.Key)
+		}
+		if err != nil {
+			return err
+		}
+		if current.Size != object.Size {
+			return fmt.Errorf(
+				"WAL file %s has a size of %d bytes, while it's %d bytes in the previous PVC",
+				object.Key, current.Size, object.Size)
+		}
+	}
+
+	return nil
+}
+
+// fail records the error that made the migration fail
+func (migration *Migration) fail(status *Status, err error) error {
+	status.Phase = PhaseFailed
+	status.Error = err.Error()
+	if writeErr := migration.writeStatus(status); writeErr != nil {
+		return errors.Join(err, writeErr)
+	}
+
+	return err
+}
+
+// acquireLock prevents other instances from copying the WAL
+// files, or completing the migration, concurrently
+func (migration *Migration) acquireLock(ctx context.Context) (*lock.Lock, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return lock.Acquire(ctx, migration.lockFile, hostname, lockStaleTimeout)
+}
+
+func (migration *Migration) readStatus() (*Status, error) {
+	return readStatus(migration.statusFile)
+}
+
+func readStatus(statusFile string) (*Status, error) {
+	var result Status
+
+	data, err := os.ReadFile(statusFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return &result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("while decoding migration status: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (migration *Migration) writeStatus(status *Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return fileutils.WriteFileAtomic(migration.statusFile, bytes.NewReader(data))
+}
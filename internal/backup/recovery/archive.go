@@ -0,0 +1,129 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+const (
+	// walSegmentNameLength is the length of the name of a WAL segment,
+	// made of the timeline, the log and the segment numbers
+	walSegmentNameLength = 24
+
+	// walLogSize is the number of bytes of WAL in a log
+	walLogSize = int64(1) << 32
+
+	minWALSegmentSize = int64(1) << 20
+	maxWALSegmentSize = int64(1) << 30
+)
+
+// walArchive is the content of the WAL archive of a cluster
+type walArchive struct {
+	// files are the archived WAL files, indexed by name
+	files map[string]storage.ObjectInfo
+
+	// segmentSize is the size of the WAL segments
+	segmentSize int64
+
+	// latestTimeline is the most recent timeline in the archive
+	latestTimeline uint32
+}
+
+// loadWALArchive lists the WAL files archived for a cluster
+func loadWALArchive(ctx context.Context, backend storage.Backend, clusterName string) (*walArchive, error) {
+	walObjects, err := backend.List(ctx, storage.GetWALPrefixKey(clusterName))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &walArchive{
+		files:          make(map[string]storage.ObjectInfo, len(walObjects)),
+		latestTimeline: 1,
+	}
+	for _, object := range walObjects {
+		walName := path.Base(object.Key)
+		result.files[walName] = object
+
+		timeline, err := parseTimeline(walName)
+		if err != nil {
+			continue
+		}
+		result.latestTimeline = max(result.latestTimeline, timeline)
+
+		// The WAL files are archived as they are, so the size
+		// of every complete segment is the configured one
+		if isWALSegment(walName) && result.segmentSize == 0 {
+			result.segmentSize = object.Size
+		}
+	}
+
+	if result.segmentSize == 0 {
+		return nil, fmt.Errorf("%w: no WAL segment is in the archive", ErrWALGap)
+	}
+	if result.segmentSize < minWALSegmentSize || result.segmentSize > maxWALSegmentSize ||
+		result.segmentSize&(result.segmentSize-1) != 0 {
+		return nil, fmt.Errorf("cannot detect the WAL segment size, found a segment of %d bytes", result.segmentSize)
+	}
+
+	return result, nil
+}
+
+// isWALSegment checks if a file name is the one of a complete WAL segment,
+// and not the one of a history, backup or partial file
+func isWALSegment(walName string) bool {
+	return len(walName) == walSegmentNameLength && strings.Trim(walName, "0123456789ABCDEF") == ""
+}
+
+// parseTimeline gets the timeline of a WAL or history file
+func parseTimeline(walName string) (uint32, error) {
+	if len(walName) < 8 {
+		return 0, fmt.Errorf("invalid WAL file name: %s", walName)
+	}
+
+	timeline, err := strconv.ParseUint(walName[0:8], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid WAL file name %s: %w", walName, err)
+	}
+
+	return uint32(timeline), nil
+}
+
+// getSegmentNumber gets the position of a WAL segment in the WAL
+// stream, regardless of its timeline
+func (archive *walArchive) getSegmentNumber(walName string) (int64, error) {
+	if !isWALSegment(walName) {
+		return 0, fmt.Errorf("invalid WAL segment name: %s", walName)
+	}
+
+	logNumber, err := strconv.ParseInt(walName[8:16], 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	segmentNumber, err := strconv.ParseInt(walName[16:24], 16, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return logNumber*archive.segmentsPerLog() + segmentNumber, nil
+}
+
+// getWALName gets the name of a WAL segment given its
+// timeline and its position in the WAL stream
+func (archive *walArchive) getWALName(timeline uint32, segmentNumber int64) string {
+	return fmt.Sprintf(
+		"%08X%08X%08X",
+		timeline,
+		segmentNumber/archive.segmentsPerLog(),
+		segmentNumber%archive.segmentsPerLog(),
+	)
+}
+
+// segmentsPerLog is the number of WAL segments in a log
+func (archive *walArchive) segmentsPerLog() int64 {
+	return walLogSize / archive.segmentSize
+}
@@ -0,0 +1,4 @@
+// Package recovery plans the recovery of a cluster to a target,
+// selecting the base backup to be restored and checking that the
+// WAL archive contains every WAL file needed to reach the target
+package recovery
@@ -0,0 +1,373 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/postgres"
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/utils"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+const (
+	timelineLatest  = "latest"
+	timelineCurrent = "current"
+)
+
+var (
+	// ErrNoBackup is returned when no backup in the catalog
+	// ends before the recovery target
+	ErrNoBackup = errors.New("no backup can be used to reach the recovery target")
+
+	// ErrTimelineUnreachable is returned when the target timeline
+	// doesn't descend from the timeline of the backups
+	ErrTimelineUnreachable = errors.New("the recovery target timeline is not reachable")
+
+	// ErrWALGap is returned when a WAL file needed to reach
+	// the recovery target is missing from the archive
+	ErrWALGap = errors.New("the WAL archive has a gap")
+
+	// ErrTargetUnreachable is returned when the archived WAL files
+	// don't reach the recovery target
+	ErrTargetUnreachable = errors.New("the recovery target is not reachable with the archived WAL files")
+)
+
+// Plan is the way a cluster is recovered to a target
+type Plan struct {
+	// Backup is the backup to be restored
+	Backup *catalog.Entry
+
+	// Timeline is the timeline followed while replaying the WAL files
+	Timeline uint32
+
+	// FirstWal is the first WAL file to be replayed
+	FirstWal string
+
+	// LastWal is the last WAL file to be replayed. When the target is
+	// a time, a transaction ID or a restore point, this is the most recent
+	// WAL file in the archive, as the position of the target is not known.
+	// Without a target, this is the last WAL file before the first one
+	// missing after the end of the backup, where the replay stops
+	LastWal string
+}
+
+// target is a parsed recovery target
+type target struct {
+	backupName string
+	time       *time.Time
+	lsn        *int64
+	immediate  bool
+	timeline   string
+
+	// unknownPosition is true when the target is a transaction
+	// ID or a restore point, whose position is not known
+	unknownPosition bool
+}
+
+// parseTarget parses a recovery target, checking that no more
+// than one target is set
+func parseTarget(recoveryTarget *apiv1.RecoveryTarget) (*target, error) {
+	result := &target{timeline: timelineLatest}
+	if recoveryTarget == nil {
+		return result, nil
+	}
+
+	var count int
+	for _, value := range []string{
+		recoveryTarget.TargetTime,
+		recoveryTarget.TargetLSN,
+		recoveryTarget.TargetXID,
+		recoveryTarget.TargetName,
+	} {
+		if len(value) > 0 {
+			count++
+		}
+	}
+	if recoveryTarget.TargetImmediate != nil && *recoveryTarget.TargetImmediate {
+		result.immediate = true
+		count++
+	}
+	if count > 1 {
+		return nil, errors.New("only one of the recovery targets can be set")
+	}
+
+	result.backupName = recoveryTarget.BackupID
+	result.unknownPosition = len(recoveryTarget.TargetXID) > 0 || len(recoveryTarget.TargetName) > 0
+	if len(recoveryTarget.TargetTLI) > 0 {
+		result.timeline = recoveryTarget.TargetTLI
+	}
+
+	if len(recoveryTarget.TargetTime) > 0 {
+		targetTime, err := utils.ParseTargetTime(nil, recoveryTarget.TargetTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recovery target time: %w", err)
+		}
+		result.time = &targetTime
+	}
+
+	if len(recoveryTarget.TargetLSN) > 0 {
+		targetLSN, err := postgres.LSN(recoveryTarget.TargetLSN).Parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid recovery target LSN: %w", err)
+		}
+		result.lsn = &targetLSN
+	}
+
+	return result, nil
+}
+
+// getTimeline gets the ID of the target timeline, given the one
+// where the backup was taken and the latest one in the archive
+func (target *target) getTimeline(backupTimeline uint32, latestTimeline uint32) (uint32, error) {
+	switch target.timeline {
+	case timelineLatest:
+		return latestTimeline, nil
+
+	case timelineCurrent:
+		return backupTimeline, nil
+
+	default:
+		timeline, err := strconv.ParseUint(target.timeline, 10, 32)
+		if err != nil || timeline == 0 {
+			return 0, fmt.Errorf("invalid recovery target timeline: %s", target.timeline)
+		}
+		return uint32(timeline), nil
+	}
+}
+
+// isSet checks if the recovery stops at a target, rather
+// than at the end of the archived WAL files
+func (target *target) isSet() bool {
+	return target.time != nil || target.lsn != nil || target.immediate || target.unknownPosition
+}
+
+// isAfter checks if the target comes after the end of a backup. The
+// targets whose position in the WAL stream is unknown, such as the
+// transaction IDs and the restore points, are considered to be after
+// the end of every backup
+func (target *target) isAfter(entry *catalog.Entry, endLSN int64) bool {
+	switch {
+	case target.time != nil:
+		return entry.StoppedAt.Before(*target.time)
+
+	case target.lsn != nil:
+		return endLSN < *target.lsn
+
+	default:
+		return true
+	}
+}
+
+// NewPlan selects the most recent backup ending before the recovery
+// target, on a timeline the target timeline descends from, and checks
+// that the WAL archive contains every WAL file from the beginning of the
+// backup to the target. Without a target, only the WAL files needed to
+// restore the backup are required, as the replay goes on as long as the
+// following ones are in the archive
+func NewPlan(
+	ctx context.Context,
+	backend storage.Backend,
+	clusterName string,
+	recoveryTarget *apiv1.RecoveryTarget,
+) (*Plan, error) {
+	target, err := parseTarget(recoveryTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := catalog.New(backend, clusterName).ListCompleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := loadWALArchive(ctx, backend, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	histories := make(map[uint32][]timelineSwitch)
+	getHistory := func(timeline uint32) ([]timelineSwitch, error) {
+		if history, ok := histories[timeline]; ok {
+			return history, nil
+		}
+		history, err := loadTimelineHistory(ctx, backend, clusterName, timeline)
+		if err != nil {
+			return nil, err
+		}
+		histories[timeline] = history
+		return history, nil
+	}
+
+	// The catalog lists the backups from the oldest to the newest
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := &entries[i]
+		if len(target.backupName) > 0 && entry.BackupName != target.backupName {
+			continue
+		}
+
+		backupTimeline, err := parseTimeline(entry.BeginWal)
+		if err != nil {
+			return nil, err
+		}
+		endLSN, err := postgres.LSN(entry.EndLSN).Parse()
+		if err != nil {
+			return nil, fmt.Errorf("while parsing the end LSN of backup %s: %w", entry.BackupName, err)
+		}
+
+		timeline, err := target.getTimeline(backupTimeline, archive.latestTimeline)
+		if err != nil {
+			return nil, err
+		}
+		history, err := getHistory(timeline)
+		if err != nil {
+			return nil, err
+		}
+
+		// The backup must have been completed before the
+		// timeline it was taken on was abandoned
+		onTimeline := slices.ContainsFunc(history, func(timelineEntry timelineSwitch) bool {
+			return timelineEntry.timeline == backupTimeline && timelineEntry.contains(endLSN)
+		})
+		if !onTimeline || !target.isAfter(entry, endLSN) {
+			continue
+		}
+
+		return newPlan(archive, target, entry, timeline, history)
+	}
+
+	if len(target.backupName) > 0 {
+		return nil, fmt.Errorf(
+			"%w: backup %s doesn't end before the target on a timeline the target timeline descends from",
+			ErrNoBackup, target.backupName)
+	}
+	return nil, ErrNoBackup
+}
+
+// CheckBackupWALs checks that the WAL archive contains every WAL
+// file from the beginning to the end of a backup, which are the ones
+// needed to restore it to a consistent state
+func CheckBackupWALs(
+	ctx context.Context,
+	backend storage.Backend,
+	clusterName string,
+	entry *catalog.Entry,
+) error {
+	archive, err := loadWALArchive(ctx, backend, clusterName)
+	if err != nil {
+		return err
+	}
+
+	// The backup may end on a timeline created while it was running
+	timeline, err := parseTimeline(entry.EndWal)
+	if err != nil {
+		return err
+	}
+	history, err := loadTimelineHistory(ctx, backend, clusterName, timeline)
+	if err != nil {
+		return err
+	}
+
+	_, err = newPlan(archive, &target{immediate: true, timeline: timelineCurrent}, entry, timeline, history)
+	return err
+}
+
+// newPlan checks that the WAL archive contains every WAL file
+// needed to recover a backup to the target
+func newPlan(
+	archive *walArchive,
+	target *target,
+	entry *catalog.Entry,
+	timeline uint32,
+	history []timelineSwitch,
+) (*Plan, error) {
+	firstSegment, err := archive.getSegmentNumber(entry.BeginWal)
+	if err != nil {
+		return nil, err
+	}
+	backupEndSegment, err := archive.getSegmentNumber(entry.EndWal)
+	if err != nil {
+		return nil, err
+	}
+
+	// PostgreSQL reads each WAL segment from the most recent timeline
+	// that was already created when the segment begins, so the segment
+	// where a timeline switch happened is read from the new timeline
+	getSegmentTimeline := func(segmentNumber int64) uint32 {
+		for i := len(history) - 1; i > 0; i-- {
+			if segmentNumber >= history[i].beginLSN/archive.segmentSize {
+				return history[i].timeline
+			}
+		}
+		return history[0].timeline
+	}
+
+	// The most recent segment in the archive that can be read
+	// following the target timeline
+	var archiveEndSegment int64
+	for walName := range archive.files {
+		segmentNumber, err := archive.getSegmentNumber(walName)
+		if err != nil {
+			continue
+		}
+		if walTimeline, _ := parseTimeline(walName); walTimeline == getSegmentTimeline(segmentNumber) {
+			archiveEndSegment = max(archiveEndSegment, segmentNumber)
+		}
+	}
+
+	var lastSegment int64
+	switch {
+	case target.lsn != nil:
+		lastSegment = *target.lsn / archive.segmentSize
+
+	case target.immediate:
+		lastSegment = backupEndSegment
+
+	default:
+		// The position of the target is not known, so every
+		// archived WAL file following the backup is needed
+		lastSegment = archiveEndSegment
+	}
+	lastSegment = max(lastSegment, backupEndSegment)
+
+	for segmentNumber := firstSegment; segmentNumber <= lastSegment; segmentNumber++ {
+		walName := archive.getWALName(getSegmentTimeline(segmentNumber), segmentNumber)
+		if _, ok := archive.files[walName]; ok {
+			continue
+		}
+
+		// Without a target, the replay ends at the first missing WAL
+		// file, which is fine once the backup is consistent
+		if !target.isSet() && segmentNumber > backupEndSegment {
+			lastSegment = segmentNumber - 1
+			break
+		}
+
+		if segmentNumber > archiveEndSegment && segmentNumber > backupEndSegment {
+			return nil, fmt.Errorf(
+				"%w: WAL file %s is missing, the archive ends before the target",
+				ErrTargetUnreachable, walName)
+		}
+		return nil, fmt.Errorf("%w: WAL file %s is missing", ErrWALGap, walName)
+	}
+
+	lastWal := archive.getWALName(getSegmentTimeline(lastSegment), lastSegment)
+	if target.time != nil && archive.files[lastWal].ModTime.Before(*target.time) {
+		return nil, fmt.Errorf(
+			"%w: the last WAL file %s was archived at %s, before the target time",
+			ErrTargetUnreachable, lastWal, archive.files[lastWal].ModTime.Format(time.RFC3339))
+	}
+
+	return &Plan{
+		Backup:   entry,
+		Timeline: timeline,
+		FirstWal: entry.BeginWal,
+		LastWal:  lastWal,
+	}, nil
+}
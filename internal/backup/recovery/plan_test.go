@@ -0,0 +1,399 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+const testClusterName = "cluster-example"
+
+func newTestArchive(t *testing.T, walNames ...string) storage.Backend {
+	t.Helper()
+
+	backend := storage.NewFilesystemBackend(t.TempDir())
+	segment := make([]byte, minWALSegmentSize)
+	for _, walName := range walNames {
+		err := backend.Put(
+			context.Background(),
+			storage.GetWALKey(testClusterName, walName),
+			bytes.NewReader(segment),
+			int64(len(segment)))
+		if err != nil {
+			t.Fatalf("while archiving WAL file %s: %v", walName, err)
+		}
+	}
+	return backend
+}
+
+func TestCheckBackupWALs(t *testing.T) {
+	entry := &catalog.Entry{
+		BackupName: "backup-example",
+		BeginWal:   "000000010000000000000002",
+		EndWal:     "000000010000000000000004",
+	}
+
+	backend := newTestArchive(t,
+		"000000010000000000000002",
+		"000000010000000000000003",
+		"000000010000000000000004")
+	if err := CheckBackupWALs(context.Background(), backend, testClusterName, entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	backend = newTestArchive(t,
+		"000000010000000000000002",
+		"000000010000000000000004")
+	err := CheckBackupWALs(context.Background(), backend, testClusterName, entry)
+	if !errors.Is(err, ErrWALGap) {
+		t.Fatalf("expected a WAL gap, got %v", err)
+	}
+}
+
+// testHistory is the history of timeline 2, created from
+// timeline 1 in the middle of segment 4
+const testHistory = "1\t0/480000\tno recovery target specified\n"
+
+// testPlanArchive is an archive where timeline 2 was created in the
+// middle of segment 4, while timeline 1 went on being archived
+type testPlanArchive struct {
+	walNames []string
+	history  string
+	backups  []catalog.Entry
+}
+
+func (archive testPlanArchive) create(t *testing.T) storage.Backend {
+	t.Helper()
+
+	ctx := context.Background()
+	backend := newTestArchive(t, archive.walNames...)
+	if len(archive.history) > 0 {
+		err := backend.Put(
+			ctx,
+			storage.GetWALKey(testClusterName, getHistoryFileName(2)),
+			bytes.NewReader([]byte(archive.history)),
+			int64(len(archive.history)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backupCatalog := catalog.New(backend, testClusterName)
+	for i := range archive.backups {
+		if err := backupCatalog.Put(ctx, &archive.backups[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return backend
+}
+
+// newTestBackup creates a completed backup of timeline 1 from the
+// beginning of a segment to the middle of another one
+func newTestBackup(name string, beginSegment, endSegment int) catalog.Entry {
+	startedAt := time.Date(2024, time.March, 1, beginSegment, 0, 0, 0, time.UTC)
+	return catalog.Entry{
+		BackupName: name,
+		StartedAt:  startedAt,
+		StoppedAt:  startedAt.Add(time.Minute),
+		BeginWal:   fmt.Sprintf("0000000100000000%08X", beginSegment),
+		EndWal:     fmt.Sprintf("0000000100000000%08X", endSegment),
+		BeginLSN:   fmt.Sprintf("0/%X", beginSegment<<20),
+		EndLSN:     fmt.Sprintf("0/%X", endSegment<<20+0x80000),
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	timeline1 := []string{
+		"000000010000000000000002",
+		"000000010000000000000003",
+		"000000010000000000000004",
+		"000000010000000000000005",
+	}
+	timeline2 := []string{
+		"000000020000000000000004",
+		"000000020000000000000005",
+	}
+	bothTimelines := append(slices.Clone(timeline1), timeline2...)
+
+	tests := []struct {
+		name             string
+		archive          testPlanArchive
+		target           *apiv1.RecoveryTarget
+		expectedBackup   string
+		expectedTimeline uint32
+		expectedLastWal  string
+		expectedError    error
+	}{
+		{
+			name: "without a target, the replay goes to the end of the archive",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			expectedBackup:   "backup",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000005",
+		},
+		{
+			name: "without a target, the replay stops at the first gap after the backup",
+			archive: testPlanArchive{
+				walNames: []string{
+					"000000010000000000000002",
+					"000000010000000000000003",
+					"000000010000000000000005",
+				},
+				backups: []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:           &apiv1.RecoveryTarget{BackupID: "backup"},
+			expectedBackup:   "backup",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000003",
+		},
+		{
+			name: "without a target, the WAL files of the backup are needed",
+			archive: testPlanArchive{
+				walNames: []string{"000000010000000000000002", "000000010000000000000004"},
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			expectedError: ErrWALGap,
+		},
+		{
+			name: "a gap before the target",
+			archive: testPlanArchive{
+				walNames: []string{
+					"000000010000000000000002",
+					"000000010000000000000003",
+					"000000010000000000000005",
+				},
+				backups: []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:        &apiv1.RecoveryTarget{TargetXID: "1234"},
+			expectedError: ErrWALGap,
+		},
+		{
+			name: "an LSN target",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:           &apiv1.RecoveryTarget{TargetLSN: "0/412345"},
+			expectedBackup:   "backup",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000004",
+		},
+		{
+			name: "an LSN target after the end of the archive",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:        &apiv1.RecoveryTarget{TargetLSN: "0/712345"},
+			expectedError: ErrTargetUnreachable,
+		},
+		{
+			name: "an immediate target only needs the backup",
+			archive: testPlanArchive{
+				walNames: []string{
+					"000000010000000000000002",
+					"000000010000000000000003",
+					"000000010000000000000005",
+				},
+				backups: []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:           &apiv1.RecoveryTarget{TargetImmediate: ptr(true)},
+			expectedBackup:   "backup",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000003",
+		},
+		{
+			name: "the most recent backup before the target is chosen",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups: []catalog.Entry{
+					newTestBackup("older", 2, 2),
+					newTestBackup("newer", 3, 3),
+				},
+			},
+			target:           &apiv1.RecoveryTarget{TargetLSN: "0/300000"},
+			expectedBackup:   "older",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000003",
+		},
+		{
+			name: "a backup chosen by name",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups: []catalog.Entry{
+					newTestBackup("older", 2, 2),
+					newTestBackup("newer", 3, 3),
+				},
+			},
+			target:           &apiv1.RecoveryTarget{BackupID: "older", TargetXID: "1234"},
+			expectedBackup:   "older",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000005",
+		},
+		{
+			name: "a backup name not in the catalog",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:        &apiv1.RecoveryTarget{BackupID: "missing"},
+			expectedError: ErrNoBackup,
+		},
+		{
+			name: "a target time",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:           &apiv1.RecoveryTarget{TargetTime: "2025-01-01T00:00:00Z"},
+			expectedBackup:   "backup",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000005",
+		},
+		{
+			name: "a target time before every backup",
+			archive: testPlanArchive{
+				walNames: timeline1,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:        &apiv1.RecoveryTarget{TargetTime: "2024-01-01T00:00:00Z"},
+			expectedError: ErrNoBackup,
+		},
+		{
+			name: "the segment where the promotion happened is read from the new timeline",
+			archive: testPlanArchive{
+				walNames: bothTimelines,
+				history:  testHistory,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:           &apiv1.RecoveryTarget{TargetXID: "1234"},
+			expectedBackup:   "backup",
+			expectedTimeline: 2,
+			expectedLastWal:  "000000020000000000000005",
+		},
+		{
+			name: "the segment where the promotion happened is missing from the new timeline",
+			archive: testPlanArchive{
+				walNames: append(slices.Clone(timeline1), "000000020000000000000005"),
+				history:  testHistory,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			target:        &apiv1.RecoveryTarget{TargetXID: "1234"},
+			expectedError: ErrWALGap,
+		},
+		{
+			name: "a backup on the abandoned timeline is skipped",
+			archive: testPlanArchive{
+				walNames: bothTimelines,
+				history:  testHistory,
+				backups: []catalog.Entry{
+					newTestBackup("before-promotion", 2, 3),
+					newTestBackup("abandoned", 4, 5),
+				},
+			},
+			expectedBackup:   "before-promotion",
+			expectedTimeline: 2,
+			expectedLastWal:  "000000020000000000000005",
+		},
+		{
+			name: "a backup on the abandoned timeline can't reach the latest timeline",
+			archive: testPlanArchive{
+				walNames: bothTimelines,
+				history:  testHistory,
+				backups:  []catalog.Entry{newTestBackup("abandoned", 4, 5)},
+			},
+			target:        &apiv1.RecoveryTarget{BackupID: "abandoned"},
+			expectedError: ErrNoBackup,
+		},
+		{
+			name: "a backup on the abandoned timeline is restored on its own timeline",
+			archive: testPlanArchive{
+				walNames: bothTimelines,
+				history:  testHistory,
+				backups:  []catalog.Entry{newTestBackup("abandoned", 4, 5)},
+			},
+			target:           &apiv1.RecoveryTarget{TargetTLI: "current"},
+			expectedBackup:   "abandoned",
+			expectedTimeline: 1,
+			expectedLastWal:  "000000010000000000000005",
+		},
+		{
+			name: "the history of the target timeline is missing",
+			archive: testPlanArchive{
+				walNames: bothTimelines,
+				backups:  []catalog.Entry{newTestBackup("backup", 2, 3)},
+			},
+			expectedError: ErrTimelineUnreachable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := test.archive.create(t)
+
+			plan, err := NewPlan(context.Background(), backend, testClusterName, test.target)
+			if test.expectedError != nil {
+				if !errors.Is(err, test.expectedError) {
+					t.Fatalf("expected %v, got %v (plan %+v)", test.expectedError, err, plan)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if plan.Backup.BackupName != test.expectedBackup {
+				t.Errorf("expected backup %s, got %s", test.expectedBackup, plan.Backup.BackupName)
+			}
+			if plan.Timeline != test.expectedTimeline {
+				t.Errorf("expected timeline %d, got %d", test.expectedTimeline, plan.Timeline)
+			}
+			if plan.FirstWal != plan.Backup.BeginWal {
+				t.Errorf("expected the replay to begin from %s, got %s", plan.Backup.BeginWal, plan.FirstWal)
+			}
+			if plan.LastWal != test.expectedLastWal {
+				t.Errorf("expected the replay to end at %s, got %s", test.expectedLastWal, plan.LastWal)
+			}
+		})
+	}
+}
+
+func TestParseTimelineHistory(t *testing.T) {
+	content := "1\t0/480000\tno recovery target specified\n\n" +
+		"2\t0/5000028\tbefore 2024-03-01 10:00:00+00\n"
+
+	history, err := parseTimelineHistory(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []timelineSwitch{
+		{timeline: 1, beginLSN: 0, endLSN: 0x480000},
+		{timeline: 2, beginLSN: 0x480000, endLSN: 0x5000028},
+	}
+	if !slices.Equal(history, expected) {
+		t.Errorf("expected %+v, got %+v", expected, history)
+	}
+
+	if _, err := parseTimelineHistory(strings.NewReader("1\n")); err == nil {
+		t.Error("expected an error for a line without the switch position")
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
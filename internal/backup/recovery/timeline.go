@@ -0,0 +1,122 @@
+package recovery
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/postgres"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+// historyFileSuffix is the suffix of the timeline history files
+const historyFileSuffix = ".history"
+
+// timelineSwitch is a timeline in the history of another one
+type timelineSwitch struct {
+	// timeline is the ID of the timeline
+	timeline uint32
+
+	// beginLSN is the position where the timeline was
+	// created, zero for the first timeline
+	beginLSN int64
+
+	// endLSN is the position where the next timeline was created,
+	// or -1 when this is the timeline being followed
+	endLSN int64
+}
+
+// contains checks if a position was generated on this timeline
+func (entry timelineSwitch) contains(lsn int64) bool {
+	return lsn >= entry.beginLSN && (entry.endLSN < 0 || lsn <= entry.endLSN)
+}
+
+// getHistoryFileName gets the name of the history file of a timeline
+func getHistoryFileName(timeline uint32) string {
+	return fmt.Sprintf("%08X%s", timeline, historyFileSuffix)
+}
+
+// loadTimelineHistory loads the timelines a timeline descends from,
+// from the oldest to the passed one. The first timeline has no
+// history file
+func loadTimelineHistory(
+	ctx context.Context,
+	backend storage.Backend,
+	clusterName string,
+	timeline uint32,
+) ([]timelineSwitch, error) {
+	if timeline == 1 {
+		return []timelineSwitch{{timeline: 1, endLSN: -1}}, nil
+	}
+
+	historyFileName := getHistoryFileName(timeline)
+	content, err := backend.Get(ctx, storage.GetWALKey(clusterName, historyFileName))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: the history file %s is not in the archive", ErrTimelineUnreachable, historyFileName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	result, err := parseTimelineHistory(content)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing the history file %s: %w", historyFileName, err)
+	}
+
+	var beginLSN int64
+	if len(result) > 0 {
+		beginLSN = result[len(result)-1].endLSN
+	}
+
+	return append(result, timelineSwitch{timeline: timeline, beginLSN: beginLSN, endLSN: -1}), nil
+}
+
+// parseTimelineHistory parses the content of a history file. Every line
+// contains the ID of a parent timeline, the position where the next
+// timeline was created and the reason of the switch
+func parseTimelineHistory(content io.Reader) ([]timelineSwitch, error) {
+	var result []timelineSwitch
+
+	scanner := bufio.NewScanner(content)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid line: %s", line)
+		}
+
+		timeline, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeline in line %q: %w", line, err)
+		}
+
+		endLSN, err := postgres.LSN(fields[1]).Parse()
+		if err != nil {
+			return nil, err
+		}
+
+		var beginLSN int64
+		if len(result) > 0 {
+			beginLSN = result[len(result)-1].endLSN
+		}
+		result = append(result, timelineSwitch{
+			timeline: uint32(timeline),
+			beginLSN: beginLSN,
+			endLSN:   endLSN,
+		})
+	}
+
+	return result, scanner.Err()
+}
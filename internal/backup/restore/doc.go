@@ -0,0 +1,4 @@
+// Package restore materializes a backup into a local directory,
+// ready to be started as a PostgreSQL instance replaying the
+// WAL archive, without the help of the operator
+package restore
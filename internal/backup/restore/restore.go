@@ -0,0 +1,304 @@
+package restore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+)
+
+const (
+	// dataDirectorySnapshotName is the name of the snapshot
+	// of the data directory in the catalog
+	dataDirectorySnapshotName = "PGDATA"
+
+	backupLabelFile    = "backup_label"
+	tablespaceMapFile  = "tablespace_map"
+	autoConfFile       = "postgresql.auto.conf"
+	recoverySignalFile = "recovery.signal"
+	tablespacesFolder  = "pg_tblspc"
+	walFolder          = "pg_wal"
+	postmasterPIDFile  = "postmaster.pid"
+	postmasterOptsFile = "postmaster.opts"
+	tablespacesSuffix  = "-tablespaces"
+	dataDirectoryMode  = 0o700
+	configurationMode  = 0o600
+)
+
+// ErrTargetNotEmpty is returned when a backup would be restored
+// into a directory that already contains some files
+var ErrTargetNotEmpty = errors.New("the target directory is not empty")
+
+// Options selects where a backup is restored
+type Options struct {
+	// TargetDirectory is the directory where the data directory is restored
+	TargetDirectory string
+
+	// TablespaceLocations maps the OID of a tablespace to the directory
+	// where it is restored. The tablespaces that are not mapped are
+	// restored in a directory named after their OID, inside the
+	// TargetDirectory + "-tablespaces" directory
+	TablespaceLocations map[string]string
+
+	// WALPath is the directory containing the WAL archive
+	// used by the restore_command
+	WALPath string
+
+	// RecoveryTarget is where the WAL replay stops, nil
+	// to replay every archived WAL file
+	RecoveryTarget *apiv1.RecoveryTarget
+}
+
+// getTablespaceLocation gets the directory where a tablespace is restored
+func (options Options) getTablespaceLocation(oid string) string {
+	if location, ok := options.TablespaceLocations[oid]; ok {
+		return location
+	}
+
+	return filepath.Join(filepath.Clean(options.TargetDirectory)+tablespacesSuffix, oid)
+}
+
+// Run restores a backup from the repository into the target directory.
+// Besides the content of the snapshots, the backup_label and tablespace_map
+// files are written, the pg_tblspc links are pointed to the restored
+// tablespaces and a recovery configuration reading the WAL archive
+// is added, so that PostgreSQL can be started on the restored directory
+func Run(ctx context.Context, repository *executor.Repository, entry *catalog.Entry, options Options) error {
+	contextLogger := logging.FromContext(ctx)
+
+	var dataDirectorySnapshot *catalog.Snapshot
+	tablespaceLocations := make(map[string]string)
+	for i := range entry.Snapshots {
+		snapshot := &entry.Snapshots[i]
+		if snapshot.Name == dataDirectorySnapshotName {
+			dataDirectorySnapshot = snapshot
+			continue
+		}
+		tablespaceLocations[snapshot.Name] = options.getTablespaceLocation(snapshot.Name)
+	}
+	if dataDirectorySnapshot == nil {
+		return fmt.Errorf("backup %s has no snapshot of the data directory", entry.BackupName)
+	}
+
+	// Nothing is restored unless every target is usable, as we
+	// don't want to mix the backup with existing files
+	if err := ensureEmptyDirectory(options.TargetDirectory); err != nil {
+		return err
+	}
+	for _, location := range tablespaceLocations {
+		if err := ensureEmptyDirectory(location); err != nil {
+			return err
+		}
+	}
+
+	contextLogger.Info("Restoring data directory",
+		"snapshotID", dataDirectorySnapshot.ID,
+		"targetDirectory", options.TargetDirectory)
+	if err := repository.RestoreSnapshot(ctx, dataDirectorySnapshot.ID, options.TargetDirectory); err != nil {
+		return fmt.Errorf("while restoring the data directory: %w", err)
+	}
+
+	for _, snapshot := range entry.Snapshots {
+		location, ok := tablespaceLocations[snapshot.Name]
+		if !ok {
+			continue
+		}
+
+		contextLogger.Info("Restoring tablespace",
+			"oid", snapshot.Name,
+			"snapshotID", snapshot.ID,
+			"targetDirectory", location)
+		if err := repository.RestoreSnapshot(ctx, snapshot.ID, location); err != nil {
+			return fmt.Errorf("while restoring tablespace %s: %w", snapshot.Name, err)
+		}
+	}
+
+	if err := prepareDataDirectory(options.TargetDirectory, tablespaceLocations); err != nil {
+		return err
+	}
+
+	if err := writeBackupFiles(options.TargetDirectory, entry, tablespaceLocations); err != nil {
+		return err
+	}
+
+	return writeRecoveryConfiguration(options.TargetDirectory, options.WALPath, options.RecoveryTarget)
+}
+
+// ensureEmptyDirectory creates a directory, checking that it
+// doesn't contain any file when it already exists
+func ensureEmptyDirectory(directory string) error {
+	entries, err := os.ReadDir(directory)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(directory, dataDirectoryMode)
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%w: %s", ErrTargetNotEmpty, directory)
+	}
+
+	return nil
+}
+
+// prepareDataDirectory removes the files of the running instance that
+// were snapshotted with the data directory, recreates the directories
+// whose content is excluded from the backups, and links the tablespaces
+// to their new location
+func prepareDataDirectory(targetDirectory string, tablespaceLocations map[string]string) error {
+	for _, name := range []string{postmasterPIDFile, postmasterOptsFile} {
+		if err := os.Remove(filepath.Join(targetDirectory, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	for _, name := range []string{walFolder, tablespacesFolder} {
+		if err := os.MkdirAll(filepath.Join(targetDirectory, name), dataDirectoryMode); err != nil {
+			return err
+		}
+	}
+
+	for oid, location := range tablespaceLocations {
+		absoluteLocation, err := filepath.Abs(location)
+		if err != nil {
+			return err
+		}
+
+		link := filepath.Join(targetDirectory, tablespacesFolder, oid)
+		if err := os.Remove(link); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.Symlink(absoluteLocation, link); err != nil {
+			return fmt.Errorf("while linking tablespace %s: %w", oid, err)
+		}
+	}
+
+	return nil
+}
+
+// writeBackupFiles writes the backup_label and the tablespace_map files
+// returned by PostgreSQL when the backup was stopped. The tablespace_map
+// is used by PostgreSQL to recreate the pg_tblspc links, so it is
+// rewritten to point to the new tablespace locations
+func writeBackupFiles(targetDirectory string, entry *catalog.Entry, tablespaceLocations map[string]string) error {
+	if len(entry.BackupLabelFile) == 0 {
+		return fmt.Errorf("backup %s has no backup_label file", entry.BackupName)
+	}
+	if err := writeFile(filepath.Join(targetDirectory, backupLabelFile), entry.BackupLabelFile); err != nil {
+		return err
+	}
+
+	if len(entry.TablespaceMapFile) == 0 {
+		return nil
+	}
+
+	tablespaceMap, err := remapTablespaces(entry.TablespaceMapFile, tablespaceLocations)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(targetDirectory, tablespaceMapFile), tablespaceMap)
+}
+
+// remapTablespaces replaces the location of the tablespaces
+// in the content of a tablespace_map file. Every line of the file
+// contains the OID of a tablespace followed by its location
+func remapTablespaces(tablespaceMap []byte, tablespaceLocations map[string]string) ([]byte, error) {
+	var result bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(tablespaceMap))
+	for scanner.Scan() {
+		line := scanner.Text()
+		oid, _, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+
+		location, ok := tablespaceLocations[oid]
+		if !ok {
+			return nil, fmt.Errorf("tablespace %s is in the tablespace_map file but was not backed up", oid)
+		}
+
+		absoluteLocation, err := filepath.Abs(location)
+		if err != nil {
+			return nil, err
+		}
+		_, _ = fmt.Fprintf(&result, "%s %s\n", oid, absoluteLocation)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+// writeRecoveryConfiguration appends to postgresql.auto.conf a
+// restore_command reading the WAL files from the archive and the
+// recovery target, and creates the recovery.signal file making
+// PostgreSQL replay them
+func writeRecoveryConfiguration(
+	targetDirectory string,
+	walPath string,
+	recoveryTarget *apiv1.RecoveryTarget,
+) error {
+	autoConf, err := os.OpenFile( // nolint:gosec
+		filepath.Join(targetDirectory, autoConfFile),
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE,
+		configurationMode,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = autoConf.Close()
+	}()
+
+	recoveryConfiguration := getRecoveryConfiguration(walPath) + recoveryTarget.BuildPostgresOptions()
+	if _, err := io.WriteString(autoConf, recoveryConfiguration); err != nil {
+		return err
+	}
+	if err := autoConf.Close(); err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(targetDirectory, recoverySignalFile), nil)
+}
+
+// getRecoveryConfiguration gets the recovery configuration reading
+// the WAL files from the archive. The archive stores each WAL file in
+// a directory named after the first characters of its name
+func getRecoveryConfiguration(walPath string) string {
+	restoreCommand := fmt.Sprintf(
+		`cp "%s/$(echo %%f | cut -c1-%d)/%%f" "%%p"`,
+		walPath,
+		storage.WALPrefixLength,
+	)
+
+	return fmt.Sprintf(
+		"\n# Added by the offline restore of the backup\nrestore_command = '%s'\n",
+		strings.ReplaceAll(restoreCommand, "'", "''"),
+	)
+}
+
+// writeFile writes a file with the permissions PostgreSQL
+// expects inside the data directory
+func writeFile(fileName string, content []byte) error {
+	if err := fileutils.WriteFileAtomic(fileName, bytes.NewReader(content)); err != nil {
+		return err
+	}
+
+	return os.Chmod(fileName, configurationMode)
+}
@@ -0,0 +1,133 @@
+package restore
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+func TestRemapTablespaces(t *testing.T) {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		content     string
+		locations   map[string]string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:    "every tablespace is moved",
+			content: "16385 /var/lib/postgresql/tablespaces/data\n16386 /var/lib/postgresql/tablespaces/my space\n",
+			locations: map[string]string{
+				"16385": "/restore/tablespaces/16385",
+				"16386": "/restore/tablespaces/16386",
+			},
+			expected: "16385 /restore/tablespaces/16385\n16386 /restore/tablespaces/16386\n",
+		},
+		{
+			name:      "relative locations are made absolute",
+			content:   "16385 /var/lib/postgresql/tablespaces/data\n",
+			locations: map[string]string{"16385": "restore-tablespaces/16385"},
+			expected:  "16385 " + filepath.Join(workingDirectory, "restore-tablespaces/16385") + "\n",
+		},
+		{
+			name:      "lines without a location are skipped",
+			content:   "\n16385 /var/lib/postgresql/tablespaces/data\n",
+			locations: map[string]string{"16385": "/restore/tablespaces/16385"},
+			expected:  "16385 /restore/tablespaces/16385\n",
+		},
+		{
+			name:        "tablespace not backed up",
+			content:     "16385 /var/lib/postgresql/tablespaces/data\n",
+			locations:   map[string]string{"16386": "/restore/tablespaces/16386"},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := remapTablespaces([]byte(test.content), test.locations)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetRecoveryConfiguration(t *testing.T) {
+	configuration := getRecoveryConfiguration("/backup/cluster-example/wals")
+	expected := "\n# Added by the offline restore of the backup\n" +
+		`restore_command = 'cp "/backup/cluster-example/wals/$(echo %f | cut -c1-16)/%f" "%p"'` + "\n"
+	if configuration != expected {
+		t.Errorf("expected %q, got %q", expected, configuration)
+	}
+
+	// The single quotes are doubled, as PostgreSQL expects them
+	// inside a quoted value
+	configuration = getRecoveryConfiguration("/backup/o'brien/wals")
+	if !strings.Contains(configuration, `cp "/backup/o''brien/wals/`) {
+		t.Errorf("expected the quote of the path to be escaped, got %q", configuration)
+	}
+}
+
+// getRestoreCommand gets the restore_command the way PostgreSQL reads
+// it from the recovery configuration, for the passed WAL file
+func getRestoreCommand(t *testing.T, configuration, walName, destination string) string {
+	t.Helper()
+
+	_, value, found := strings.Cut(configuration, "restore_command = ")
+	if !found {
+		t.Fatalf("restore_command not found in %q", configuration)
+	}
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "'"), "'")
+	value = strings.ReplaceAll(value, "''", "'")
+	value = strings.ReplaceAll(value, "%f", walName)
+
+	return strings.ReplaceAll(value, "%p", destination)
+}
+
+func TestRestoreCommand(t *testing.T) {
+	const walName = "000000020000000A000000FE"
+
+	// The path of the archive contains the characters needing to be quoted
+	walPath := filepath.Join(t.TempDir(), "o'brien wals")
+	prefixDirectory := filepath.Join(walPath, walName[:storage.WALPrefixLength])
+	if err := os.MkdirAll(prefixDirectory, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prefixDirectory, walName), []byte("wal"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	destination := filepath.Join(t.TempDir(), "RECOVERYXLOG")
+	restoreCommand := getRestoreCommand(t, getRecoveryConfiguration(walPath), walName, destination)
+	if output, err := exec.Command("sh", "-c", restoreCommand).CombinedOutput(); err != nil { // nolint:gosec
+		t.Fatalf("restore command %q failed: %v: %s", restoreCommand, err, output)
+	}
+
+	content, err := os.ReadFile(destination) // nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "wal" {
+		t.Errorf("expected the WAL file to be restored, got %q", content)
+	}
+}
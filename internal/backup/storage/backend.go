@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNotFound is returned by a Backend when the requested
+// object doesn't exist
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo contains the metadata of an object stored
+// in a Backend
+type ObjectInfo struct {
+	// Key is the key of the object, relative to the backend root
+	Key string
+
+	// Size is the size of the object, in bytes
+	Size int64
+
+	// ModTime is the time when the object was last modified
+	ModTime time.Time
+}
+
+// Backend is a place where the plugin can store
+// and retrieve objects, such as WAL files
+type Backend interface {
+	// Put stores the content read from the reader under the passed key,
+	// replacing any existing object. Size is the number of bytes that
+	// will be read from content
+	Put(ctx context.Context, key string, content io.Reader, size int64) error
+
+	// Get retrieves the content of an object. The caller is responsible
+	// for closing the returned reader
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// List lists the objects whose key begins with the passed prefix,
+	// in lexicographical order
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+
+	// Delete removes an object. Removing an object that doesn't
+	// exist is not an error
+	Delete(ctx context.Context, key string) error
+
+	// Stat gets the metadata of an object
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+// NewBackend creates the Backend selected by the options
+func NewBackend(options Options) (Backend, error) {
+	switch options.Type {
+	case BackendTypePVC:
+		return NewFilesystemBackend(basePath), nil
+
+	case BackendTypeS3:
+		return NewS3Backend(options.S3, GetS3CredentialsFromEnvironment(), nil)
+
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", options.Type)
+	}
+}
+
+// NewPreviousBackend creates a Backend for the backup PVC the
+// backups are being migrated from. Returns ErrNotFound when the previous
+// PVC is not mounted
+func NewPreviousBackend() (Backend, error) {
+	if _, err := os.Stat(PreviousBasePath); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewFilesystemBackend(PreviousBasePath), nil
+}
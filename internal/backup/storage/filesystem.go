@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+)
+
+// FilesystemBackend is a Backend storing objects as files
+// under a root directory, such as the mount point of the backup PVC
+type FilesystemBackend struct {
+	root string
+}
+
+// NewFilesystemBackend creates a new Backend storing objects
+// under the passed directory
+func NewFilesystemBackend(root string) *FilesystemBackend {
+	return &FilesystemBackend{
+		root: root,
+	}
+}
+
+func (backend *FilesystemBackend) getPath(key string) string {
+	return filepath.Join(backend.root, filepath.FromSlash(key))
+}
+
+// Put implements the Backend interface
+func (backend *FilesystemBackend) Put(_ context.Context, key string, content io.Reader, _ int64) error {
+	return fileutils.WriteFileAtomic(backend.getPath(key), content)
+}
+
+// Get implements the Backend interface
+func (backend *FilesystemBackend) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(backend.getPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// List implements the Backend interface
+func (backend *FilesystemBackend) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	// The prefix may end in the middle of a file name, so we
+	// start walking from the directory containing it
+	walkRoot := prefix
+	if !strings.HasSuffix(prefix, "/") {
+		walkRoot = path.Dir(prefix)
+	}
+
+	var result []ObjectInfo
+	err := filepath.WalkDir(backend.getPath(walkRoot), func(filePath string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || fileutils.IsTemporaryFile(entry.Name()) {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(backend.root, filePath)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(relativePath)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		result = append(result, ObjectInfo{
+			Key:     key,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Delete implements the Backend interface
+func (backend *FilesystemBackend) Delete(_ context.Context, key string) error {
+	err := os.Remove(backend.getPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Stat implements the Backend interface
+func (backend *FilesystemBackend) Stat(_ context.Context, key string) (*ObjectInfo, error) {
+	info, err := os.Stat(backend.getPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
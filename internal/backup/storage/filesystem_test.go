@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesystemBackendPutGetStatDelete(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	backend := NewFilesystemBackend(root)
+
+	const key = "cluster/wals/0000000100000000/000000010000000000000001"
+	const content = "WAL content"
+	if err := backend.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(key))); err != nil {
+		t.Fatalf("expected the object to be stored as a file: %v", err)
+	}
+
+	reader, err := backend.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	read, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != content {
+		t.Errorf("Get returned %q, want %q", read, content)
+	}
+
+	info, err := backend.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != key || info.Size != int64(len(content)) {
+		t.Errorf("unexpected Stat result: %+v", info)
+	}
+
+	if err := backend.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := backend.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the object to be removed, got %v", err)
+	}
+}
+
+func TestFilesystemBackendNotFound(t *testing.T) {
+	ctx := context.Background()
+	backend := NewFilesystemBackend(t.TempDir())
+
+	if _, err := backend.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing object: expected ErrNotFound, got %v", err)
+	}
+	if _, err := backend.Stat(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a missing object: expected ErrNotFound, got %v", err)
+	}
+	if err := backend.Delete(ctx, "missing"); err != nil {
+		t.Errorf("Delete of a missing object: expected no error, got %v", err)
+	}
+
+	objects, err := backend.List(ctx, "missing/")
+	if err != nil || len(objects) != 0 {
+		t.Errorf("List of a missing directory: expected nothing, got %v, %v", objects, err)
+	}
+}
+
+func TestFilesystemBackendList(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	backend := NewFilesystemBackend(root)
+
+	for _, key := range []string{
+		"cluster/wals/0000000100000000/000000010000000000000002",
+		"cluster/wals/0000000100000000/000000010000000000000001",
+		"cluster/wals/0000000200000000/000000020000000000000003",
+		"cluster/catalog/backup.json",
+		"cluster-other/wals/0000000100000000/000000010000000000000001",
+	} {
+		if err := backend.Put(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Interrupted writes must not be listed
+	temporaryFile := filepath.Join(root, "cluster", "wals", "0000000100000000", ".000000010000000000000003.tmp-123")
+	if err := os.WriteFile(temporaryFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{
+			prefix: "cluster/wals/",
+			expected: []string{
+				"cluster/wals/0000000100000000/000000010000000000000001",
+				"cluster/wals/0000000100000000/000000010000000000000002",
+				"cluster/wals/0000000200000000/000000020000000000000003",
+			},
+		},
+		{
+			// A prefix ending in the middle of a name
+			prefix: "cluster/wals/00000002",
+			expected: []string{
+				"cluster/wals/0000000200000000/000000020000000000000003",
+			},
+		},
+		{
+			prefix:   "cluster/catalog/",
+			expected: []string{"cluster/catalog/backup.json"},
+		},
+	}
+
+	for _, test := range tests {
+		objects, err := backend.List(ctx, test.prefix)
+		if err != nil {
+			t.Fatalf("List(%s): %v", test.prefix, err)
+		}
+
+		listed := make([]string, 0, len(objects))
+		for _, object := range objects {
+			listed = append(listed, object.Key)
+		}
+		if strings.Join(listed, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("List(%s)\ngot:  %v\nwant: %v", test.prefix, listed, test.expected)
+		}
+	}
+}
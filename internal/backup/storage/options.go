@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"os"
+)
+
+// BackendType is the type of storage where the archive is kept
+type BackendType string
+
+const (
+	// BackendTypePVC stores the archive in the backup PVC
+	BackendTypePVC BackendType = "pvc"
+
+	// BackendTypeS3 stores the archive in an S3-compatible
+	// object store
+	BackendTypeS3 BackendType = "s3"
+)
+
+const (
+	// S3AccessKeyIDSecretKey is the key of the S3 credentials Secret
+	// containing the access key ID
+	S3AccessKeyIDSecretKey = "accessKeyId"
+
+	// S3SecretAccessKeySecretKey is the key of the S3 credentials Secret
+	// containing the secret access key
+	S3SecretAccessKeySecretKey = "secretAccessKey"
+
+	// S3SessionTokenSecretKey is the optional key of the S3 credentials
+	// Secret containing the session token
+	S3SessionTokenSecretKey = "sessionToken"
+
+	// S3CASecretKey is the key of the CA Secret containing the
+	// PEM-encoded certificate bundle
+	S3CASecretKey = "ca.crt"
+
+	// S3CAMountPath is the path where the CA Secret is mounted
+	// in the sidecar
+	S3CAMountPath = "/s3-ca"
+)
+
+const (
+	// AccessKeyIDEnvironment is the environment variable containing
+	// the S3 access key ID
+	AccessKeyIDEnvironment = "AWS_ACCESS_KEY_ID"
+
+	// SecretAccessKeyEnvironment is the environment variable containing
+	// the S3 secret access key
+	SecretAccessKeyEnvironment = "AWS_SECRET_ACCESS_KEY"
+
+	// SessionTokenEnvironment is the environment variable containing
+	// the S3 session token
+	SessionTokenEnvironment = "AWS_SESSION_TOKEN"
+)
+
+// DefaultS3Region is the region used when none is configured
+const DefaultS3Region = "us-east-1"
+
+// Options selects where the archive is kept
+type Options struct {
+	// Type is the type of the storage
+	Type BackendType
+
+	// S3 contains the options of the S3 backend
+	S3 S3Options
+}
+
+// S3Options are the options used to reach an S3-compatible object store
+type S3Options struct {
+	// Bucket is the name of the bucket
+	Bucket string
+
+	// Prefix is prepended to every object key
+	Prefix string
+
+	// Endpoint is the URL of the object store. When empty,
+	// the AWS endpoint for the region is used
+	Endpoint string
+
+	// Region is the region of the bucket
+	Region string
+
+	// CAFile is the path of a PEM-encoded CA bundle used to validate
+	// the endpoint certificate. When empty, the system roots are used
+	CAFile string
+}
+
+// S3Credentials are the credentials used to sign S3 requests
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// GetS3CredentialsFromEnvironment reads the S3 credentials from the
+// environment variables injected into the sidecar
+func GetS3CredentialsFromEnvironment() S3Credentials {
+	return S3Credentials{
+		AccessKeyID:     os.Getenv(AccessKeyIDEnvironment),
+		SecretAccessKey: os.Getenv(SecretAccessKeyEnvironment),
+		SessionToken:    os.Getenv(SessionTokenEnvironment),
+	}
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Backend is a Backend storing objects in an S3-compatible
+// object store, such as AWS S3 or MinIO
+type S3Backend struct {
+	client      *http.Client
+	endpoint    *url.URL
+	pathStyle   bool
+	options     S3Options
+	credentials S3Credentials
+
+	// now gets the time the requests are signed at
+	now func() time.Time
+}
+
+// s3Error is the error document returned by the object store
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3ListResult is the document returned by ListObjectsV2
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// NewS3Backend creates a new Backend storing objects in an S3-compatible
+// object store. When client is nil, a client honoring the CA configured
+// in the options is created
+func NewS3Backend(options S3Options, credentials S3Credentials, client *http.Client) (*S3Backend, error) {
+	if len(options.Bucket) == 0 {
+		return nil, fmt.Errorf("missing S3 bucket name")
+	}
+
+	result := &S3Backend{
+		client:      client,
+		options:     options,
+		credentials: credentials,
+		now:         time.Now,
+	}
+
+	// Custom endpoints, such as MinIO, are reached using path-style
+	// requests, while AWS uses virtual-hosted-style ones
+	var err error
+	if len(options.Endpoint) > 0 {
+		result.pathStyle = true
+		result.endpoint, err = url.Parse(options.Endpoint)
+	} else {
+		result.endpoint, err = url.Parse(
+			fmt.Sprintf("https://%s.s3.%s.amazonaws.com", options.Bucket, options.Region))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while parsing S3 endpoint: %w", err)
+	}
+
+	if result.client == nil {
+		result.client, err = newS3HTTPClient(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func newS3HTTPClient(caFile string) (*http.Client, error) {
+	if len(caFile) == 0 {
+		return &http.Client{}, nil
+	}
+
+	caBundle, err := os.ReadFile(caFile) // nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("while reading S3 CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, fmt.Errorf("no valid certificate found in %s", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// getObjectName gets the name of the object in the bucket
+// corresponding to a backend key
+func (backend *S3Backend) getObjectName(key string) string {
+	prefix := strings.Trim(backend.options.Prefix, "/")
+	if len(prefix) == 0 {
+		return key
+	}
+
+	return prefix + "/" + key
+}
+
+// getKey is the inverse of getObjectName
+func (backend *S3Backend) getKey(objectName string) string {
+	prefix := strings.Trim(backend.options.Prefix, "/")
+	if len(prefix) == 0 {
+		return objectName
+	}
+
+	return strings.TrimPrefix(objectName, prefix+"/")
+}
+
+func (backend *S3Backend) getURL(objectName string, query url.Values) *url.URL {
+	result := *backend.endpoint
+	result.Path = "/"
+	if backend.pathStyle {
+		result.Path += backend.options.Bucket + "/"
+	}
+	result.Path += objectName
+	result.RawQuery = query.Encode()
+	return &result
+}
+
+func (backend *S3Backend) do(
+	ctx context.Context,
+	method string,
+	objectName string,
+	query url.Values,
+	body io.Reader,
+	size int64,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, backend.getURL(objectName, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bodies are streamed, so their hash is not known
+	// in advance and they are sent without being signed
+	payloadHash := s3EmptyPayloadHash
+	if body != nil {
+		req.ContentLength = size
+		payloadHash = s3UnsignedPayload
+	}
+
+	signS3Request(req, backend.options.Region, backend.credentials, backend.now(), payloadHash)
+
+	resp, err := backend.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	// HEAD responses have no body, so we can only report the status
+	var errorDocument s3Error
+	responseBody, _ := io.ReadAll(resp.Body)
+	if xml.Unmarshal(responseBody, &errorDocument) != nil || len(errorDocument.Code) == 0 {
+		return nil, fmt.Errorf("S3 %s %s: unexpected status code %d", method, objectName, resp.StatusCode)
+	}
+
+	return nil, fmt.Errorf(
+		"S3 %s %s: %s (%s)",
+		method, objectName, errorDocument.Code, errorDocument.Message)
+}
+
+// Put implements the Backend interface
+func (backend *S3Backend) Put(ctx context.Context, key string, content io.Reader, size int64) error {
+	resp, err := backend.do(ctx, http.MethodPut, backend.getObjectName(key), nil, content, size)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Get implements the Backend interface
+func (backend *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := backend.do(ctx, http.MethodGet, backend.getObjectName(key), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// List implements the Backend interface
+func (backend *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var result []ObjectInfo
+
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", backend.getObjectName(prefix))
+		if len(continuationToken) > 0 {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		listResult, err := backend.listPage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range listResult.Contents {
+			result = append(result, ObjectInfo{
+				Key:     backend.getKey(content.Key),
+				Size:    content.Size,
+				ModTime: content.LastModified,
+			})
+		}
+
+		if !listResult.IsTruncated {
+			return result, nil
+		}
+		continuationToken = listResult.NextContinuationToken
+	}
+}
+
+func (backend *S3Backend) listPage(ctx context.Context, query url.Values) (*s3ListResult, error) {
+	resp, err := backend.do(ctx, http.MethodGet, "", query, nil, 0)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("bucket %s not found", backend.options.Bucket)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var result s3ListResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("while decoding S3 list result: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Delete implements the Backend interface
+func (backend *S3Backend) Delete(ctx context.Context, key string) error {
+	resp, err := backend.do(ctx, http.MethodDelete, backend.getObjectName(key), nil, nil, 0)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Stat implements the Backend interface
+func (backend *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := backend.do(ctx, http.MethodHead, backend.getObjectName(key), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	result := &ObjectInfo{
+		Key: key,
+	}
+
+	if contentLength := resp.Header.Get("Content-Length"); len(contentLength) > 0 {
+		result.Size, err = strconv.ParseInt(contentLength, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing object size: %w", err)
+		}
+	}
+
+	if lastModified := resp.Header.Get("Last-Modified"); len(lastModified) > 0 {
+		result.ModTime, err = http.ParseTime(lastModified)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing object modification time: %w", err)
+		}
+	}
+
+	return result, nil
+}
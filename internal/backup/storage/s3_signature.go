@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This file implements the AWS Signature Version 4 algorithm as described in
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+
+const (
+	s3SignatureAlgorithm = "AWS4-HMAC-SHA256"
+	s3Service            = "s3"
+	s3UnsignedPayload    = "UNSIGNED-PAYLOAD"
+	s3DateFormat         = "20060102"
+	s3DateTimeFormat     = "20060102T150405Z"
+
+	// s3EmptyPayloadHash is the SHA256 hash of an empty payload
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signS3Request adds to the request the headers needed to authenticate
+// it against an S3-compatible endpoint. The payload has the passed
+// SHA256 hash, or is not signed when it is UNSIGNED-PAYLOAD
+func signS3Request(
+	req *http.Request,
+	region string,
+	credentials S3Credentials,
+	now time.Time,
+	payloadHash string,
+) {
+	now = now.UTC()
+	amzDate := now.Format(s3DateTimeFormat)
+	scope := strings.Join([]string{now.Format(s3DateFormat), region, s3Service, "aws4_request"}, "/")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if len(credentials.SessionToken) > 0 {
+		req.Header.Set("x-amz-security-token", credentials.SessionToken)
+	}
+
+	// Make sure the path and the query string we sign are the ones
+	// that will be sent on the wire
+	canonicalURI := s3URIEncode(req.URL.Path, false)
+	req.URL.RawPath = canonicalURI
+	canonicalQuery := s3CanonicalQuery(req)
+	req.URL.RawQuery = canonicalQuery
+
+	headerNames := []string{"host"}
+	for name := range req.Header {
+		lowerName := strings.ToLower(name)
+		if strings.HasPrefix(lowerName, "x-amz-") {
+			headerNames = append(headerNames, lowerName)
+		}
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		s3SignatureAlgorithm,
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), now.Format(s3DateFormat))
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignatureAlgorithm,
+		credentials.AccessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+// s3CanonicalQuery gets the query string of the request encoded
+// and sorted as required by the signature algorithm
+func s3CanonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode encodes every byte except the unreserved characters.
+// The slash is encoded only when encodeSlash is true
+func s3URIEncode(value string, encodeSlash bool) string {
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			result.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			result.WriteByte(c)
+		default:
+			fmt.Fprintf(&result, "%%%02X", c)
+		}
+	}
+	return result.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testBucket   = "backups"
+	testListPage = 2
+)
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible
+// object store, such as MinIO, serving path-style requests
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	modTime time.Time
+
+	// listRequests counts the ListObjectsV2 requests
+	listRequests int
+
+	// forbidden makes every request fail with AccessDenied
+	forbidden bool
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string][]byte),
+		modTime: time.Date(2024, time.February, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), s3SignatureAlgorithm+" Credential=") ||
+		len(r.Header.Get("x-amz-date")) == 0 {
+		writeS3Error(w, http.StatusForbidden, "MissingSecurityHeader")
+		return
+	}
+	if s.forbidden {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	bucket, objectName, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != testBucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(objectName) == 0:
+		s.list(w, r)
+
+	case r.Method == http.MethodPut:
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.ContentLength != int64(len(content)) {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[objectName] = content
+
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		content, ok := s.objects[objectName]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Last-Modified", s.modTime.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+
+	case r.Method == http.MethodDelete:
+		// Like S3, removing a missing object succeeds
+		delete(s.objects, objectName)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list serves ListObjectsV2, returning a few objects per page
+// to exercise the pagination
+func (s *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	s.listRequests++
+
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		if strings.HasPrefix(name, query.Get("prefix")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start := 0
+	if token := query.Get("continuation-token"); len(token) > 0 {
+		start = sort.SearchStrings(names, token)
+	}
+	end := min(start+testListPage, len(names))
+
+	var result s3ListResult
+	for _, name := range names[start:end] {
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+		}{Key: name, Size: int64(len(s.objects[name])), LastModified: s.modTime})
+	}
+	if end < len(names) {
+		result.IsTruncated = true
+		result.NextContinuationToken = names[end]
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		s3ListResult
+	}{s3ListResult: result})
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s message</Message></Error>", code, code)
+}
+
+// newTestS3Backend creates a backend talking to a fake object store
+func newTestS3Backend(t *testing.T, prefix string) (*S3Backend, *fakeS3) {
+	t.Helper()
+
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	backend, err := NewS3Backend(S3Options{
+		Bucket:   testBucket,
+		Prefix:   prefix,
+		Endpoint: server.URL,
+		Region:   DefaultS3Region,
+	}, S3Credentials{
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return backend, fake
+}
+
+func TestS3BackendPutGetStatDelete(t *testing.T) {
+	ctx := context.Background()
+	backend, fake := newTestS3Backend(t, "/cluster-prefix/")
+
+	content := []byte("WAL content")
+	const key = "cluster/wals/0000000100000000/000000010000000000000001"
+	if err := backend.Put(ctx, key, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := fake.objects["cluster-prefix/"+key]; !ok {
+		t.Fatalf("expected the object to be stored under the prefix, got %v", fake.objects)
+	}
+
+	reader, err := backend.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	read, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, content) {
+		t.Errorf("Get returned %q, want %q", read, content)
+	}
+
+	info, err := backend.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != key || info.Size != int64(len(content)) || !info.ModTime.Equal(fake.modTime) {
+		t.Errorf("unexpected Stat result: %+v", info)
+	}
+
+	if err := backend.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("expected the object to be removed, got %v", fake.objects)
+	}
+}
+
+func TestS3BackendNotFound(t *testing.T) {
+	ctx := context.Background()
+	backend, _ := newTestS3Backend(t, "")
+
+	if _, err := backend.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing object: expected ErrNotFound, got %v", err)
+	}
+	if _, err := backend.Stat(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a missing object: expected ErrNotFound, got %v", err)
+	}
+	if err := backend.Delete(ctx, "missing"); err != nil {
+		t.Errorf("Delete of a missing object: expected no error, got %v", err)
+	}
+}
+
+func TestS3BackendErrorDocument(t *testing.T) {
+	ctx := context.Background()
+	backend, fake := newTestS3Backend(t, "")
+	fake.forbidden = true
+
+	_, err := backend.Get(ctx, "key")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("expected the S3 error code to be reported, got %v", err)
+	}
+
+	// HEAD responses have no body, so only the status code is known
+	_, err = backend.Stat(ctx, "key")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the status code to be reported, got %v", err)
+	}
+}
+
+func TestS3BackendListPagination(t *testing.T) {
+	ctx := context.Background()
+	backend, fake := newTestS3Backend(t, "prefix")
+
+	keys := []string{
+		"cluster/wals/0000000100000000/000000010000000000000003",
+		"cluster/wals/0000000100000000/000000010000000000000001",
+		"cluster/wals/0000000100000000/000000010000000000000002",
+		"cluster/wals/0000000100000000/000000010000000000000004",
+		"cluster/wals/0000000100000000/000000010000000000000005",
+		"cluster/catalog/backup.json",
+		"other/wals/0000000100000000/000000010000000000000001",
+	}
+	for _, key := range keys {
+		if err := backend.Put(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := backend.List(ctx, "cluster/wals/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	var listed []string
+	for _, object := range objects {
+		listed = append(listed, object.Key)
+		if object.Size != int64(len(object.Key)) {
+			t.Errorf("unexpected size of %s: %d", object.Key, object.Size)
+		}
+	}
+	expected := []string{
+		"cluster/wals/0000000100000000/000000010000000000000001",
+		"cluster/wals/0000000100000000/000000010000000000000002",
+		"cluster/wals/0000000100000000/000000010000000000000003",
+		"cluster/wals/0000000100000000/000000010000000000000004",
+		"cluster/wals/0000000100000000/000000010000000000000005",
+	}
+	if strings.Join(listed, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected list result\ngot:  %v\nwant: %v", listed, expected)
+	}
+	if fake.listRequests != 3 {
+		t.Errorf("expected 3 pages to be requested, got %d", fake.listRequests)
+	}
+}
+
+func TestS3BackendMissingBucket(t *testing.T) {
+	backend, _ := newTestS3Backend(t, "")
+	backend.options.Bucket = "missing"
+
+	_, err := backend.List(context.Background(), "")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "bucket missing not found") {
+		t.Errorf("expected a missing bucket error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"syscall"
+)
+
+// VolumeUsage is the space usage of the volume mounted on /backup
+type VolumeUsage struct {
+	// TotalBytes is the size of the volume
+	TotalBytes int64
+
+	// UsedBytes is the space already used
+	UsedBytes int64
+
+	// AvailableBytes is the space that can still be written
+	AvailableBytes int64
+}
+
+// UsedPercentage gets the percentage of the volume that is used,
+// computed as df does
+func (usage VolumeUsage) UsedPercentage(additionalBytes int64) float64 {
+	capacity := usage.UsedBytes + usage.AvailableBytes
+	if capacity <= 0 {
+		return 100
+	}
+
+	return float64(usage.UsedBytes+additionalBytes) * 100 / float64(capacity)
+}
+
+// GetVolumeUsage gets the space usage of the volume mounted on /backup
+func GetVolumeUsage() (VolumeUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(basePath, &stat); err != nil {
+		return VolumeUsage{}, err
+	}
+
+	blockSize := int64(stat.Bsize) // nolint:unconvert
+	return VolumeUsage{
+		TotalBytes:     int64(stat.Blocks) * blockSize,
+		UsedBytes:      int64(stat.Blocks-stat.Bfree) * blockSize,
+		AvailableBytes: int64(stat.Bavail) * blockSize,
+	}, nil
+}
+
+// GetDirectorySize gets the total size of the regular files inside a
+// directory, skipping the excluded directories. Symbolic links are not
+// followed, and files removed while the directory is being walked are
+// ignored
+func GetDirectorySize(dir string, excludedDirs ...string) (int64, error) {
+	var result int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && slices.Contains(excludedDirs, path) {
+			return filepath.SkipDir
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result += info.Size()
+		return nil
+	})
+
+	return result, err
+}
+
+// GetClusterUsage gets the space used by the files relative to a cluster
+func GetClusterUsage(clusterName string) (int64, error) {
+	return GetDirectorySize(getClusterPath(clusterName))
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name string, size int) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, make([]byte, size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetDirectorySize(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "PG_VERSION"), 3)
+	writeTestFile(t, filepath.Join(dir, "base", "1", "1259"), 8192)
+	writeTestFile(t, filepath.Join(dir, "pg_wal", "000000010000000000000001"), 16384)
+	if err := os.Symlink(filepath.Join(dir, "base"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := GetDirectorySize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 3+8192+16384 {
+		t.Errorf("expected every regular file to be counted once, got %d bytes", size)
+	}
+
+	size, err = GetDirectorySize(dir, filepath.Join(dir, "pg_wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 3+8192 {
+		t.Errorf("expected the excluded directory not to be counted, got %d bytes", size)
+	}
+
+	size, err = GetDirectorySize(filepath.Join(dir, "missing"))
+	if err != nil || size != 0 {
+		t.Errorf("expected a missing directory to be empty, got %d bytes and %v", size, err)
+	}
+}
+
+func TestUsedPercentage(t *testing.T) {
+	usage := VolumeUsage{TotalBytes: 1000, UsedBytes: 500, AvailableBytes: 500}
+	if percentage := usage.UsedPercentage(0); percentage != 50 {
+		t.Errorf("expected 50%%, got %.1f%%", percentage)
+	}
+	if percentage := usage.UsedPercentage(250); percentage != 75 {
+		t.Errorf("expected 75%%, got %.1f%%", percentage)
+	}
+	if percentage := (VolumeUsage{}).UsedPercentage(0); percentage != 100 {
+		t.Errorf("expected an empty volume to be full, got %.1f%%", percentage)
+	}
+}
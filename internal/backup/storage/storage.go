@@ -2,14 +2,24 @@ package storage
 
 import "path"
 
+// PreviousBasePath is where the backup PVC the backups are
+// being migrated from is mounted
+const PreviousBasePath = "/backup-previous"
+
 const (
-	basePath      = "/backup"
-	walsDirectory = "wals"
-	baseDirectory = "base"
+	basePath         = "/backup"
+	walsDirectory    = "wals"
+	baseDirectory    = "base"
+	catalogDirectory = "catalog"
 )
 
+// WALPrefixLength is the length of the prefix of the WAL file names,
+// made of the timeline and of the log ID, naming the directory where
+// they are stored
+const WALPrefixLength = 16
+
 func getWalPrefix(walName string) string {
-	return walName[0:16]
+	return walName[0:WALPrefixLength]
 }
 
 // getClusterPath gets the path where the files relative
@@ -45,6 +55,33 @@ func GetKopiaCacheDirectory(clusterName string) string {
 	)
 }
 
+// GetMaintenanceStatusFilePath gets the path of the file where
+// the outcome of the last Kopia maintenance runs is written
+func GetMaintenanceStatusFilePath(clusterName string) string {
+	return path.Join(
+		getClusterPath(clusterName),
+		".maintenance.json",
+	)
+}
+
+// GetMaintenanceLockFilePath gets the path of the lock file
+// preventing concurrent Kopia maintenance runs
+func GetMaintenanceLockFilePath(clusterName string) string {
+	return path.Join(
+		getClusterPath(clusterName),
+		".maintenance.lock",
+	)
+}
+
+// GetBackupLockFilePath gets the path of the lock file
+// preventing concurrent backups of the same cluster
+func GetBackupLockFilePath(clusterName string) string {
+	return path.Join(
+		getClusterPath(clusterName),
+		".backup.lock",
+	)
+}
+
 // GetBasePath gets the path where the WALs relative
 // to a cluster are stored
 func GetBasePath(clusterName string) string {
@@ -54,12 +91,65 @@ func GetBasePath(clusterName string) string {
 	)
 }
 
-// GetWALFilePath gets the path where a certain WAL file
-// should be stored
-func GetWALFilePath(clusterName string, walName string) string {
+// GetWALPrefixKey gets the prefix of the keys under which the
+// WALs relative to a cluster are stored in a Backend
+func GetWALPrefixKey(clusterName string) string {
+	return path.Join(clusterName, walsDirectory) + "/"
+}
+
+// GetWALKey gets the key under which a certain WAL file
+// is stored in a Backend
+func GetWALKey(clusterName string, walName string) string {
 	return path.Join(
-		GetWALPath(clusterName),
+		clusterName,
+		walsDirectory,
 		getWalPrefix(walName),
 		walName,
 	)
 }
+
+// GetBasePrefixKey gets the prefix of the keys under which the
+// base backups relative to a cluster are stored in a Backend
+func GetBasePrefixKey(clusterName string) string {
+	return path.Join(clusterName, baseDirectory) + "/"
+}
+
+// GetSpaceHistoryFilePath gets the path of the file where the space
+// written by the last backups is recorded, to estimate the size
+// of the next ones
+func GetSpaceHistoryFilePath(clusterName string) string {
+	return path.Join(
+		getClusterPath(clusterName),
+		".space-history.json",
+	)
+}
+
+// GetCatalogPrefixKey gets the prefix of the keys under which the
+// backup catalog of a cluster is stored in a Backend
+func GetCatalogPrefixKey(clusterName string) string {
+	return path.Join(clusterName, catalogDirectory) + "/"
+}
+
+// GetCatalogKey gets the key under which the catalog
+// entry of a backup is stored in a Backend
+func GetCatalogKey(clusterName string, backupName string) string {
+	return path.Join(clusterName, catalogDirectory, backupName+".json")
+}
+
+// GetMigrationStatusFilePath gets the path of the file where the
+// progress of the migration from the previous backup PVC is written
+func GetMigrationStatusFilePath(clusterName string) string {
+	return path.Join(
+		getClusterPath(clusterName),
+		".migration.json",
+	)
+}
+
+// GetMigrationLockFilePath gets the path of the lock file preventing
+// concurrent migrations from the previous backup PVC
+func GetMigrationLockFilePath(clusterName string) string {
+	return path.Join(
+		getClusterPath(clusterName),
+		".migration.lock",
+	)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// CheckBackupVolume checks that a volume is mounted on /backup,
+// and that files can be written into it
+func CheckBackupVolume() error {
+	return checkVolume(basePath)
+}
+
+func checkVolume(mountPath string) error {
+	var backupStat, parentStat syscall.Stat_t
+	if err := syscall.Stat(mountPath, &backupStat); err != nil {
+		return fmt.Errorf("backup volume not found: %w", err)
+	}
+	if err := syscall.Stat(filepath.Dir(mountPath), &parentStat); err != nil {
+		return err
+	}
+
+	// A mount point lives on a different device than its parent
+	if backupStat.Dev == parentStat.Dev {
+		return fmt.Errorf("no volume is mounted on %s", mountPath)
+	}
+
+	file, err := os.CreateTemp(mountPath, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("backup volume is not writable: %w", err)
+	}
+	_ = file.Close()
+
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckVolume(t *testing.T) {
+	directory := t.TempDir()
+
+	if err := checkVolume(filepath.Join(directory, "backup")); err == nil ||
+		!strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected the missing volume to be reported, got %v", err)
+	}
+
+	// A plain directory lives on the same device as its parent
+	if err := checkVolume(directory); err == nil || !strings.Contains(err.Error(), "no volume is mounted") {
+		t.Errorf("expected the missing mount to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"github.com/spf13/cobra"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/recovery"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/restore"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+const (
+	tablespaceMappingFlag = "tablespace-mapping"
+	targetTimeFlag        = "target-time"
+	targetLSNFlag         = "target-lsn"
+	targetXIDFlag         = "target-xid"
+	targetNameFlag        = "target-name"
+	targetImmediateFlag   = "target-immediate"
+	targetTimelineFlag    = "target-tli"
+	exclusiveFlag         = "exclusive"
+)
+
+// errRestoreNeedsPVC is returned when restoring a backup of a cluster
+// whose WAL files are not archived in the backup volume
+var errRestoreNeedsPVC = errors.New("the WAL files can only be restored from a backup volume")
+
+// NewBackupCmd creates the "backup" command, managing the
+// backups recorded in the catalog of a cluster
+func NewBackupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Inspect and manage the backups of a cluster",
+	}
+	addClusterFlag(cmd)
+
+	cmd.AddCommand(
+		newBackupListCmd(),
+		newBackupShowCmd(),
+		newBackupDeleteCmd(),
+		newBackupVerifyCmd(),
+		newBackupRestoreCmd(),
+	)
+
+	return cmd
+}
+
+func newBackupListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the backups, from the oldest to the newest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			output, err := getOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			entries, err := archive.catalog.List(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if output == outputJSON {
+				return printJSON(cmd.OutOrStdout(), entries)
+			}
+
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(writer, "NAME\tSTATUS\tSTARTED\tDURATION\tBEGIN WAL\tEND WAL\tSNAPSHOTS")
+			for _, entry := range entries {
+				status := "completed"
+				if entry.Failed() {
+					status = "failed"
+				}
+				_, _ = fmt.Fprintf(
+					writer,
+					"%s\t%s\t%s\t%s\t%s\t%s\t%d\n",
+					entry.BackupName,
+					status,
+					entry.StartedAt.Format(time.RFC3339),
+					entry.StoppedAt.Sub(entry.StartedAt).Round(time.Second),
+					entry.BeginWal,
+					entry.EndWal,
+					len(entry.Snapshots),
+				)
+			}
+			return writer.Flush()
+		},
+	}
+	addOutputFlag(cmd)
+
+	return cmd
+}
+
+func newBackupShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show BACKUP",
+		Short: "Show the catalog entry of a backup",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			entry, err := getCatalogEntry(cmd, archive.catalog, args[0])
+			if err != nil {
+				return err
+			}
+
+			return printJSON(cmd.OutOrStdout(), entry)
+		},
+	}
+}
+
+func newBackupDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete BACKUP",
+		Short: "Delete the snapshots of a backup and remove it from the catalog",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			entry, err := getCatalogEntry(cmd, archive.catalog, args[0])
+			if err != nil {
+				return err
+			}
+
+			release, err := acquireBackupLock(ctx, archive.clusterName, "delete backup "+entry.BackupName)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			repository, err := archive.openRepository(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, snapshot := range entry.Snapshots {
+				logging.FromContext(ctx).Info("Deleting snapshot", "name", snapshot.Name, "snapshotID", snapshot.ID)
+				if err := repository.DeleteSnapshot(ctx, snapshot.ID); err != nil {
+					return fmt.Errorf("while deleting snapshot %s: %w", snapshot.ID, err)
+				}
+			}
+
+			// The catalog entry is removed last, so that a failed
+			// deletion can be retried
+			if err := archive.catalog.Delete(ctx, entry.BackupName); err != nil {
+				return err
+			}
+
+			archive.newEventRecorder(ctx).BackupPruned(archive.cluster, entry.BackupName, len(entry.Snapshots))
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Backup %s deleted\n", entry.BackupName)
+			return nil
+		},
+	}
+}
+
+func newBackupVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify BACKUP",
+		Short: "Verify the snapshots of a backup and the presence of its WAL files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			entry, err := getCatalogEntry(cmd, archive.catalog, args[0])
+			if err != nil {
+				return err
+			}
+			if entry.Failed() {
+				return fmt.Errorf("backup %s failed: %s", entry.BackupName, entry.Error)
+			}
+
+			if err := recovery.CheckBackupWALs(ctx, archive.backend, archive.clusterName, entry); err != nil {
+				return fmt.Errorf("while checking the WAL files of backup %s: %w", entry.BackupName, err)
+			}
+
+			repository, err := archive.openRepository(ctx)
+			if err != nil {
+				return err
+			}
+
+			snapshotIDs := make([]string, len(entry.Snapshots))
+			for i, snapshot := range entry.Snapshots {
+				snapshotIDs[i] = snapshot.ID
+			}
+			if err := repository.VerifySnapshots(ctx, snapshotIDs...); err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Backup %s verified\n", entry.BackupName)
+			return nil
+		},
+	}
+}
+
+func newBackupRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore [BACKUP] TARGET_DIRECTORY",
+		Short: "Restore a backup into a directory, ready to replay the WAL archive",
+		Long: "Restore the data directory and the tablespaces of a backup, given its name or the ID of " +
+			"one of its snapshots. When no backup is passed, the most recent one ending before the " +
+			"recovery target is used. The WAL archive is checked to contain every WAL file needed to " +
+			"reach the target before restoring, or only the ones needed to restore the backup when " +
+			"no target is set. The tablespaces not mapped with --tablespace-mapping " +
+			"are restored into TARGET_DIRECTORY-tablespaces/OID. The restored directory contains the " +
+			"backup_label and tablespace_map files and a restore_command reading the WAL archive.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			tablespaceLocations, err := cmd.Flags().GetStringToString(tablespaceMappingFlag)
+			if err != nil {
+				return err
+			}
+			dryRun, err := cmd.Flags().GetBool(dryRunFlag)
+			if err != nil {
+				return err
+			}
+			recoveryTarget, err := getRecoveryTarget(cmd)
+			if err != nil {
+				return err
+			}
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			// The restore_command copies the WAL files from the
+			// backup volume, which is where they must be archived
+			if archive.configuration.Storage.Type != storage.BackendTypePVC {
+				return errRestoreNeedsPVC
+			}
+
+			targetDirectory := args[len(args)-1]
+			if len(args) == 2 {
+				entry, err := findCatalogEntry(cmd, archive.catalog, args[0])
+				if err != nil {
+					return err
+				}
+				recoveryTarget.BackupID = entry.BackupName
+			}
+
+			plan, err := recovery.NewPlan(ctx, archive.backend, archive.clusterName, recoveryTarget)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(
+				cmd.OutOrStdout(),
+				"Using backup %s on timeline %d, replaying WAL files from %s to %s\n",
+				plan.Backup.BackupName,
+				plan.Timeline,
+				plan.FirstWal,
+				plan.LastWal,
+			)
+			if dryRun {
+				return nil
+			}
+
+			repository, err := archive.openRepository(ctx)
+			if err != nil {
+				return err
+			}
+
+			// The backup has already been chosen, and PostgreSQL
+			// doesn't know about it
+			recoveryTarget.BackupID = ""
+			if err := restore.Run(ctx, repository, plan.Backup, restore.Options{
+				TargetDirectory:     targetDirectory,
+				TablespaceLocations: tablespaceLocations,
+				WALPath:             storage.GetWALPath(archive.clusterName),
+				RecoveryTarget:      recoveryTarget,
+			}); err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Backup %s restored into %s\n", plan.Backup.BackupName, targetDirectory)
+			return nil
+		},
+	}
+	cmd.Flags().StringToString(
+		tablespaceMappingFlag,
+		nil,
+		"The directory where a tablespace is restored, as OID=DIRECTORY",
+	)
+	cmd.Flags().Bool(dryRunFlag, false, "Only select the backup and check the WAL archive")
+	cmd.Flags().String(targetTimeFlag, "", "Stop the recovery at this time")
+	cmd.Flags().String(targetLSNFlag, "", "Stop the recovery at this LSN")
+	cmd.Flags().String(targetXIDFlag, "", "Stop the recovery at this transaction ID")
+	cmd.Flags().String(targetNameFlag, "", "Stop the recovery at this named restore point")
+	cmd.Flags().Bool(targetImmediateFlag, false, "Stop the recovery as soon as the backup is consistent")
+	cmd.Flags().String(targetTimelineFlag, "", "The timeline to follow: latest, current or a timeline ID")
+	cmd.Flags().Bool(exclusiveFlag, false, "Stop the recovery just before the target")
+
+	return cmd
+}
+
+// getRecoveryTarget gets the recovery target selected by the flags
+func getRecoveryTarget(cmd *cobra.Command) (*apiv1.RecoveryTarget, error) {
+	var result apiv1.RecoveryTarget
+	for flag, value := range map[string]*string{
+		targetTimeFlag:     &result.TargetTime,
+		targetLSNFlag:      &result.TargetLSN,
+		targetXIDFlag:      &result.TargetXID,
+		targetNameFlag:     &result.TargetName,
+		targetTimelineFlag: &result.TargetTLI,
+	} {
+		var err error
+		if *value, err = cmd.Flags().GetString(flag); err != nil {
+			return nil, err
+		}
+	}
+
+	immediate, err := cmd.Flags().GetBool(targetImmediateFlag)
+	if err != nil {
+		return nil, err
+	}
+	if immediate {
+		result.TargetImmediate = &immediate
+	}
+
+	exclusive, err := cmd.Flags().GetBool(exclusiveFlag)
+	if err != nil {
+		return nil, err
+	}
+	if exclusive {
+		result.Exclusive = &exclusive
+	}
+
+	return &result, nil
+}
+
+// getCatalogEntry gets a backup from the catalog, reporting
+// a readable error when the backup doesn't exist
+func getCatalogEntry(cmd *cobra.Command, backupCatalog *catalog.Catalog, backupName string) (*catalog.Entry, error) {
+	entry, err := backupCatalog.Get(cmd.Context(), backupName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("backup %s is not in the catalog", backupName)
+	}
+
+	return entry, err
+}
+
+// findCatalogEntry gets a backup from the catalog given either
+// its name or the ID of one of its snapshots
+func findCatalogEntry(
+	cmd *cobra.Command,
+	backupCatalog *catalog.Catalog,
+	backupNameOrID string,
+) (*catalog.Entry, error) {
+	entry, err := backupCatalog.Get(cmd.Context(), backupNameOrID)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return entry, err
+	}
+
+	entries, err := backupCatalog.List(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		for _, snapshot := range entries[i].Snapshots {
+			if snapshot.ID == backupNameOrID {
+				return &entries[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no backup named %s or having a snapshot with that ID in the catalog", backupNameOrID)
+}
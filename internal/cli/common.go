@@ -0,0 +1,257 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/events"
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+const (
+	clusterFlag = "cluster"
+	outputFlag  = "output"
+
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// errRepositoryNotFound is returned when a command needs the Kopia
+// repository of a cluster that was never initialized
+var errRepositoryNotFound = errors.New("repository not found, use \"repo init\" to create it")
+
+// errPluginNotEnabled is returned when the cluster selected
+// by the flags doesn't use this plugin
+var errPluginNotEnabled = errors.New("the plugin is not enabled in the cluster")
+
+// errUnknownOutput is returned when the requested output format
+// is not supported
+var errUnknownOutput = errors.New("unknown output format")
+
+// addClusterFlag adds the required flag selecting the cluster
+// whose archive is managed
+func addClusterFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().String(clusterFlag, "", "The name of the cluster whose archive is managed")
+	_ = cmd.MarkPersistentFlagRequired(clusterFlag)
+}
+
+// addOutputFlag adds the flag selecting the output format
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP(outputFlag, "o", outputText, "The output format, either text or json")
+}
+
+// getOutput gets the output format requested by the user
+func getOutput(cmd *cobra.Command) (string, error) {
+	output, err := cmd.Flags().GetString(outputFlag)
+	if err != nil {
+		return "", err
+	}
+
+	switch output {
+	case outputText, outputJSON:
+		return output, nil
+	default:
+		return "", fmt.Errorf("%w: %s", errUnknownOutput, output)
+	}
+}
+
+// printJSON writes the passed value as indented JSON
+func printJSON(out io.Writer, value any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// archive is the WAL archive, the backup catalog and the Kopia
+// repository of the cluster selected by the flags, stored where
+// the plugin parameters of the cluster say
+type archive struct {
+	clusterName   string
+	cluster       *apiv1.Cluster
+	restConfig    *rest.Config
+	configuration *config.Configuration
+	backend       storage.Backend
+	catalog       *catalog.Catalog
+}
+
+// newArchive loads the plugin configuration of the cluster selected by
+// the flags from its Cluster object, and opens its archive
+func newArchive(cmd *cobra.Command) (*archive, error) {
+	clusterName, err := cmd.Flags().GetString(clusterFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	restConfig, err := ctrlconfig.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("while connecting to the Kubernetes API: %w", err)
+	}
+
+	cluster, err := getCluster(cmd.Context(), restConfig, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("while getting cluster %s: %w", clusterName, err)
+	}
+
+	configuration, err := getConfiguration(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := storage.NewBackend(configuration.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &archive{
+		clusterName:   clusterName,
+		cluster:       cluster,
+		restConfig:    restConfig,
+		configuration: configuration,
+		backend:       backend,
+		catalog:       catalog.New(backend, clusterName),
+	}, nil
+}
+
+// getConfiguration parses the parameters of the plugin in a Cluster
+func getConfiguration(cluster *apiv1.Cluster) (*config.Configuration, error) {
+	for _, plugin := range cluster.Spec.Plugins {
+		if plugin.Name == metadata.Data.Name {
+			return config.FromParameters(plugin.Parameters)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", errPluginNotEnabled, cluster.Name)
+}
+
+// openRepository opens the existing Kopia repository of the cluster
+func (archive *archive) openRepository(ctx context.Context) (*executor.Repository, error) {
+	location, err := executor.GetRepositoryLocation(archive.clusterName, archive.configuration.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := executor.RepositoryExists(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errRepositoryNotFound
+	}
+
+	return archive.newRepository(ctx, executor.RepositoryFormat{})
+}
+
+// newRepository opens the Kopia repository of the cluster, creating
+// it with the passed format when it doesn't exist
+func (archive *archive) newRepository(
+	ctx context.Context,
+	format executor.RepositoryFormat,
+) (*executor.Repository, error) {
+	location, err := executor.GetRepositoryLocation(archive.clusterName, archive.configuration.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := executor.GetRepositoryPasswords(archive.configuration.SecretKey, archive.configuration.NewSecretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return executor.NewRepository(ctx, executor.RepositoryOptions{
+		Location:       location,
+		ConfigFile:     storage.GetKopiaConfigFilePath(archive.clusterName),
+		CacheDirectory: storage.GetKopiaCacheDirectory(archive.clusterName),
+		Passwords:      passwords,
+		Format:         format,
+	})
+}
+
+// newEventRecorder creates the Recorder emitting the Events about the
+// archive on the Cluster object. When the Events can't be created,
+// they are discarded
+func (archive *archive) newEventRecorder(ctx context.Context) *events.Recorder {
+	eventRecorder, err := events.NewCommandEventRecorder(archive.restConfig)
+	if err != nil {
+		logging.FromContext(ctx).Info("Cannot create the event recorder, skipping the events", "reason", err.Error())
+		return nil
+	}
+
+	return events.NewRecorder(eventRecorder)
+}
+
+// getCluster gets the Cluster object from the namespace of the
+// Pod running the command, or of the current kubeconfig context
+func getCluster(ctx context.Context, restConfig *rest.Config, clusterName string) (*apiv1.Cluster, error) {
+	namespace, _, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	).Namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := apiv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	kubernetesClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	var cluster apiv1.Cluster
+	if err := kubernetesClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: clusterName}, &cluster); err != nil {
+		return nil, err
+	}
+
+	return &cluster, nil
+}
+
+// acquireBackupLock prevents the backups of a cluster from being
+// taken while the passed operation changes its archive
+func acquireBackupLock(ctx context.Context, clusterName string, operation string) (func(), error) {
+	backupLock, err := backup.AcquireBackupLock(ctx, clusterName, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := backupLock.Release(); err != nil {
+			logging.FromContext(ctx).Error(err, "Error while releasing backup lock")
+		}
+	}, nil
+}
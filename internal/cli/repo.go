@@ -0,0 +1,167 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+const (
+	encryptionFlag  = "encryption"
+	hashFlag        = "hash"
+	splitterFlag    = "splitter"
+	compressionFlag = "compression"
+	fullFlag        = "full"
+)
+
+// NewRepoCmd creates the "repo" command, managing the
+// Kopia repository of a cluster
+func NewRepoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Manage the Kopia repository of a cluster",
+	}
+	addClusterFlag(cmd)
+
+	cmd.AddCommand(
+		newRepoInitCmd(),
+		newRepoMaintenanceCmd(),
+	)
+
+	return cmd
+}
+
+func newRepoInitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create the repository, or connect to it when it already exists",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			format, err := getRepositoryFormat(cmd, archive.configuration.Format)
+			if err != nil {
+				return err
+			}
+
+			if _, err := archive.newRepository(ctx, format); err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Repository of cluster %s ready\n", archive.clusterName)
+			return nil
+		},
+	}
+	cmd.Flags().String(encryptionFlag, "", "The encryption algorithm, one of "+joinValues(executor.SupportedEncryptions))
+	cmd.Flags().String(hashFlag, "", "The hash algorithm, one of "+joinValues(executor.SupportedHashes))
+	cmd.Flags().String(splitterFlag, "", "The object splitter, one of "+joinValues(executor.SupportedSplitters))
+	cmd.Flags().String(compressionFlag, "", "The compression, one of "+joinValues(executor.SupportedCompressions))
+
+	return cmd
+}
+
+// joinValues formats the supported values of a flag
+func joinValues(values []string) string {
+	return strings.Join(values, ", ")
+}
+
+// getRepositoryFormat gets the repository format selected by the flags,
+// checking that every algorithm is supported. The algorithms not selected
+// by the flags are the ones in the configured format
+func getRepositoryFormat(
+	cmd *cobra.Command,
+	configuredFormat executor.RepositoryFormat,
+) (executor.RepositoryFormat, error) {
+	format := configuredFormat
+	for _, flag := range []struct {
+		name      string
+		supported []string
+		value     *string
+	}{
+		{name: encryptionFlag, supported: executor.SupportedEncryptions, value: &format.Encryption},
+		{name: hashFlag, supported: executor.SupportedHashes, value: &format.Hash},
+		{name: splitterFlag, supported: executor.SupportedSplitters, value: &format.Splitter},
+		{name: compressionFlag, supported: executor.SupportedCompressions, value: &format.Compression},
+	} {
+		value, err := cmd.Flags().GetString(flag.name)
+		if err != nil {
+			return format, err
+		}
+		if len(value) > 0 && !slices.Contains(flag.supported, value) {
+			return format, fmt.Errorf("unsupported value for --%s: %s", flag.name, value)
+		}
+		if len(value) > 0 {
+			*flag.value = value
+		}
+	}
+
+	return format, nil
+}
+
+func newRepoMaintenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Run the Kopia maintenance now, regardless of the schedule",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+
+			full, err := cmd.Flags().GetBool(fullFlag)
+			if err != nil {
+				return err
+			}
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			repository, err := archive.openRepository(ctx)
+			if err != nil {
+				return err
+			}
+
+			maintenance := executor.NewMaintenance(
+				repository,
+				executor.MaintenanceSchedule{},
+				storage.GetMaintenanceStatusFilePath(archive.clusterName),
+				storage.GetMaintenanceLockFilePath(archive.clusterName),
+			)
+			if err := maintenance.Run(ctx, full); err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Maintenance of cluster %s completed\n", archive.clusterName)
+			return nil
+		},
+	}
+	cmd.Flags().Bool(fullFlag, false, "Run the full maintenance, reclaiming the space of the deleted snapshots")
+
+	return cmd
+}
@@ -0,0 +1,277 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"github.com/spf13/cobra"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/catalog"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+const dryRunFlag = "dry-run"
+
+// walSegmentNameLength is the length of the name of a WAL segment,
+// made of the timeline, the log and the segment numbers
+const walSegmentNameLength = 24
+
+// errNoBackups is returned when pruning the WAL files of a
+// cluster without backups, as every WAL file may be needed
+var errNoBackups = errors.New("the catalog contains no backups, every WAL file is needed")
+
+// errUncatalogedSnapshots is returned when pruning the WAL files of a
+// cluster whose repository contains snapshots of backups that are not
+// in the catalog, as their WAL files may precede the oldest backup
+var errUncatalogedSnapshots = errors.New(
+	"the repository contains snapshots of backups that are not in the catalog, whose WAL files may be needed")
+
+// walStatus is the content of the WAL archive of a cluster
+type walStatus struct {
+	FirstWal   string `json:"firstWal,omitempty"`
+	LastWal    string `json:"lastWal,omitempty"`
+	Count      int    `json:"count"`
+	TotalBytes int64  `json:"totalBytes"`
+}
+
+// NewWALCmd creates the "wal" command, managing the
+// WAL archive of a cluster
+func NewWALCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wal",
+		Short: "Inspect and manage the WAL archive of a cluster",
+	}
+	addClusterFlag(cmd)
+
+	cmd.AddCommand(
+		newWALStatusCmd(),
+		newWALPruneCmd(),
+	)
+
+	return cmd
+}
+
+func newWALStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the content of the WAL archive",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			output, err := getOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			walObjects, err := archive.backend.List(cmd.Context(), storage.GetWALPrefixKey(archive.clusterName))
+			if err != nil {
+				return err
+			}
+
+			// WAL objects are listed in lexicographical order, which
+			// is also the order in which they were generated
+			var status walStatus
+			if len(walObjects) > 0 {
+				status.FirstWal = path.Base(walObjects[0].Key)
+				status.LastWal = path.Base(walObjects[len(walObjects)-1].Key)
+			}
+			status.Count = len(walObjects)
+			for _, object := range walObjects {
+				status.TotalBytes += object.Size
+			}
+
+			if output == outputJSON {
+				return printJSON(cmd.OutOrStdout(), status)
+			}
+
+			_, _ = fmt.Fprintf(
+				cmd.OutOrStdout(),
+				"First WAL: %s\nLast WAL: %s\nWAL files: %d\nTotal size: %d bytes\n",
+				status.FirstWal,
+				status.LastWal,
+				status.Count,
+				status.TotalBytes,
+			)
+			return nil
+		},
+	}
+	addOutputFlag(cmd)
+
+	return cmd
+}
+
+func newWALPruneCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the WAL files older than the oldest backup in the catalog",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			contextLogger := logging.FromContext(ctx)
+
+			dryRun, err := cmd.Flags().GetBool(dryRunFlag)
+			if err != nil {
+				return err
+			}
+
+			archive, err := newArchive(cmd)
+			if err != nil {
+				return err
+			}
+
+			// The backup being taken is not in the catalog yet,
+			// and its WAL files must not be removed
+			if !dryRun {
+				release, err := acquireBackupLock(ctx, archive.clusterName, "prune WAL files")
+				if err != nil {
+					return err
+				}
+				defer release()
+			}
+
+			entries, err := archive.catalog.ListCompleted(ctx)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				return errNoBackups
+			}
+			if err := checkUncatalogedSnapshots(ctx, archive, entries); err != nil {
+				return err
+			}
+			oldestBeginWal := entries[0].BeginWal
+			for _, entry := range entries[1:] {
+				if walSegmentPosition(entry.BeginWal) < walSegmentPosition(oldestBeginWal) {
+					oldestBeginWal = entry.BeginWal
+				}
+			}
+
+			walObjects, err := archive.backend.List(ctx, storage.GetWALPrefixKey(archive.clusterName))
+			if err != nil {
+				return err
+			}
+
+			var removed int
+			var removedBytes int64
+			for _, object := range walObjects {
+				walName := path.Base(object.Key)
+				if !isPrunable(walName, oldestBeginWal) {
+					continue
+				}
+
+				if dryRun {
+					_, _ = fmt.Fprintln(cmd.OutOrStdout(), walName)
+				} else {
+					contextLogger.V(4).Info("Removing WAL file", "walName", walName)
+					if err := archive.backend.Delete(ctx, object.Key); err != nil {
+						return fmt.Errorf("while removing WAL file %s: %w", walName, err)
+					}
+				}
+				removed++
+				removedBytes += object.Size
+			}
+
+			verb := "Removed"
+			if dryRun {
+				verb = "Would remove"
+			} else if removed > 0 {
+				archive.newEventRecorder(ctx).WALsPruned(archive.cluster, removed, removedBytes, oldestBeginWal)
+			}
+			_, _ = fmt.Fprintf(
+				cmd.OutOrStdout(),
+				"%s %d WAL files (%d bytes) older than %s\n",
+				verb,
+				removed,
+				removedBytes,
+				oldestBeginWal,
+			)
+			return nil
+		},
+	}
+	cmd.Flags().Bool(dryRunFlag, false, "Only print the WAL files that would be removed")
+
+	return cmd
+}
+
+// checkUncatalogedSnapshots checks that every snapshot in the repository
+// belongs to a completed backup in the catalog, as the cutoff of the
+// WAL files to be pruned is computed from the catalog only
+func checkUncatalogedSnapshots(ctx context.Context, archive *archive, entries []catalog.Entry) error {
+	repository, err := archive.openRepository(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := repository.ListBackupSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		delete(snapshots, entries[i].BackupName)
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	backupNames := make([]string, 0, len(snapshots))
+	for backupName := range snapshots {
+		backupNames = append(backupNames, backupName)
+	}
+	slices.Sort(backupNames)
+
+	return fmt.Errorf("%w: %s", errUncatalogedSnapshots, strings.Join(backupNames, ", "))
+}
+
+// walSegmentPosition gets the log and segment numbers of a WAL file
+// name, which identify its position in the WAL stream regardless of
+// the timeline
+func walSegmentPosition(walName string) string {
+	if len(walName) < walSegmentNameLength {
+		return ""
+	}
+
+	return walName[8:walSegmentNameLength]
+}
+
+// isPrunable checks if a WAL file is not needed to restore any backup,
+// as it precedes the first WAL file of the oldest one. The timeline
+// history files are always kept, as they are needed to follow the
+// timeline switches while recovering
+func isPrunable(walName string, oldestBeginWal string) bool {
+	if strings.HasSuffix(walName, ".history") {
+		return false
+	}
+
+	position := walSegmentPosition(walName)
+	if len(position) == 0 {
+		return false
+	}
+
+	return position < walSegmentPosition(oldestBeginWal)
+}
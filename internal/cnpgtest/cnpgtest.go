@@ -0,0 +1,50 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnpgtest
+
+import (
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Namespace is the namespace of the test objects
+	Namespace = "default"
+
+	// ClusterName is the name of the test Cluster
+	ClusterName = "cluster-example"
+
+	// BackupName is the name of the test Backup
+	BackupName = "backup-example"
+)
+
+// NewCluster creates the Cluster the test objects belong to
+func NewCluster() *apiv1.Cluster {
+	return &apiv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: ClusterName, Namespace: Namespace, UID: "cluster-uid"},
+	}
+}
+
+// NewBackup creates a Backup of the test Cluster
+func NewBackup() *apiv1.Backup {
+	return &apiv1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: BackupName, Namespace: Namespace, UID: "backup-uid"},
+		Spec: apiv1.BackupSpec{
+			Cluster: apiv1.LocalObjectReference{Name: ClusterName},
+		},
+	}
+}
@@ -0,0 +1,772 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+// The names of the plugin parameters
+const (
+	ImageParameter           = "image"
+	ImagePullPolicyParameter = "imagePullPolicy"
+	PVCParameter             = "pvc"
+	PreviousPVCParameter     = "previousPVC"
+	SecretNameParameter      = "secretName"
+	SecretKeyParameter       = "secretKey"
+	NewSecretKeyParameter    = "newSecretKey"
+
+	StorageBackendParameter      = "storageBackend"
+	S3BucketParameter            = "s3Bucket"
+	S3PrefixParameter            = "s3Prefix"
+	S3EndpointParameter          = "s3Endpoint"
+	S3RegionParameter            = "s3Region"
+	S3CredentialsSecretParameter = "s3CredentialsSecret"
+	S3CASecretParameter          = "s3CASecret"
+
+	KopiaEncryptionParameter  = "kopiaEncryption"
+	KopiaHashParameter        = "kopiaHash"
+	KopiaSplitterParameter    = "kopiaSplitter"
+	KopiaCompressionParameter = "kopiaCompression"
+
+	MaintenanceQuickIntervalParameter = "maintenanceQuickInterval"
+	MaintenanceFullIntervalParameter  = "maintenanceFullInterval"
+
+	BackupConcurrencyParameter = "backupConcurrency"
+	BackupUploadRateParameter  = "backupUploadRate"
+	BackupParallelismParameter = "backupParallelism"
+	WALArchiveRateParameter    = "walArchiveRate"
+
+	SpaceWarningThresholdParameter  = "spaceWarningThreshold"
+	SpaceCriticalThresholdParameter = "spaceCriticalThreshold"
+
+	PreBackupHooksParameter  = "preBackupHooks"
+	PostBackupHooksParameter = "postBackupHooks"
+
+	SidecarCPURequestParameter    = "sidecarCPURequest"
+	SidecarCPULimitParameter      = "sidecarCPULimit"
+	SidecarMemoryRequestParameter = "sidecarMemoryRequest"
+	SidecarMemoryLimitParameter   = "sidecarMemoryLimit"
+
+	PVCSizeParameter          = "pvcSize"
+	PVCStorageClassParameter  = "pvcStorageClass"
+	PVCAccessModeParameter    = "pvcAccessMode"
+	PVCReclaimPolicyParameter = "pvcReclaimPolicy"
+)
+
+// The default values of the optional parameters
+const (
+	DefaultImagePullPolicy          = corev1.PullAlways
+	DefaultMaintenanceQuickInterval = time.Hour
+	DefaultMaintenanceFullInterval  = 24 * time.Hour
+	DefaultBackupConcurrency        = 1
+	DefaultSpaceWarningThreshold    = 80
+	DefaultSpaceCriticalThreshold   = 95
+	DefaultHookTimeout              = time.Minute
+	DefaultPVCAccessMode            = corev1.ReadWriteOnce
+	DefaultPVCReclaimPolicy         = PVCReclaimPolicyRetain
+)
+
+// The values of the reclaim policy of the provisioned backup PVC
+const (
+	// PVCReclaimPolicyRetain leaves the backup PVC in place
+	// when the cluster is deleted
+	PVCReclaimPolicyRetain = "Retain"
+
+	// PVCReclaimPolicyDelete deletes the backup PVC
+	// together with the cluster
+	PVCReclaimPolicyDelete = "Delete"
+)
+
+// pvcNameSuffix is appended to the cluster name to get the
+// name of the provisioned backup PVC, when not specified
+const pvcNameSuffix = "-backups"
+
+// knownParameters are the parameters accepted by the plugin. Any other
+// parameter is rejected, as it's most likely a typo
+var knownParameters = []string{
+	ImageParameter,
+	ImagePullPolicyParameter,
+	PVCParameter,
+	PreviousPVCParameter,
+	SecretNameParameter,
+	SecretKeyParameter,
+	NewSecretKeyParameter,
+	StorageBackendParameter,
+	S3BucketParameter,
+	S3PrefixParameter,
+	S3EndpointParameter,
+	S3RegionParameter,
+	S3CredentialsSecretParameter,
+	S3CASecretParameter,
+	KopiaEncryptionParameter,
+	KopiaHashParameter,
+	KopiaSplitterParameter,
+	KopiaCompressionParameter,
+	MaintenanceQuickIntervalParameter,
+	MaintenanceFullIntervalParameter,
+	BackupConcurrencyParameter,
+	BackupUploadRateParameter,
+	BackupParallelismParameter,
+	WALArchiveRateParameter,
+	SpaceWarningThresholdParameter,
+	SpaceCriticalThresholdParameter,
+	PreBackupHooksParameter,
+	PostBackupHooksParameter,
+	SidecarCPURequestParameter,
+	SidecarCPULimitParameter,
+	SidecarMemoryRequestParameter,
+	SidecarMemoryLimitParameter,
+	PVCSizeParameter,
+	PVCStorageClassParameter,
+	PVCAccessModeParameter,
+	PVCReclaimPolicyParameter,
+}
+
+// supportedPullPolicies are the accepted values of the image pull policy
+var supportedPullPolicies = []string{
+	string(corev1.PullAlways),
+	string(corev1.PullIfNotPresent),
+	string(corev1.PullNever),
+}
+
+// immutableParameters can't be changed once the cluster has been
+// created. The repository format is chosen when the repository is
+// created and cannot be changed later
+var immutableParameters = []string{
+	KopiaEncryptionParameter,
+	KopiaHashParameter,
+	KopiaSplitterParameter,
+}
+
+// pvcTemplateParameters can only be changed while migrating
+// the backups to a new PVC
+var pvcTemplateParameters = []string{
+	PVCStorageClassParameter,
+	PVCAccessModeParameter,
+}
+
+// supportedPVCAccessModes are the accepted access modes of the
+// provisioned backup PVC
+var supportedPVCAccessModes = []string{
+	string(corev1.ReadWriteOnce),
+	string(corev1.ReadWriteMany),
+	string(corev1.ReadWriteOncePod),
+}
+
+// Configuration is the plugin configuration, parsed from the parameters
+type Configuration struct {
+	// Image is the image of the sidecar
+	Image string
+
+	// ImagePullPolicy is the pull policy of the sidecar image
+	ImagePullPolicy corev1.PullPolicy
+
+	// PVCName is the name of the backup PVC. When empty, the name of
+	// the provisioned PVC is derived from the cluster name
+	PVCName string
+
+	// PVCTemplate is the template of the backup PVC provisioned by
+	// the plugin. When nil, the PVC must be created by the user
+	PVCTemplate *PVCTemplate
+
+	// PreviousPVCName is the name of the PVC the backups are being
+	// migrated from. It keeps receiving the WAL files until the
+	// migration has been completed, and is used to restore the
+	// backups taken before the migration
+	PreviousPVCName string
+
+	// SecretName is the name of the Secret holding the repository password
+	SecretName string
+
+	// SecretKey is the key of the Secret holding the repository password
+	SecretKey string
+
+	// NewSecretKey is the key of the Secret holding the password
+	// the repository should be moved to, if any
+	NewSecretKey string
+
+	// Storage selects where the WAL archive and the repository are kept
+	Storage storage.Options
+
+	// S3CredentialsSecret is the name of the Secret holding the S3 credentials
+	S3CredentialsSecret string
+
+	// S3CASecret is the name of the Secret holding the CA of the S3 endpoint
+	S3CASecret string
+
+	// Format contains the algorithms used by the repository
+	Format executor.RepositoryFormat
+
+	// Maintenance is the schedule of the Kopia maintenance
+	Maintenance executor.MaintenanceSchedule
+
+	// BackupConcurrency is the number of snapshots taken at the same time
+	BackupConcurrency int
+
+	// Throttling contains the limits applied while taking a backup
+	Throttling executor.Throttling
+
+	// WALArchiveRate is the maximum number of bytes per second read
+	// and uploaded while archiving WAL files. Zero means unlimited
+	WALArchiveRate int64
+
+	// SpaceThresholds are the usage thresholds of the backup volume
+	SpaceThresholds executor.SpaceThresholds
+
+	// Hooks are the hooks run around a backup
+	Hooks executor.BackupHooks
+
+	// SidecarResources are the resources requested by the sidecar
+	SidecarResources corev1.ResourceRequirements
+
+	// parameters are the parameters the configuration was
+	// parsed from, used to detect changes
+	parameters map[string]string
+}
+
+// FromParameters parses the plugin parameters, applying the defaults.
+// Every invalid parameter is reported in the returned ValidationErrors.
+// Unknown parameters are ignored, so that a leftover or misspelled key
+// doesn't stop the backups or the creation of the Pods: they are
+// rejected by ValidateParameters when the cluster is validated
+func FromParameters(parameters map[string]string) (*Configuration, error) {
+	return parse(parameters, false)
+}
+
+// ValidateParameters parses the plugin parameters like FromParameters,
+// also rejecting the unknown parameters
+func ValidateParameters(parameters map[string]string) (*Configuration, error) {
+	return parse(parameters, true)
+}
+
+func parse(parameters map[string]string, strict bool) (*Configuration, error) {
+	p := &parser{parameters: parameters}
+	if strict {
+		p.checkUnknown()
+	}
+
+	result := &Configuration{
+		Image: p.getRequired(ImageParameter),
+		ImagePullPolicy: corev1.PullPolicy(
+			p.getEnum(ImagePullPolicyParameter, string(DefaultImagePullPolicy), supportedPullPolicies)),
+		PVCName:         p.get(PVCParameter),
+		PreviousPVCName: p.get(PreviousPVCParameter),
+		SecretName:      p.getRequired(SecretNameParameter),
+		SecretKey:       p.getRequired(SecretKeyParameter),
+		NewSecretKey:    p.get(NewSecretKeyParameter),
+		Format: executor.RepositoryFormat{
+			Encryption:  p.getEnum(KopiaEncryptionParameter, "", executor.SupportedEncryptions),
+			Hash:        p.getEnum(KopiaHashParameter, "", executor.SupportedHashes),
+			Splitter:    p.getEnum(KopiaSplitterParameter, "", executor.SupportedSplitters),
+			Compression: p.getEnum(KopiaCompressionParameter, "", executor.SupportedCompressions),
+		},
+		Maintenance: executor.MaintenanceSchedule{
+			QuickInterval: p.getDuration(MaintenanceQuickIntervalParameter, DefaultMaintenanceQuickInterval),
+			FullInterval:  p.getDuration(MaintenanceFullIntervalParameter, DefaultMaintenanceFullInterval),
+		},
+		BackupConcurrency: p.getPositiveInt(BackupConcurrencyParameter, DefaultBackupConcurrency),
+		Throttling: executor.Throttling{
+			UploadBytesPerSecond: p.getRate(BackupUploadRateParameter),
+			Parallelism:          p.getPositiveInt(BackupParallelismParameter, 0),
+		},
+		WALArchiveRate:  p.getRate(WALArchiveRateParameter),
+		SpaceThresholds: p.getSpaceThresholds(),
+		Hooks: executor.BackupHooks{
+			Pre:  p.getHooks(PreBackupHooksParameter),
+			Post: p.getHooks(PostBackupHooksParameter),
+		},
+		parameters: parameters,
+	}
+
+	if len(result.NewSecretKey) > 0 && result.NewSecretKey == result.SecretKey {
+		p.fail(NewSecretKeyParameter, "must be different from %s", SecretKeyParameter)
+	}
+
+	if len(result.PreviousPVCName) > 0 && result.PreviousPVCName == result.PVCName {
+		p.fail(PreviousPVCParameter, "must be different from %s", PVCParameter)
+	}
+
+	result.parseStorage(p)
+	result.parseSidecarResources(p)
+	result.parsePVCTemplate(p)
+
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+
+	return result, nil
+}
+
+// WALConfiguration is the part of the configuration used
+// to archive and restore the WAL files
+type WALConfiguration struct {
+	// Storage selects where the WAL archive is kept
+	Storage storage.Options
+
+	// PreviousPVCName is the name of the PVC the backups are being
+	// migrated from, if any
+	PreviousPVCName string
+
+	// WALArchiveRate is the maximum number of bytes per second read
+	// and uploaded while archiving WAL files. Zero means unlimited
+	WALArchiveRate int64
+
+	// SpaceThresholds are the usage thresholds of the backup volume
+	SpaceThresholds executor.SpaceThresholds
+}
+
+// WALFromParameters parses only the plugin parameters used to archive
+// and restore the WAL files, applying the defaults. An invalid parameter
+// unrelated to the WAL files, such as the hooks or the sidecar resources,
+// doesn't stop the WAL archiving
+func WALFromParameters(parameters map[string]string) (*WALConfiguration, error) {
+	p := &parser{parameters: parameters}
+
+	var storageConfiguration Configuration
+	storageConfiguration.parseStorage(p)
+	result := &WALConfiguration{
+		Storage:         storageConfiguration.Storage,
+		PreviousPVCName: p.get(PreviousPVCParameter),
+		WALArchiveRate:  p.getRate(WALArchiveRateParameter),
+		SpaceThresholds: p.getSpaceThresholds(),
+	}
+
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+
+	return result, nil
+}
+
+func (config *Configuration) parseStorage(p *parser) {
+	config.Storage.Type = storage.BackendType(p.getEnum(
+		StorageBackendParameter,
+		string(storage.BackendTypePVC),
+		[]string{string(storage.BackendTypePVC), string(storage.BackendTypeS3)},
+	))
+	if config.Storage.Type != storage.BackendTypeS3 {
+		return
+	}
+
+	config.S3CredentialsSecret = p.getRequired(S3CredentialsSecretParameter)
+	config.S3CASecret = p.get(S3CASecretParameter)
+	config.Storage.S3 = storage.S3Options{
+		Bucket:   p.getRequired(S3BucketParameter),
+		Prefix:   p.get(S3PrefixParameter),
+		Endpoint: p.getURL(S3EndpointParameter),
+		Region:   p.getWithDefault(S3RegionParameter, storage.DefaultS3Region),
+	}
+	if len(config.S3CASecret) > 0 {
+		config.Storage.S3.CAFile = path.Join(storage.S3CAMountPath, storage.S3CASecretKey)
+	}
+}
+
+// PVCTemplate is the template of the backup PVC provisioned by the plugin
+type PVCTemplate struct {
+	// Size is the requested size. It can be increased
+	// later, and the PVC will be expanded
+	Size resource.Quantity
+
+	// StorageClass is the storage class of the PVC. When
+	// empty, the default storage class is used
+	StorageClass string
+
+	// AccessMode is the access mode of the PVC
+	AccessMode corev1.PersistentVolumeAccessMode
+
+	// ReclaimPolicy is either PVCReclaimPolicyRetain or PVCReclaimPolicyDelete
+	ReclaimPolicy string
+}
+
+func (config *Configuration) parsePVCTemplate(p *parser) {
+	size := p.getQuantity(PVCSizeParameter)
+	if size == nil {
+		if len(config.PVCName) == 0 {
+			p.fail(PVCParameter, "cannot be empty unless %s is set", PVCSizeParameter)
+		}
+		for _, parameter := range []string{
+			PVCStorageClassParameter,
+			PVCAccessModeParameter,
+			PVCReclaimPolicyParameter,
+		} {
+			if len(p.get(parameter)) > 0 {
+				p.fail(parameter, "can only be set together with %s", PVCSizeParameter)
+			}
+		}
+		return
+	}
+
+	config.PVCTemplate = &PVCTemplate{
+		Size:         *size,
+		StorageClass: p.get(PVCStorageClassParameter),
+		AccessMode: corev1.PersistentVolumeAccessMode(
+			p.getEnum(PVCAccessModeParameter, string(DefaultPVCAccessMode), supportedPVCAccessModes)),
+		ReclaimPolicy: p.getEnum(
+			PVCReclaimPolicyParameter,
+			DefaultPVCReclaimPolicy,
+			[]string{PVCReclaimPolicyRetain, PVCReclaimPolicyDelete}),
+	}
+}
+
+// GetPVCName gets the name of the backup PVC of a cluster
+func (config *Configuration) GetPVCName(clusterName string) string {
+	if len(config.PVCName) > 0 {
+		return config.PVCName
+	}
+
+	return clusterName + pvcNameSuffix
+}
+
+func (config *Configuration) parseSidecarResources(p *parser) {
+	resources := []struct {
+		name             corev1.ResourceName
+		requestParameter string
+		limitParameter   string
+	}{
+		{
+			name:             corev1.ResourceCPU,
+			requestParameter: SidecarCPURequestParameter,
+			limitParameter:   SidecarCPULimitParameter,
+		},
+		{
+			name:             corev1.ResourceMemory,
+			requestParameter: SidecarMemoryRequestParameter,
+			limitParameter:   SidecarMemoryLimitParameter,
+		},
+	}
+
+	for _, spec := range resources {
+		request := p.getQuantity(spec.requestParameter)
+		limit := p.getQuantity(spec.limitParameter)
+
+		if request != nil {
+			if config.SidecarResources.Requests == nil {
+				config.SidecarResources.Requests = make(corev1.ResourceList)
+			}
+			config.SidecarResources.Requests[spec.name] = *request
+		}
+
+		if limit != nil {
+			if config.SidecarResources.Limits == nil {
+				config.SidecarResources.Limits = make(corev1.ResourceList)
+			}
+			config.SidecarResources.Limits[spec.name] = *limit
+		}
+
+		if request != nil && limit != nil && request.Cmp(*limit) > 0 {
+			p.fail(spec.requestParameter, "must not be greater than %s", spec.limitParameter)
+		}
+	}
+}
+
+// ValidateChange checks that the parameters that can't be changed
+// have the same value as in the previous parameters. The previous
+// parameters are not parsed, as they may have been accepted by an
+// older version of the plugin.
+// The backup PVC can only be changed by migrating the backups to
+// a new PVC, with the previous one named in previousPVC
+func (config *Configuration) ValidateChange(clusterName string, previousParameters map[string]string) error {
+	var result ValidationErrors
+	for _, parameter := range immutableParameters {
+		if config.parameters[parameter] != previousParameters[parameter] {
+			result = append(result, &FieldError{Parameter: parameter, Message: "cannot be changed"})
+		}
+	}
+
+	previousPVCName := previousParameters[PVCParameter]
+	if len(previousPVCName) == 0 {
+		previousPVCName = clusterName + pvcNameSuffix
+	}
+
+	if config.GetPVCName(clusterName) != previousPVCName {
+		if config.PreviousPVCName != previousPVCName {
+			result = append(result, &FieldError{
+				Parameter: PVCParameter,
+				Message: fmt.Sprintf(
+					"can only be changed by setting %s to %q to migrate the backups",
+					PreviousPVCParameter, previousPVCName),
+			})
+		}
+
+		// The new PVC is a different volume, whose template
+		// is unrelated to the one of the previous PVC
+		if len(result) > 0 {
+			return result
+		}
+		return nil
+	}
+
+	for _, parameter := range pvcTemplateParameters {
+		if config.parameters[parameter] != previousParameters[parameter] {
+			result = append(result, &FieldError{
+				Parameter: parameter,
+				Message: fmt.Sprintf(
+					"cannot be changed without migrating the backups to a new PVC, with %s",
+					PreviousPVCParameter),
+			})
+		}
+	}
+
+	// A PVC can be expanded but never shrunk
+	if previousSize, err := resource.ParseQuantity(previousParameters[PVCSizeParameter]); err == nil &&
+		config.PVCTemplate != nil && config.PVCTemplate.Size.Cmp(previousSize) < 0 {
+		result = append(result, &FieldError{
+			Parameter: PVCSizeParameter,
+			Message:   fmt.Sprintf("cannot be decreased from %s", previousSize.String()),
+		})
+	}
+
+	if len(result) > 0 {
+		return result
+	}
+
+	return nil
+}
+
+// parser reads the plugin parameters, collecting every error
+type parser struct {
+	parameters map[string]string
+	errors     ValidationErrors
+}
+
+func (p *parser) fail(parameter string, format string, args ...any) {
+	p.errors = append(p.errors, &FieldError{
+		Parameter: parameter,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *parser) checkUnknown() {
+	unknown := make([]string, 0)
+	for name := range p.parameters {
+		if !slices.Contains(knownParameters, name) {
+			unknown = append(unknown, name)
+		}
+	}
+
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		p.fail(name, "unknown parameter")
+	}
+}
+
+func (p *parser) get(parameter string) string {
+	return p.parameters[parameter]
+}
+
+func (p *parser) getWithDefault(parameter string, defaultValue string) string {
+	if value := p.parameters[parameter]; len(value) > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func (p *parser) getRequired(parameter string) string {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		p.fail(parameter, "cannot be empty")
+	}
+	return value
+}
+
+func (p *parser) getEnum(parameter string, defaultValue string, allowed []string) string {
+	value := p.getWithDefault(parameter, defaultValue)
+	if len(value) > 0 && !slices.Contains(allowed, value) {
+		p.fail(parameter, "must be one of %v", allowed)
+	}
+	return value
+}
+
+func (p *parser) getDuration(parameter string, defaultValue time.Duration) time.Duration {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	result, err := time.ParseDuration(value)
+	if err != nil || result < 0 {
+		p.fail(parameter, "must be a non-negative duration, i.e. 12h")
+		return defaultValue
+	}
+	return result
+}
+
+func (p *parser) getPositiveInt(parameter string, defaultValue int) int {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 1 {
+		p.fail(parameter, "must be a positive integer")
+		return defaultValue
+	}
+	return result
+}
+
+func (p *parser) getPercentage(parameter string, defaultValue int) int {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 1 || result > 100 {
+		p.fail(parameter, "must be an integer percentage between 1 and 100")
+		return defaultValue
+	}
+	return result
+}
+
+func (p *parser) getSpaceThresholds() executor.SpaceThresholds {
+	result := executor.SpaceThresholds{
+		Warning:  p.getPercentage(SpaceWarningThresholdParameter, DefaultSpaceWarningThreshold),
+		Critical: p.getPercentage(SpaceCriticalThresholdParameter, DefaultSpaceCriticalThreshold),
+	}
+	if result.Warning > result.Critical {
+		p.fail(SpaceWarningThresholdParameter, "must not be greater than %s", SpaceCriticalThresholdParameter)
+	}
+	return result
+}
+
+// getRate parses a number of bytes per second, expressed as
+// a Kubernetes quantity. Zero means unlimited
+func (p *parser) getRate(parameter string) int64 {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		return 0
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Sign() <= 0 {
+		p.fail(parameter, "must be a positive quantity of bytes per second, i.e. 50Mi")
+		return 0
+	}
+	return quantity.Value()
+}
+
+func (p *parser) getQuantity(parameter string) *resource.Quantity {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		return nil
+	}
+
+	result, err := resource.ParseQuantity(value)
+	if err != nil || result.Sign() <= 0 {
+		p.fail(parameter, "must be a positive quantity")
+		return nil
+	}
+	return &result
+}
+
+func (p *parser) getURL(parameter string) string {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		return ""
+	}
+
+	parsedURL, err := url.Parse(value)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || len(parsedURL.Host) == 0 {
+		p.fail(parameter, "must be an http or https URL")
+	}
+	return value
+}
+
+// hookSpec is how a hook is written in the plugin parameters
+type hookSpec struct {
+	Name           string   `json:"name"`
+	Command        []string `json:"command,omitempty"`
+	SQL            string   `json:"sql,omitempty"`
+	Database       string   `json:"database,omitempty"`
+	Timeout        string   `json:"timeout,omitempty"`
+	AbortOnFailure bool     `json:"abortOnFailure,omitempty"`
+}
+
+func (p *parser) getHooks(parameter string) []executor.Hook {
+	value := p.parameters[parameter]
+	if len(value) == 0 {
+		return nil
+	}
+
+	var specs []hookSpec
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&specs); err != nil {
+		p.fail(parameter, "must be a JSON list of hooks: %v", err)
+		return nil
+	}
+
+	result := make([]executor.Hook, 0, len(specs))
+	for i := range specs {
+		hook, err := specs[i].toHook()
+		if err != nil {
+			p.fail(parameter, "hook %d: %v", i, err)
+			continue
+		}
+		result = append(result, hook)
+	}
+	return result
+}
+
+func (spec *hookSpec) toHook() (executor.Hook, error) {
+	result := executor.Hook{
+		Name:           spec.Name,
+		Command:        spec.Command,
+		SQL:            spec.SQL,
+		Database:       spec.Database,
+		Timeout:        DefaultHookTimeout,
+		AbortOnFailure: spec.AbortOnFailure,
+	}
+
+	if len(spec.Name) == 0 {
+		return result, fmt.Errorf("missing name")
+	}
+
+	if (len(spec.Command) > 0) == (len(spec.SQL) > 0) {
+		return result, fmt.Errorf("exactly one of command and sql must be set")
+	}
+
+	if len(spec.Database) > 0 && len(spec.SQL) == 0 {
+		return result, fmt.Errorf("database can only be set for sql hooks")
+	}
+
+	if len(spec.Timeout) > 0 {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil || timeout <= 0 {
+			return result, fmt.Errorf("timeout must be a positive duration")
+		}
+		result.Timeout = timeout
+	}
+
+	return result, nil
+}
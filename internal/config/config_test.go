@@ -0,0 +1,449 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+// testParameters are the minimal parameters of a valid
+// configuration, together with the passed ones
+func testParameters(extra map[string]string) map[string]string {
+	result := map[string]string{
+		ImageParameter:      "plugin-pvc-backup:latest",
+		SecretNameParameter: "kopia",
+		SecretKeyParameter:  "password",
+		PVCParameter:        "cluster-backups",
+	}
+	for key, value := range extra {
+		result[key] = value
+	}
+
+	return result
+}
+
+// getInvalidParameters gets the names of the parameters
+// reported by a ValidationErrors
+func getInvalidParameters(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	result := make([]string, len(validationErrors))
+	for i := range validationErrors {
+		result[i] = validationErrors[i].Parameter
+	}
+	return result
+}
+
+func expectInvalidParameters(t *testing.T, err error, parameters ...string) {
+	t.Helper()
+
+	if invalid := getInvalidParameters(t, err); !slices.Equal(invalid, parameters) {
+		t.Errorf("expected invalid parameters %v, got %v (%v)", parameters, invalid, err)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	configuration, err := ValidateParameters(testParameters(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configuration.ImagePullPolicy != DefaultImagePullPolicy {
+		t.Errorf("expected the default pull policy, got %s", configuration.ImagePullPolicy)
+	}
+	if configuration.Storage.Type != storage.BackendTypePVC {
+		t.Errorf("expected the PVC storage, got %s", configuration.Storage.Type)
+	}
+	if configuration.Maintenance.QuickInterval != DefaultMaintenanceQuickInterval ||
+		configuration.Maintenance.FullInterval != DefaultMaintenanceFullInterval {
+		t.Errorf("expected the default maintenance schedule, got %+v", configuration.Maintenance)
+	}
+	if configuration.BackupConcurrency != DefaultBackupConcurrency {
+		t.Errorf("expected the default backup concurrency, got %d", configuration.BackupConcurrency)
+	}
+	if configuration.SpaceThresholds.Warning != DefaultSpaceWarningThreshold ||
+		configuration.SpaceThresholds.Critical != DefaultSpaceCriticalThreshold {
+		t.Errorf("expected the default space thresholds, got %+v", configuration.SpaceThresholds)
+	}
+	if configuration.PVCTemplate != nil {
+		t.Errorf("expected no PVC template, got %+v", configuration.PVCTemplate)
+	}
+}
+
+func TestParameterValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		invalid    []string
+		check      func(*Configuration) bool
+	}{
+		{
+			name:       "missing required parameters",
+			parameters: map[string]string{ImageParameter: "", SecretNameParameter: ""},
+			invalid:    []string{ImageParameter, SecretNameParameter},
+		},
+		{
+			name:       "pull policy is case sensitive",
+			parameters: map[string]string{ImagePullPolicyParameter: "always"},
+			invalid:    []string{ImagePullPolicyParameter},
+		},
+		{
+			name:       "valid pull policy",
+			parameters: map[string]string{ImagePullPolicyParameter: "IfNotPresent"},
+			check: func(configuration *Configuration) bool {
+				return configuration.ImagePullPolicy == corev1.PullIfNotPresent
+			},
+		},
+		{
+			name:       "unsupported enum value",
+			parameters: map[string]string{KopiaCompressionParameter: "rar"},
+			invalid:    []string{KopiaCompressionParameter},
+		},
+		{
+			name:       "valid duration",
+			parameters: map[string]string{MaintenanceQuickIntervalParameter: "30m"},
+			check: func(configuration *Configuration) bool {
+				return configuration.Maintenance.QuickInterval == 30*time.Minute
+			},
+		},
+		{
+			name: "invalid durations",
+			parameters: map[string]string{
+				MaintenanceQuickIntervalParameter: "hourly",
+				MaintenanceFullIntervalParameter:  "-1h",
+			},
+			invalid: []string{MaintenanceQuickIntervalParameter, MaintenanceFullIntervalParameter},
+		},
+		{
+			name:       "invalid positive integer",
+			parameters: map[string]string{BackupConcurrencyParameter: "0"},
+			invalid:    []string{BackupConcurrencyParameter},
+		},
+		{
+			name: "valid percentages",
+			parameters: map[string]string{
+				SpaceWarningThresholdParameter:  "70",
+				SpaceCriticalThresholdParameter: "100",
+			},
+			check: func(configuration *Configuration) bool {
+				return configuration.SpaceThresholds.Warning == 70 && configuration.SpaceThresholds.Critical == 100
+			},
+		},
+		{
+			name:       "percentage out of range",
+			parameters: map[string]string{SpaceCriticalThresholdParameter: "101"},
+			invalid:    []string{SpaceCriticalThresholdParameter},
+		},
+		{
+			name: "warning above critical",
+			parameters: map[string]string{
+				SpaceWarningThresholdParameter:  "90",
+				SpaceCriticalThresholdParameter: "85",
+			},
+			invalid: []string{SpaceWarningThresholdParameter},
+		},
+		{
+			name:       "valid rate",
+			parameters: map[string]string{BackupUploadRateParameter: "50Mi"},
+			check: func(configuration *Configuration) bool {
+				return configuration.Throttling.UploadBytesPerSecond == 50*1024*1024
+			},
+		},
+		{
+			name:       "invalid rates",
+			parameters: map[string]string{BackupUploadRateParameter: "fast", WALArchiveRateParameter: "0"},
+			invalid:    []string{BackupUploadRateParameter, WALArchiveRateParameter},
+		},
+		{
+			name: "sidecar resources",
+			parameters: map[string]string{
+				SidecarCPURequestParameter:    "100m",
+				SidecarMemoryRequestParameter: "128Mi",
+				SidecarMemoryLimitParameter:   "256Mi",
+			},
+			check: func(configuration *Configuration) bool {
+				return configuration.SidecarResources.Requests.Cpu().Equal(resource.MustParse("100m")) &&
+					configuration.SidecarResources.Limits.Memory().Equal(resource.MustParse("256Mi")) &&
+					configuration.SidecarResources.Limits.Cpu().IsZero()
+			},
+		},
+		{
+			name: "invalid quantities",
+			parameters: map[string]string{
+				SidecarCPURequestParameter:  "a lot",
+				SidecarCPULimitParameter:    "-1",
+				SidecarMemoryLimitParameter: "128Mi",
+			},
+			invalid: []string{SidecarCPURequestParameter, SidecarCPULimitParameter},
+		},
+		{
+			name: "request above limit",
+			parameters: map[string]string{
+				SidecarMemoryRequestParameter: "1Gi",
+				SidecarMemoryLimitParameter:   "512Mi",
+			},
+			invalid: []string{SidecarMemoryRequestParameter},
+		},
+		{
+			name: "valid S3 storage",
+			parameters: map[string]string{
+				StorageBackendParameter:      "s3",
+				S3BucketParameter:            "backups",
+				S3EndpointParameter:          "https://minio.example.com:9000",
+				S3CredentialsSecretParameter: "s3-credentials",
+				S3CASecretParameter:          "s3-ca",
+			},
+			check: func(configuration *Configuration) bool {
+				return configuration.Storage.Type == storage.BackendTypeS3 &&
+					configuration.Storage.S3.Endpoint == "https://minio.example.com:9000" &&
+					configuration.Storage.S3.Region == storage.DefaultS3Region &&
+					len(configuration.Storage.S3.CAFile) > 0
+			},
+		},
+		{
+			name: "invalid S3 storage",
+			parameters: map[string]string{
+				StorageBackendParameter: "s3",
+				S3EndpointParameter:     "minio:9000",
+			},
+			invalid: []string{S3CredentialsSecretParameter, S3BucketParameter, S3EndpointParameter},
+		},
+		{
+			name: "valid hooks",
+			parameters: map[string]string{
+				PreBackupHooksParameter:  `[{"name": "checkpoint", "sql": "CHECKPOINT", "timeout": "5m"}]`,
+				PostBackupHooksParameter: `[{"name": "notify", "command": ["/bin/notify"], "abortOnFailure": true}]`,
+			},
+			check: func(configuration *Configuration) bool {
+				return len(configuration.Hooks.Pre) == 1 &&
+					configuration.Hooks.Pre[0].Timeout == 5*time.Minute &&
+					len(configuration.Hooks.Post) == 1 &&
+					configuration.Hooks.Post[0].Timeout == DefaultHookTimeout &&
+					configuration.Hooks.Post[0].AbortOnFailure
+			},
+		},
+		{
+			name:       "hooks that are not JSON",
+			parameters: map[string]string{PreBackupHooksParameter: "CHECKPOINT"},
+			invalid:    []string{PreBackupHooksParameter},
+		},
+		{
+			name:       "hook with an unknown field",
+			parameters: map[string]string{PreBackupHooksParameter: `[{"name": "a", "sql": "SELECT 1", "user": "x"}]`},
+			invalid:    []string{PreBackupHooksParameter},
+		},
+		{
+			name: "invalid hooks",
+			parameters: map[string]string{
+				PreBackupHooksParameter: `[{"sql": "SELECT 1"}, {"name": "both", "sql": "SELECT 1", "command": ["true"]}, ` +
+					`{"name": "database", "command": ["true"], "database": "app"}, ` +
+					`{"name": "timeout", "sql": "SELECT 1", "timeout": "0s"}]`,
+			},
+			invalid: []string{
+				PreBackupHooksParameter,
+				PreBackupHooksParameter,
+				PreBackupHooksParameter,
+				PreBackupHooksParameter,
+			},
+		},
+		{
+			name:       "PVC template",
+			parameters: map[string]string{PVCParameter: "", PVCSizeParameter: "10Gi"},
+			check: func(configuration *Configuration) bool {
+				return configuration.PVCTemplate != nil &&
+					configuration.PVCTemplate.Size.Equal(resource.MustParse("10Gi")) &&
+					configuration.PVCTemplate.AccessMode == DefaultPVCAccessMode &&
+					configuration.PVCTemplate.ReclaimPolicy == DefaultPVCReclaimPolicy &&
+					configuration.GetPVCName("cluster-example") == "cluster-example-backups"
+			},
+		},
+		{
+			name: "PVC template parameters without a size",
+			parameters: map[string]string{
+				PVCParameter:              "",
+				PVCAccessModeParameter:    "ReadWriteMany",
+				PVCReclaimPolicyParameter: PVCReclaimPolicyDelete,
+			},
+			invalid: []string{PVCParameter, PVCAccessModeParameter, PVCReclaimPolicyParameter},
+		},
+		{
+			name:       "new secret key equal to the current one",
+			parameters: map[string]string{NewSecretKeyParameter: "password"},
+			invalid:    []string{NewSecretKeyParameter},
+		},
+		{
+			name:       "previous PVC equal to the current one",
+			parameters: map[string]string{PreviousPVCParameter: "cluster-backups"},
+			invalid:    []string{PreviousPVCParameter},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configuration, err := ValidateParameters(testParameters(test.parameters))
+			expectInvalidParameters(t, err, test.invalid...)
+			if err == nil && test.check != nil && !test.check(configuration) {
+				t.Errorf("unexpected configuration %+v", configuration)
+			}
+		})
+	}
+}
+
+func TestUnknownParameters(t *testing.T) {
+	parameters := testParameters(map[string]string{
+		"imagePullPolcy": "Always",
+		"legacy":         "true",
+	})
+
+	_, err := ValidateParameters(parameters)
+	expectInvalidParameters(t, err, "imagePullPolcy", "legacy")
+
+	if _, err := FromParameters(parameters); err != nil {
+		t.Errorf("expected the unknown parameters to be ignored, got %v", err)
+	}
+}
+
+func TestWALFromParameters(t *testing.T) {
+	// The parameters unrelated to the WAL files are not parsed
+	configuration, err := WALFromParameters(map[string]string{
+		WALArchiveRateParameter:  "1Mi",
+		PreBackupHooksParameter:  "not JSON",
+		SidecarCPULimitParameter: "a lot",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.Storage.Type != storage.BackendTypePVC || configuration.WALArchiveRate != 1024*1024 {
+		t.Errorf("unexpected configuration %+v", configuration)
+	}
+
+	_, err = WALFromParameters(map[string]string{
+		StorageBackendParameter: "s3",
+		WALArchiveRateParameter: "-1",
+	})
+	expectInvalidParameters(t, err, S3CredentialsSecretParameter, S3BucketParameter, WALArchiveRateParameter)
+}
+
+func TestValidateChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous map[string]string
+		current  map[string]string
+		invalid  []string
+	}{
+		{
+			name:     "unchanged",
+			previous: map[string]string{KopiaHashParameter: "BLAKE3-256"},
+			current:  map[string]string{KopiaHashParameter: "BLAKE3-256"},
+		},
+		{
+			name:     "repository format changed",
+			previous: map[string]string{KopiaHashParameter: "BLAKE3-256"},
+			current: map[string]string{
+				KopiaHashParameter:       "BLAKE2B-256",
+				KopiaEncryptionParameter: "CHACHA20-POLY1305-HMAC-SHA256",
+			},
+			invalid: []string{KopiaEncryptionParameter, KopiaHashParameter},
+		},
+		{
+			name:     "compression changed",
+			previous: nil,
+			current:  map[string]string{KopiaCompressionParameter: "zstd"},
+		},
+		{
+			name:     "PVC changed without migrating",
+			previous: map[string]string{PVCParameter: "old-backups"},
+			current:  map[string]string{PVCParameter: "new-backups"},
+			invalid:  []string{PVCParameter},
+		},
+		{
+			name:     "PVC changed migrating from another PVC",
+			previous: map[string]string{PVCParameter: "old-backups"},
+			current:  map[string]string{PVCParameter: "new-backups", PreviousPVCParameter: "other-backups"},
+			invalid:  []string{PVCParameter},
+		},
+		{
+			name:     "PVC migrated",
+			previous: map[string]string{PVCParameter: "old-backups"},
+			current:  map[string]string{PVCParameter: "new-backups", PreviousPVCParameter: "old-backups"},
+		},
+		{
+			name:     "provisioned PVC migrated",
+			previous: map[string]string{PVCParameter: "", PVCSizeParameter: "10Gi"},
+			current: map[string]string{
+				PVCParameter:         "new-backups",
+				PreviousPVCParameter: "cluster-example-backups",
+			},
+		},
+		{
+			name:     "PVC expanded",
+			previous: map[string]string{PVCSizeParameter: "10Gi"},
+			current:  map[string]string{PVCSizeParameter: "20Gi"},
+		},
+		{
+			name:     "PVC shrunk",
+			previous: map[string]string{PVCSizeParameter: "10Gi"},
+			current:  map[string]string{PVCSizeParameter: "5Gi"},
+			invalid:  []string{PVCSizeParameter},
+		},
+		{
+			name:     "PVC template changed without migrating",
+			previous: map[string]string{PVCSizeParameter: "10Gi"},
+			current:  map[string]string{PVCSizeParameter: "10Gi", PVCStorageClassParameter: "fast"},
+			invalid:  []string{PVCStorageClassParameter},
+		},
+		{
+			name:     "PVC template changed migrating to a new PVC",
+			previous: map[string]string{PVCSizeParameter: "10Gi"},
+			current: map[string]string{
+				PVCParameter:             "new-backups",
+				PreviousPVCParameter:     "cluster-backups",
+				PVCSizeParameter:         "5Gi",
+				PVCStorageClassParameter: "fast",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configuration, err := ValidateParameters(testParameters(test.current))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = configuration.ValidateChange("cluster-example", testParameters(test.previous))
+			expectInvalidParameters(t, err, test.invalid...)
+		})
+	}
+}
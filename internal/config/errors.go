@@ -0,0 +1,48 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is an invalid value of a plugin parameter
+type FieldError struct {
+	// Parameter is the name of the invalid parameter
+	Parameter string
+
+	// Message describes why the value is invalid
+	Message string
+}
+
+// Error implements the error interface
+func (err *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Parameter, err.Message)
+}
+
+// ValidationErrors are every error found while parsing the plugin parameters
+type ValidationErrors []*FieldError
+
+// Error implements the error interface
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i := range errs {
+		messages[i] = errs[i].Error()
+	}
+	return "invalid plugin parameters: " + strings.Join(messages, ", ")
+}
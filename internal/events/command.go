@@ -0,0 +1,84 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+)
+
+// commandEventRecorder is an EventRecorder sending each
+// Event to the Kubernetes API as soon as it's emitted
+type commandEventRecorder struct {
+	sink   record.EventSink
+	scheme *runtime.Scheme
+	source corev1.EventSource
+}
+
+// Event implements record.EventRecorder
+func (r *commandEventRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	r.AnnotatedEventf(object, nil, eventType, reason, "%s", message)
+}
+
+// Eventf implements record.EventRecorder
+func (r *commandEventRecorder) Eventf(
+	object runtime.Object,
+	eventType, reason, messageFmt string,
+	args ...interface{},
+) {
+	r.AnnotatedEventf(object, nil, eventType, reason, messageFmt, args...)
+}
+
+// AnnotatedEventf implements record.EventRecorder
+func (r *commandEventRecorder) AnnotatedEventf(
+	object runtime.Object,
+	annotations map[string]string,
+	eventType, reason, messageFmt string,
+	args ...interface{},
+) {
+	ref, err := reference.GetReference(r.scheme, object)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot emit the Event", reason, "for an unknown object:", err)
+		return
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace:   ref.Namespace,
+			Annotations: annotations,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        fmt.Sprintf(messageFmt, args...),
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+		Source:         r.source,
+	}
+	if _, err := r.sink.Create(event); err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot emit the Event", reason, ":", err)
+	}
+}
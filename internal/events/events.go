@@ -0,0 +1,186 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+// The reasons of the Events emitted by the plugin
+const (
+	ReasonBackupStarted      = "BackupStarted"
+	ReasonBackupCompleted    = "BackupCompleted"
+	ReasonBackupFailed       = "BackupFailed"
+	ReasonMigrationCompleted = "BackupPVCMigrationCompleted"
+	ReasonMigrationFailed    = "BackupPVCMigrationFailed"
+	ReasonWALArchiveFailed   = "WALArchiveFailed"
+	ReasonBackupPruned       = "BackupPruned"
+	ReasonWALsPruned         = "WALsPruned"
+)
+
+// Recorder emits the Events about the plugin activity through an
+// EventRecorder, that can be replaced by a fake one in tests.
+// A nil Recorder discards the Events
+type Recorder struct {
+	recorder record.EventRecorder
+}
+
+// NewRecorder creates a Recorder emitting the
+// Events through the passed EventRecorder
+func NewRecorder(recorder record.EventRecorder) *Recorder {
+	return &Recorder{recorder: recorder}
+}
+
+// NewEventRecorder creates an EventRecorder sending the
+// Events to the Kubernetes API described by restConfig
+func NewEventRecorder(restConfig *rest.Config) (record.EventRecorder, error) {
+	sink, scheme, err := newEventSink(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(sink)
+
+	return broadcaster.NewRecorder(scheme, getEventSource()), nil
+}
+
+// NewCommandEventRecorder creates an EventRecorder sending the Events to
+// the Kubernetes API described by restConfig before returning. It's meant
+// for commands that exit right after emitting the Events, which would be
+// lost if they were sent in the background
+func NewCommandEventRecorder(restConfig *rest.Config) (record.EventRecorder, error) {
+	sink, scheme, err := newEventSink(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commandEventRecorder{sink: sink, scheme: scheme, source: getEventSource()}, nil
+}
+
+// newEventSink creates the sink writing the Events to the Kubernetes API
+// described by restConfig, and the scheme used to refer to the objects
+func newEventSink(restConfig *rest.Config) (*typedcorev1.EventSinkImpl, *runtime.Scheme, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, nil, err
+	}
+	if err := apiv1.AddToScheme(scheme); err != nil {
+		return nil, nil, err
+	}
+
+	return &typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")}, scheme, nil
+}
+
+func getEventSource() corev1.EventSource {
+	// The hostname tells which instance emitted the Event
+	hostname, _ := os.Hostname()
+
+	return corev1.EventSource{
+		Component: metadata.Data.Name,
+		Host:      hostname,
+	}
+}
+
+// BackupStarted reports that a backup has been started
+func (r *Recorder) BackupStarted(cluster *apiv1.Cluster, backup *apiv1.Backup) {
+	message := fmt.Sprintf("Backup %s started", backup.Name)
+	r.event(cluster, corev1.EventTypeNormal, ReasonBackupStarted, message)
+	r.event(backup, corev1.EventTypeNormal, ReasonBackupStarted, message)
+}
+
+// BackupCompleted reports that a backup has been completed
+func (r *Recorder) BackupCompleted(
+	cluster *apiv1.Cluster,
+	backup *apiv1.Backup,
+	duration time.Duration,
+	sizeBytes int64,
+) {
+	message := fmt.Sprintf(
+		"Backup %s completed in %s, %d bytes backed up",
+		backup.Name, duration.Round(time.Second), sizeBytes)
+	r.event(cluster, corev1.EventTypeNormal, ReasonBackupCompleted, message)
+	r.event(backup, corev1.EventTypeNormal, ReasonBackupCompleted, message)
+}
+
+// BackupFailed reports that a backup has failed
+func (r *Recorder) BackupFailed(cluster *apiv1.Cluster, backup *apiv1.Backup, err error) {
+	message := fmt.Sprintf("Backup %s failed: %s", backup.Name, err.Error())
+	r.event(cluster, corev1.EventTypeWarning, ReasonBackupFailed, message)
+	r.event(backup, corev1.EventTypeWarning, ReasonBackupFailed, message)
+}
+
+// MigrationCompleted reports that the backups have been
+// migrated from the previous backup PVC
+func (r *Recorder) MigrationCompleted(cluster *apiv1.Cluster, previousPVCName string, backupName string) {
+	r.event(cluster, corev1.EventTypeNormal, ReasonMigrationCompleted, fmt.Sprintf(
+		"Backups migrated from PVC %s, verified with backup %s. The previous PVC can be detached",
+		previousPVCName, backupName))
+}
+
+// MigrationFailed reports that the backups could not be migrated
+// from the previous backup PVC. The migration is retried by the next backups
+func (r *Recorder) MigrationFailed(cluster *apiv1.Cluster, previousPVCName string, err error) {
+	r.event(cluster, corev1.EventTypeWarning, ReasonMigrationFailed, fmt.Sprintf(
+		"Cannot migrate the backups from PVC %s, the migration will be retried: %s",
+		previousPVCName, err.Error()))
+}
+
+// WALArchiveFailed reports that a WAL file could not be archived
+func (r *Recorder) WALArchiveFailed(cluster *apiv1.Cluster, walName string, err error) {
+	r.event(cluster, corev1.EventTypeWarning, ReasonWALArchiveFailed,
+		fmt.Sprintf("Cannot archive WAL file %s: %s", walName, err.Error()))
+}
+
+// BackupPruned reports that a backup has been deleted from the archive
+func (r *Recorder) BackupPruned(cluster *apiv1.Cluster, backupName string, snapshots int) {
+	r.event(cluster, corev1.EventTypeNormal, ReasonBackupPruned, fmt.Sprintf(
+		"Backup %s deleted from the archive, %d snapshots removed", backupName, snapshots))
+}
+
+// WALsPruned reports that the WAL files that are not needed
+// to restore any backup have been removed from the archive
+func (r *Recorder) WALsPruned(cluster *apiv1.Cluster, count int, sizeBytes int64, oldestBeginWal string) {
+	r.event(cluster, corev1.EventTypeNormal, ReasonWALsPruned, fmt.Sprintf(
+		"Removed %d WAL files (%d bytes) older than %s", count, sizeBytes, oldestBeginWal))
+}
+
+func (r *Recorder) event(object runtime.Object, eventType, reason, message string) {
+	if r == nil || r.recorder == nil {
+		return
+	}
+
+	r.recorder.Event(object, eventType, reason, message)
+}
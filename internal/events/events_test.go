@@ -0,0 +1,156 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/cnpgtest"
+)
+
+// expectEvents checks the Events recorded by a FakeRecorder, in order
+func expectEvents(t *testing.T, recorder *record.FakeRecorder, expected ...string) {
+	t.Helper()
+
+	for _, expectedEvent := range expected {
+		select {
+		case event := <-recorder.Events:
+			if event != expectedEvent {
+				t.Errorf("expected Event %q, got %q", expectedEvent, event)
+			}
+		default:
+			t.Fatalf("expected Event %q, got none", expectedEvent)
+		}
+	}
+
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("unexpected Event %q", event)
+	default:
+	}
+}
+
+func TestRecorderBackupEvents(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := NewRecorder(fakeRecorder)
+	cluster := cnpgtest.NewCluster()
+	backup := cnpgtest.NewBackup()
+
+	recorder.BackupStarted(cluster, backup)
+	expectEvents(t, fakeRecorder,
+		"Normal BackupStarted Backup backup-example started",
+		"Normal BackupStarted Backup backup-example started")
+
+	recorder.BackupCompleted(cluster, backup, 90*time.Second+400*time.Millisecond, 1024)
+	expectEvents(t, fakeRecorder,
+		"Normal BackupCompleted Backup backup-example completed in 1m30s, 1024 bytes backed up",
+		"Normal BackupCompleted Backup backup-example completed in 1m30s, 1024 bytes backed up")
+
+	recorder.BackupFailed(cluster, backup, errors.New("disk full"))
+	expectEvents(t, fakeRecorder,
+		"Warning BackupFailed Backup backup-example failed: disk full",
+		"Warning BackupFailed Backup backup-example failed: disk full")
+}
+
+func TestRecorderArchiveEvents(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := NewRecorder(fakeRecorder)
+	cluster := cnpgtest.NewCluster()
+
+	recorder.WALArchiveFailed(cluster, "000000010000000000000001", errors.New("disk full"))
+	expectEvents(t, fakeRecorder,
+		"Warning WALArchiveFailed Cannot archive WAL file 000000010000000000000001: disk full")
+
+	recorder.MigrationCompleted(cluster, "previous-backups", "backup-example")
+	expectEvents(t, fakeRecorder,
+		"Normal BackupPVCMigrationCompleted Backups migrated from PVC previous-backups, "+
+			"verified with backup backup-example. The previous PVC can be detached")
+
+	recorder.MigrationFailed(cluster, "previous-backups", errors.New("snapshot not found"))
+	expectEvents(t, fakeRecorder,
+		"Warning BackupPVCMigrationFailed Cannot migrate the backups from PVC previous-backups, "+
+			"the migration will be retried: snapshot not found")
+}
+
+func TestRecorderPruningEvents(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := NewRecorder(fakeRecorder)
+	cluster := cnpgtest.NewCluster()
+
+	recorder.BackupPruned(cluster, "backup-example", 2)
+	expectEvents(t, fakeRecorder,
+		"Normal BackupPruned Backup backup-example deleted from the archive, 2 snapshots removed")
+
+	recorder.WALsPruned(cluster, 3, 50331648, "000000010000000000000004")
+	expectEvents(t, fakeRecorder,
+		"Normal WALsPruned Removed 3 WAL files (50331648 bytes) older than 000000010000000000000004")
+}
+
+func TestNilRecorder(t *testing.T) {
+	var recorder *Recorder
+	recorder.BackupStarted(cnpgtest.NewCluster(), cnpgtest.NewBackup())
+	recorder.WALsPruned(nil, 3, 50331648, "000000010000000000000004")
+
+	NewRecorder(nil).BackupFailed(cnpgtest.NewCluster(), cnpgtest.NewBackup(), errors.New("disk full"))
+}
+
+func TestCommandEventRecorder(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	scheme := runtime.NewScheme()
+	if err := apiv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := NewRecorder(&commandEventRecorder{
+		sink:   &typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")},
+		scheme: scheme,
+		source: corev1.EventSource{Component: "plugin-pvc-backup"},
+	})
+	recorder.BackupPruned(cnpgtest.NewCluster(), "backup-example", 2)
+
+	// The Event has been sent before returning
+	eventList, err := clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eventList.Items) != 1 {
+		t.Fatalf("expected one Event, got %d", len(eventList.Items))
+	}
+
+	event := eventList.Items[0]
+	if event.InvolvedObject.Kind != apiv1.ClusterKind || event.InvolvedObject.Name != "cluster-example" ||
+		event.InvolvedObject.UID != "cluster-uid" {
+		t.Errorf("unexpected involved object %v", event.InvolvedObject)
+	}
+	if event.Type != corev1.EventTypeNormal || event.Reason != ReasonBackupPruned || event.Count != 1 {
+		t.Errorf("unexpected Event %v", event)
+	}
+	if event.Message != "Backup backup-example deleted from the archive, 2 snapshots removed" {
+		t.Errorf("unexpected message %q", event.Message)
+	}
+}
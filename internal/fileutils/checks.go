@@ -19,3 +19,16 @@ func IsDir(path string) (bool, error) {
 	}
 	return false, nil
 }
+
+// FileExists checks if a path points to an existing regular file
+func FileExists(path string) (bool, error) {
+	fileInfo, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return fileInfo.Mode().IsRegular(), nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const temporaryFilePattern = ".tmp-"
+
+// IsTemporaryFile checks if a file name has been generated by
+// WriteFileAtomic for a write that is still in progress
+func IsTemporaryFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, temporaryFilePattern)
+}
+
+// WriteFileAtomic writes the content read from the reader into the
+// destination file. The content is written into a temporary file
+// in the same directory and then renamed, so readers will either
+// see the previous content or the new one.
+// Creates any missing directories.
+func WriteFileAtomic(dst string, content io.Reader) (err error) {
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(dst)+temporaryFilePattern+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpFile.Name())
+		}
+	}()
+
+	const size = 1024 * 1024
+	buf := make([]byte, size)
+	if _, err = io.CopyBuffer(tmpFile, content, buf); err != nil {
+		return err
+	}
+
+	if err = tmpFile.Sync(); err != nil {
+		return err
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), dst)
+}
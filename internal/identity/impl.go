@@ -19,6 +19,7 @@ package identity
 import (
 	"context"
 
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
 	"github.com/cloudnative-pg/cnpg-i/pkg/identity"
 
 	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
@@ -27,6 +28,9 @@ import (
 // Implementation is the implementation of the identity service
 type Implementation struct {
 	identity.IdentityServer
+
+	// readinessChecks replaces the checks run by the probe, if set
+	readinessChecks []readinessCheck
 }
 
 // GetPluginMetadata implements the IdentityServer interface
@@ -69,8 +73,26 @@ func (Implementation) GetPluginCapabilities(
 	}, nil
 }
 
-// Probe implements the IdentityServer interface
-func (Implementation) Probe(context.Context, *identity.ProbeRequest) (*identity.ProbeResponse, error) {
+// Probe implements the IdentityServer interface. The plugin is ready
+// when Kopia can be run and, in the sidecar of an instance, when the
+// backup volume is writable, the repository password is available
+// and the instance can be reached
+func (impl Implementation) Probe(ctx context.Context, _ *identity.ProbeRequest) (*identity.ProbeResponse, error) {
+	checks := impl.readinessChecks
+	if checks == nil {
+		checks = getReadinessChecks()
+	}
+
+	if err := checkReadiness(ctx, checks); err != nil {
+		// The reason is logged too, as it would only be
+		// seen by the clients reading the response headers
+		logging.FromContext(ctx).Error(err, "Plugin not ready")
+		setNotReadyReason(ctx, err)
+		return &identity.ProbeResponse{
+			Ready: false,
+		}, nil
+	}
+
 	return &identity.ProbeResponse{
 		Ready: true,
 	}, nil
@@ -0,0 +1,112 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+)
+
+// probeTimeout is the maximum duration of the readiness checks
+const probeTimeout = 10 * time.Second
+
+// ProbeReasonHeader is the gRPC header carrying the reason why
+// the plugin is not ready, as the probe result has no field for it
+const ProbeReasonHeader = "x-cnpg-plugin-probe-reason"
+
+// InstanceSidecarEnvironment is set in the sidecar injected into the
+// instance Pods, to tell it apart from the plugin running alongside
+// the operator, that has no backup volume and no instance
+const InstanceSidecarEnvironment = "CNPG_PLUGIN_PVC_BACKUP_INSTANCE_SIDECAR"
+
+// readinessCheck is a check that must pass for the plugin to be ready
+type readinessCheck struct {
+	name  string
+	check func(context.Context) error
+}
+
+// readinessChecks are the checks run by the probe, in order
+var readinessChecks = []readinessCheck{
+	{
+		name:  "kopia",
+		check: executor.CheckKopia,
+	},
+}
+
+// instanceReadinessChecks are the checks run by the probe
+// in the sidecar of an instance, after readinessChecks
+var instanceReadinessChecks = []readinessCheck{
+	{
+		name: "backup volume",
+		check: func(context.Context) error {
+			return storage.CheckBackupVolume()
+		},
+	},
+	{
+		name:  "repository Secret",
+		check: executor.CheckRepositorySecret,
+	},
+	{
+		name:  "instance status endpoint",
+		check: executor.CheckInstanceStatusEndpoint,
+	},
+}
+
+// getReadinessChecks gets the checks to be run by the probe
+// of this plugin instance
+func getReadinessChecks() []readinessCheck {
+	if len(os.Getenv(InstanceSidecarEnvironment)) > 0 {
+		return append(slices.Clone(readinessChecks), instanceReadinessChecks...)
+	}
+
+	return readinessChecks
+}
+
+// checkReadiness runs every readiness check, and returns
+// an error with the reasons of the failed ones
+func checkReadiness(ctx context.Context, checks []readinessCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var result error
+	for _, readinessCheck := range checks {
+		if err := readinessCheck.check(ctx); err != nil {
+			result = errors.Join(result, fmt.Errorf("%s: %w", readinessCheck.name, err))
+		}
+	}
+
+	return result
+}
+
+// setNotReadyReason sends the reason why the plugin is
+// not ready in the headers of the gRPC response
+func setNotReadyReason(ctx context.Context, reason error) {
+	if err := grpc.SetHeader(ctx, metadata.Pairs(ProbeReasonHeader, reason.Error())); err != nil {
+		logging.FromContext(ctx).Error(err, "Error while setting the probe reason header")
+	}
+}
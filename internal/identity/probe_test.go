@@ -0,0 +1,158 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cloudnative-pg/cnpg-i/pkg/identity"
+)
+
+func newTestCheck(name string, err error) readinessCheck {
+	return readinessCheck{
+		name: name,
+		check: func(context.Context) error {
+			return err
+		},
+	}
+}
+
+func TestCheckReadiness(t *testing.T) {
+	tests := []struct {
+		name     string
+		checks   []readinessCheck
+		expected []string
+	}{
+		{
+			name: "every check passes",
+			checks: []readinessCheck{
+				newTestCheck("kopia", nil),
+				newTestCheck("backup volume", nil),
+			},
+		},
+		{
+			name: "a check fails",
+			checks: []readinessCheck{
+				newTestCheck("kopia", nil),
+				newTestCheck("backup volume", errors.New("not mounted")),
+			},
+			expected: []string{"backup volume: not mounted"},
+		},
+		{
+			name: "the reasons of every failed check are reported",
+			checks: []readinessCheck{
+				newTestCheck("kopia", errors.New("not found")),
+				newTestCheck("backup volume", errors.New("not mounted")),
+				newTestCheck("repository Secret", nil),
+			},
+			expected: []string{"kopia: not found", "backup volume: not mounted"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkReadiness(context.Background(), test.checks)
+			if len(test.expected) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if reason := strings.Split(err.Error(), "\n"); !slices.Equal(reason, test.expected) {
+				t.Errorf("expected reasons %q, got %q", test.expected, reason)
+			}
+		})
+	}
+}
+
+func TestCheckReadinessTimeout(t *testing.T) {
+	check := readinessCheck{
+		name: "slow",
+		check: func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				return errors.New("no deadline")
+			}
+			return nil
+		},
+	}
+
+	if err := checkReadiness(context.Background(), []readinessCheck{check}); err != nil {
+		t.Errorf("expected the checks to run with a deadline, got %v", err)
+	}
+}
+
+func TestGetReadinessChecks(t *testing.T) {
+	getNames := func() []string {
+		var result []string
+		for _, check := range getReadinessChecks() {
+			result = append(result, check.name)
+		}
+		return result
+	}
+
+	t.Setenv(InstanceSidecarEnvironment, "")
+	if names := getNames(); !slices.Equal(names, []string{"kopia"}) {
+		t.Errorf("expected only the kopia check outside of the instances, got %q", names)
+	}
+
+	t.Setenv(InstanceSidecarEnvironment, "true")
+	expected := []string{"kopia", "backup volume", "repository Secret", "instance status endpoint"}
+	if names := getNames(); !slices.Equal(names, expected) {
+		t.Errorf("expected the checks %q in the sidecar, got %q", expected, names)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "ready",
+			expected: true,
+		},
+		{
+			name: "not ready",
+			err:  errors.New("not mounted"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			impl := Implementation{
+				readinessChecks: []readinessCheck{newTestCheck("backup volume", test.err)},
+			}
+
+			response, err := impl.Probe(context.Background(), &identity.ProbeRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Ready != test.expected {
+				t.Errorf("expected ready to be %v, got %v", test.expected, response.Ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+
+	"github.com/cloudnative-pg/cnpg-i/pkg/identity"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing"
+)
+
+// tracedImplementation is the identity service whose calls are traced.
+// The plugin helper registers the identity service on its own, so
+// its description can't be wrapped like the one of the other services
+type tracedImplementation struct {
+	identity.IdentityServer
+}
+
+// Traced gets the identity service exporting the traces of its calls
+func (impl Implementation) Traced() identity.IdentityServer {
+	return tracedImplementation{IdentityServer: impl}
+}
+
+// GetPluginMetadata implements the IdentityServer interface
+func (impl tracedImplementation) GetPluginMetadata(
+	ctx context.Context,
+	req *identity.GetPluginMetadataRequest,
+) (*identity.GetPluginMetadataResponse, error) {
+	return tracing.UnaryServerCall(
+		ctx, identity.Identity_GetPluginMetadata_FullMethodName, req, impl.IdentityServer.GetPluginMetadata)
+}
+
+// GetPluginCapabilities implements the IdentityServer interface
+func (impl tracedImplementation) GetPluginCapabilities(
+	ctx context.Context,
+	req *identity.GetPluginCapabilitiesRequest,
+) (*identity.GetPluginCapabilitiesResponse, error) {
+	return tracing.UnaryServerCall(
+		ctx, identity.Identity_GetPluginCapabilities_FullMethodName, req, impl.IdentityServer.GetPluginCapabilities)
+}
+
+// Probe implements the IdentityServer interface
+func (impl tracedImplementation) Probe(
+	ctx context.Context,
+	req *identity.ProbeRequest,
+) (*identity.ProbeResponse, error) {
+	return tracing.UnaryServerCall(ctx, identity.Identity_Probe_FullMethodName, req, impl.IdentityServer.Probe)
+}
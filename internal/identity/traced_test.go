@@ -0,0 +1,58 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudnative-pg/cnpg-i/pkg/identity"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing/tracingtest"
+)
+
+func TestTracedProbe(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	impl := Implementation{
+		readinessChecks: []readinessCheck{
+			{
+				name: "kopia",
+				check: func(ctx context.Context) error {
+					if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+						t.Error("expected the checks to run inside the span of the call")
+					}
+					return nil
+				},
+			},
+		},
+	}
+
+	response, err := impl.Traced().Probe(context.Background(), &identity.ProbeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Ready {
+		t.Error("expected the plugin to be ready")
+	}
+
+	span := tracingtest.FindSpan(t, recorder, "cnpgi.identity.v1.Identity/Probe")
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("unexpected span kind %v", span.SpanKind())
+	}
+}
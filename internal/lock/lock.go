@@ -0,0 +1,288 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+)
+
+// ErrLocked is returned when the lock is held by someone else
+var ErrLocked = errors.New("lock already held")
+
+// content is what is written inside the lock file
+type content struct {
+	// Owner is a description of who is holding the lock
+	Owner string `json:"owner"`
+
+	// Token identifies this specific acquisition of the lock
+	Token string `json:"token"`
+
+	// AcquiredAt is the time when the lock was acquired
+	AcquiredAt time.Time `json:"acquiredAt"`
+}
+
+// Lock is a lock held by this process. The lock file is
+// refreshed periodically, so other processes can detect when
+// its holder died without releasing it
+type Lock struct {
+	path  string
+	token string
+
+	// afterStaleCheck, when set, is invoked after the lock file was found
+	// to be stale and before it is removed, so that the tests can simulate
+	// a concurrent takeover
+	afterStaleCheck func()
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Acquire tries to acquire the lock stored in the passed path, failing
+// with ErrLocked if it is held by someone else. A lock that was not refreshed
+// since staleTimeout is considered abandoned and is taken over
+func Acquire(ctx context.Context, path string, owner string, staleTimeout time.Duration) (*Lock, error) {
+	result := &Lock{path: path}
+	if err := result.acquire(ctx, owner, staleTimeout); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (lock *Lock) acquire(ctx context.Context, owner string, staleTimeout time.Duration) error {
+	contextLogger := logging.FromContext(ctx).WithValues("lockPath", lock.path)
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	lockContent, err := json.Marshal(content{
+		Owner:      owner,
+		Token:      token,
+		AcquiredAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(lock.path), 0o750); err != nil {
+		return err
+	}
+
+	err = create(lock.path, lockContent)
+	if errors.Is(err, os.ErrExist) {
+		var stale bool
+		stale, err = lock.removeIfStale(ctx, staleTimeout)
+		if err != nil {
+			return err
+		}
+		if !stale {
+			return heldError(lock.path)
+		}
+
+		contextLogger.Info("Took over stale lock")
+		err = create(lock.path, lockContent)
+	}
+	if errors.Is(err, os.ErrExist) {
+		// Someone else took over the stale lock before us
+		return heldError(lock.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	lock.token = token
+	lock.stop = make(chan struct{})
+	lock.done = make(chan struct{})
+	go lock.refresh(ctx, staleTimeout/4)
+
+	return nil
+}
+
+// Release releases the lock. Releasing a lock that was taken
+// over by someone else is not an error
+func (lock *Lock) Release() error {
+	close(lock.stop)
+	<-lock.done
+
+	current, err := read(lock.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if current.Token != lock.token {
+		return nil
+	}
+
+	err = os.Remove(lock.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// refresh updates the modification time of the lock file
+// until the lock is released
+func (lock *Lock) refresh(ctx context.Context, interval time.Duration) {
+	contextLogger := logging.FromContext(ctx).WithValues("lockPath", lock.path)
+	defer close(lock.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lock.stop:
+			return
+
+		case <-ticker.C:
+			now := time.Now()
+			if err := os.Chtimes(lock.path, now, now); err != nil {
+				contextLogger.Error(err, "Error while refreshing lock")
+			}
+		}
+	}
+}
+
+func create(path string, lockContent []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) // nolint:gosec
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(lockContent); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return err
+	}
+
+	return file.Close()
+}
+
+func read(path string) (*content, error) {
+	data, err := os.ReadFile(path) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	var result content
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("while decoding lock file %s: %w", path, err)
+	}
+
+	return &result, nil
+}
+
+// removeIfStale removes the lock file if it was not refreshed since
+// staleTimeout, returning true if the lock was stale
+func (lock *Lock) removeIfStale(ctx context.Context, staleTimeout time.Duration) (bool, error) {
+	contextLogger := logging.FromContext(ctx).WithValues("lockPath", lock.path)
+
+	info, err := os.Stat(lock.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if time.Since(info.ModTime()) < staleTimeout {
+		return false, nil
+	}
+	if lock.afterStaleCheck != nil {
+		lock.afterStaleCheck()
+	}
+
+	// We move the stale lock away before removing it, so that only
+	// one of the processes detecting it as stale will remove it
+	stalePath := fmt.Sprintf("%s.stale-%d", lock.path, time.Now().UnixNano())
+	if err := os.Rename(lock.path, stalePath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	// Between the stat and the rename, another process may have taken
+	// over the same stale lock and created a fresh one, which is what
+	// we moved away. In that case we put it back, as it is held
+	movedInfo, err := os.Stat(stalePath)
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(info, movedInfo) || !info.ModTime().Equal(movedInfo.ModTime()) {
+		contextLogger.Info("The lock was taken over while removing it, restoring it")
+		return false, restore(stalePath, lock.path)
+	}
+
+	if current, err := read(stalePath); err == nil {
+		contextLogger.Info(
+			"Removing stale lock",
+			"owner", current.Owner,
+			"acquiredAt", current.AcquiredAt,
+			"lastRefresh", info.ModTime())
+	}
+
+	return true, os.Remove(stalePath)
+}
+
+// restore moves back a lock that was moved away by mistake. The
+// lock is linked back, so a lock created in the meantime is never
+// replaced
+func restore(stalePath string, path string) error {
+	if err := os.Link(stalePath, path); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	return os.Remove(stalePath)
+}
+
+// heldError creates an error describing who is holding the lock
+func heldError(path string) error {
+	current, err := read(path)
+	if err != nil {
+		return ErrLocked
+	}
+
+	return fmt.Errorf(
+		"%w by %s since %s",
+		ErrLocked,
+		current.Owner,
+		current.AcquiredAt.Format(time.RFC3339))
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
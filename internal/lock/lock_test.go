@@ -0,0 +1,130 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testStaleTimeout = time.Minute
+
+// makeStale makes a lock file look abandoned by its holder
+func makeStale(t *testing.T, path string) {
+	t.Helper()
+
+	past := time.Now().Add(-2 * testStaleTimeout)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireHeldLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "lock")
+
+	first, err := Acquire(ctx, path, "first", testStaleTimeout)
+	if err != nil {
+		t.Fatalf("acquiring a free lock: %v", err)
+	}
+
+	if _, err := Acquire(ctx, path, "second", testStaleTimeout); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked acquiring a held lock, got %v", err)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := Acquire(ctx, path, "second", testStaleTimeout)
+	if err != nil {
+		t.Fatalf("acquiring a released lock: %v", err)
+	}
+	if err := second.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireStaleLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "lock")
+
+	if _, err := Acquire(ctx, path, "dead", testStaleTimeout); err != nil {
+		t.Fatal(err)
+	}
+	makeStale(t, path)
+
+	lock, err := Acquire(ctx, path, "alive", testStaleTimeout)
+	if err != nil {
+		t.Fatalf("taking over a stale lock: %v", err)
+	}
+
+	current, err := read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Owner != "alive" {
+		t.Fatalf("expected the lock to be owned by the new holder, got %s", current.Owner)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireStaleLockTakenOverConcurrently(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "lock")
+
+	if _, err := Acquire(ctx, path, "dead", testStaleTimeout); err != nil {
+		t.Fatal(err)
+	}
+	makeStale(t, path)
+
+	// Another process takes over the stale lock after we checked it
+	var other *Lock
+	late := &Lock{
+		path: path,
+		afterStaleCheck: func() {
+			var err error
+			if other, err = Acquire(ctx, path, "other", testStaleTimeout); err != nil {
+				t.Errorf("concurrent takeover: %v", err)
+			}
+		},
+	}
+	if err := late.acquire(ctx, "late", testStaleTimeout); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked after a concurrent takeover, got %v", err)
+	}
+
+	current, err := read(path)
+	if err != nil {
+		t.Fatalf("the lock taken over concurrently was lost: %v", err)
+	}
+	if current.Owner != "other" {
+		t.Fatalf("expected the lock to be owned by the concurrent holder, got %s", current.Owner)
+	}
+
+	if other != nil {
+		if err := other.Release(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
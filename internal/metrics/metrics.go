@@ -0,0 +1,363 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cnpg_plugin_pvc_backup"
+
+// DefaultPort is the port where the metrics are published by default
+const DefaultPort = 9188
+
+const (
+	clusterLabel    = "cluster"
+	tablespaceLabel = "tablespace"
+)
+
+// Registry is the registry containing every metric of the plugin
+var Registry = prometheus.NewRegistry()
+
+var (
+	backupProgressHashedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_progress",
+		Name:      "hashed_bytes",
+		Help:      "Bytes read and hashed by the running snapshot",
+	}, []string{clusterLabel, tablespaceLabel})
+
+	backupProgressCachedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_progress",
+		Name:      "cached_bytes",
+		Help:      "Bytes found unchanged since the previous snapshot by the running snapshot",
+	}, []string{clusterLabel, tablespaceLabel})
+
+	backupProgressUploadedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_progress",
+		Name:      "uploaded_bytes",
+		Help:      "Bytes written to the repository by the running snapshot",
+	}, []string{clusterLabel, tablespaceLabel})
+
+	backupProgressEstimatedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_progress",
+		Name:      "estimated_bytes",
+		Help:      "Estimated size of the data to be processed by the running snapshot",
+	}, []string{clusterLabel, tablespaceLabel})
+
+	backupProgressFiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_progress",
+		Name:      "files",
+		Help:      "Files processed, either hashed or cached, by the running snapshot",
+	}, []string{clusterLabel, tablespaceLabel})
+
+	backupVolumeSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_volume",
+		Name:      "size_bytes",
+		Help:      "Size of the volume where the backups are stored",
+	}, []string{clusterLabel})
+
+	backupVolumeAvailableBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_volume",
+		Name:      "available_bytes",
+		Help:      "Space that can still be written in the volume where the backups are stored",
+	}, []string{clusterLabel})
+
+	backupVolumeClusterUsedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_volume",
+		Name:      "cluster_used_bytes",
+		Help:      "Space used by the backups and the WAL archive of the cluster",
+	}, []string{clusterLabel})
+
+	backupVolumeEstimatedBackupBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup_volume",
+		Name:      "estimated_backup_bytes",
+		Help:      "Space the last backup was estimated to need before being started",
+	}, []string{clusterLabel})
+
+	walArchiveTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wal_archive",
+		Name:      "total",
+		Help:      "WAL files whose archiving was requested",
+	}, []string{clusterLabel})
+
+	walArchiveFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wal_archive",
+		Name:      "failures_total",
+		Help:      "WAL files that could not be archived",
+	}, []string{clusterLabel})
+
+	walArchiveBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wal_archive",
+		Name:      "bytes_total",
+		Help:      "Bytes of the WAL files archived",
+	}, []string{clusterLabel})
+
+	walArchiveDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "wal_archive",
+		Name:      "duration_seconds",
+		Help:      "Time taken to archive a WAL file",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{clusterLabel})
+
+	walArchiveLastSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "wal_archive",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time when the last WAL file was archived, in seconds since the epoch",
+	}, []string{clusterLabel})
+
+	walRestoreTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wal_restore",
+		Name:      "total",
+		Help:      "WAL files whose restore was requested",
+	}, []string{clusterLabel})
+
+	walRestoreFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wal_restore",
+		Name:      "failures_total",
+		Help:      "WAL files that could not be restored, excluding the ones not in the archive",
+	}, []string{clusterLabel})
+
+	walRestoreDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "wal_restore",
+		Name:      "duration_seconds",
+		Help:      "Time taken to restore a WAL file",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{clusterLabel})
+
+	backupInProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup",
+		Name:      "in_progress",
+		Help:      "1 while a backup of the cluster is running, 0 otherwise",
+	}, []string{clusterLabel})
+
+	backupFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "backup",
+		Name:      "failures_total",
+		Help:      "Backups that failed",
+	}, []string{clusterLabel})
+
+	backupLastDurationSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup",
+		Name:      "last_duration_seconds",
+		Help:      "Time taken by the last successful backup",
+	}, []string{clusterLabel})
+
+	backupLastSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup",
+		Name:      "last_size_bytes",
+		Help:      "Size of the files in the last successful backup",
+	}, []string{clusterLabel})
+
+	backupLastSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backup",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time when the last successful backup was completed, in seconds since the epoch",
+	}, []string{clusterLabel})
+
+	repositorySizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "repository",
+		Name:      "size_bytes",
+		Help:      "Space used by the Kopia repository of the cluster",
+	}, []string{clusterLabel})
+)
+
+func init() {
+	Registry.MustRegister(
+		backupProgressHashedBytes,
+		backupProgressCachedBytes,
+		backupProgressUploadedBytes,
+		backupProgressEstimatedBytes,
+		backupProgressFiles,
+		backupVolumeSizeBytes,
+		backupVolumeAvailableBytes,
+		backupVolumeClusterUsedBytes,
+		backupVolumeEstimatedBackupBytes,
+		walArchiveTotal,
+		walArchiveFailuresTotal,
+		walArchiveBytesTotal,
+		walArchiveDurationSeconds,
+		walArchiveLastSuccessTimestamp,
+		walRestoreTotal,
+		walRestoreFailuresTotal,
+		walRestoreDurationSeconds,
+		backupInProgress,
+		backupFailuresTotal,
+		backupLastDurationSeconds,
+		backupLastSizeBytes,
+		backupLastSuccessTimestamp,
+		repositorySizeBytes,
+	)
+}
+
+// BackupProgress is the progress of the snapshot of
+// a tablespace, or of the data directory
+type BackupProgress struct {
+	HashedBytes    int64
+	CachedBytes    int64
+	UploadedBytes  int64
+	EstimatedBytes int64
+	Files          int64
+}
+
+// SetBackupProgress publishes the progress of the snapshot of a tablespace
+func SetBackupProgress(clusterName string, tablespace string, progress BackupProgress) {
+	labels := prometheus.Labels{clusterLabel: clusterName, tablespaceLabel: tablespace}
+	backupProgressHashedBytes.With(labels).Set(float64(progress.HashedBytes))
+	backupProgressCachedBytes.With(labels).Set(float64(progress.CachedBytes))
+	backupProgressUploadedBytes.With(labels).Set(float64(progress.UploadedBytes))
+	backupProgressEstimatedBytes.With(labels).Set(float64(progress.EstimatedBytes))
+	backupProgressFiles.With(labels).Set(float64(progress.Files))
+}
+
+// ClearBackupProgress removes the progress of the backups of a cluster,
+// to be called when the backup is completed
+func ClearBackupProgress(clusterName string) {
+	labels := prometheus.Labels{clusterLabel: clusterName}
+	backupProgressHashedBytes.DeletePartialMatch(labels)
+	backupProgressCachedBytes.DeletePartialMatch(labels)
+	backupProgressUploadedBytes.DeletePartialMatch(labels)
+	backupProgressEstimatedBytes.DeletePartialMatch(labels)
+	backupProgressFiles.DeletePartialMatch(labels)
+}
+
+// SetBackupVolumeUsage publishes the space usage of the
+// volume where the backups are stored
+func SetBackupVolumeUsage(clusterName string, sizeBytes int64, availableBytes int64) {
+	backupVolumeSizeBytes.WithLabelValues(clusterName).Set(float64(sizeBytes))
+	backupVolumeAvailableBytes.WithLabelValues(clusterName).Set(float64(availableBytes))
+}
+
+// SetBackupVolumeClusterUsage publishes the space used by the
+// files relative to a cluster
+func SetBackupVolumeClusterUsage(clusterName string, usedBytes int64) {
+	backupVolumeClusterUsedBytes.WithLabelValues(clusterName).Set(float64(usedBytes))
+}
+
+// SetEstimatedBackupSize publishes the space a backup
+// was estimated to need
+func SetEstimatedBackupSize(clusterName string, estimatedBytes int64) {
+	backupVolumeEstimatedBackupBytes.WithLabelValues(clusterName).Set(float64(estimatedBytes))
+}
+
+// ObserveWALArchive records the archiving of a WAL file of sizeBytes
+func ObserveWALArchive(clusterName string, duration time.Duration, sizeBytes int64, succeeded bool) {
+	walArchiveTotal.WithLabelValues(clusterName).Inc()
+	walArchiveDurationSeconds.WithLabelValues(clusterName).Observe(duration.Seconds())
+	if !succeeded {
+		walArchiveFailuresTotal.WithLabelValues(clusterName).Inc()
+		return
+	}
+
+	walArchiveBytesTotal.WithLabelValues(clusterName).Add(float64(sizeBytes))
+	walArchiveLastSuccessTimestamp.WithLabelValues(clusterName).SetToCurrentTime()
+}
+
+// ObserveWALRestore records the restore of a WAL file. Requesting a
+// WAL file that is not in the archive is not a failure, as PostgreSQL
+// does it at the end of every recovery
+func ObserveWALRestore(clusterName string, duration time.Duration, failed bool) {
+	walRestoreTotal.WithLabelValues(clusterName).Inc()
+	walRestoreDurationSeconds.WithLabelValues(clusterName).Observe(duration.Seconds())
+	if failed {
+		walRestoreFailuresTotal.WithLabelValues(clusterName).Inc()
+	}
+}
+
+// SetBackupInProgress publishes whether a backup of the cluster is running
+func SetBackupInProgress(clusterName string, inProgress bool) {
+	value := 0.0
+	if inProgress {
+		value = 1
+	}
+	backupInProgress.WithLabelValues(clusterName).Set(value)
+}
+
+// ObserveBackupFailure records a failed backup
+func ObserveBackupFailure(clusterName string) {
+	backupFailuresTotal.WithLabelValues(clusterName).Inc()
+}
+
+// ObserveBackup records a successful backup of sizeBytes
+func ObserveBackup(clusterName string, duration time.Duration, sizeBytes int64) {
+	backupLastDurationSeconds.WithLabelValues(clusterName).Set(duration.Seconds())
+	backupLastSizeBytes.WithLabelValues(clusterName).Set(float64(sizeBytes))
+	backupLastSuccessTimestamp.WithLabelValues(clusterName).SetToCurrentTime()
+}
+
+// SetRepositorySize publishes the space used by the Kopia repository
+func SetRepositorySize(clusterName string, sizeBytes int64) {
+	repositorySizeBytes.WithLabelValues(clusterName).Set(float64(sizeBytes))
+}
+
+// Serve publishes the metrics on the passed address, until
+// the context is cancelled
+func Serve(ctx context.Context, address string) error {
+	logger := logging.FromContext(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Close(); err != nil {
+			logger.Error(err, "While stopping metrics server")
+		}
+	}()
+
+	logger.Info("Starting metrics server", "address", address)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -20,11 +20,17 @@ import (
 	"context"
 
 	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // Implementation is the implementation of the identity service
 type Implementation struct {
 	operator.OperatorServer
+
+	// Client is used to check the objects referenced by the plugin
+	// parameters and to provision the backup PVC. When nil, those
+	// checks are skipped and the PVC can't be provisioned
+	Client client.Client
 }
 
 // GetCapabilities gets the capabilities of this operator lifecycle hook
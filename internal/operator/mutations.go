@@ -18,18 +18,25 @@ package operator
 
 import (
 	"context"
+	"fmt"
+	"slices"
 
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/specs"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/pluginhelper"
 	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
 	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
 )
 
 // MutateCluster is called to mutate a cluster with the defaulting webhook.
-// This function is defaulting the "imagePullPolicy" plugin parameter
-func (Implementation) MutateCluster(
-	_ context.Context,
+// This function is defaulting the "imagePullPolicy" plugin parameter and
+// reconciling the backup PVC of an existing cluster
+func (impl Implementation) MutateCluster(
+	ctx context.Context,
 	request *operator.OperatorMutateClusterRequest,
 ) (*operator.OperatorMutateClusterResult, error) {
 	helper, err := pluginhelper.NewDataBuilder(metadata.Data.Name, request.Definition).Build()
@@ -37,6 +44,10 @@ func (Implementation) MutateCluster(
 		return nil, err
 	}
 
+	if err := impl.reconcileBackupPVC(ctx, helper); err != nil {
+		return nil, err
+	}
+
 	mutatedCluster := helper.GetCluster().DeepCopy()
 	for i := range mutatedCluster.Spec.Plugins {
 		if mutatedCluster.Spec.Plugins[i].Name != metadata.Data.Name {
@@ -47,8 +58,9 @@ func (Implementation) MutateCluster(
 			mutatedCluster.Spec.Plugins[i].Parameters = make(map[string]string)
 		}
 
-		if _, ok := mutatedCluster.Spec.Plugins[i].Parameters[imagePullPolicyParameter]; !ok {
-			mutatedCluster.Spec.Plugins[i].Parameters[imagePullPolicyParameter] = string(corev1.PullAlways)
+		if _, ok := mutatedCluster.Spec.Plugins[i].Parameters[config.ImagePullPolicyParameter]; !ok {
+			mutatedCluster.Spec.Plugins[i].Parameters[config.ImagePullPolicyParameter] = string(
+				config.DefaultImagePullPolicy)
 		}
 	}
 
@@ -62,9 +74,35 @@ func (Implementation) MutateCluster(
 	}, nil
 }
 
-// MutatePod is called to mutate a Pod before it will be created
-func (Implementation) MutatePod(
-	_ context.Context,
+// reconcileBackupPVC expands the backup PVC provisioned by the plugin when
+// the size requested for an existing cluster is increased, as the Pods of
+// the cluster are not recreated when the plugin parameters change. The PVC
+// of a new cluster is created together with its first Pod, once the cluster
+// exists and can own it. Invalid parameters are never reconciled
+func (impl Implementation) reconcileBackupPVC(ctx context.Context, helper *pluginhelper.Data) error {
+	cluster := helper.GetCluster()
+	if impl.Client == nil || len(cluster.UID) == 0 {
+		return nil
+	}
+
+	configuration, err := config.ValidateParameters(helper.Parameters)
+	if err != nil {
+		logging.FromContext(ctx).V(4).Info(
+			"Not reconciling the backup PVC, the plugin parameters are not valid", "reason", err.Error())
+		return nil
+	}
+
+	if err := impl.ensureBackupPVC(ctx, cluster, configuration); err != nil {
+		return fmt.Errorf("while reconciling the backup PVC: %w", err)
+	}
+	return nil
+}
+
+// MutatePod is called to mutate a Pod before it will be created.
+// The mutation is idempotent, as it may be applied to a Pod that
+// has already been mutated
+func (impl Implementation) MutatePod(
+	ctx context.Context,
 	request *operator.OperatorMutatePodRequest,
 ) (*operator.OperatorMutatePodResult, error) {
 	helper, err := pluginhelper.NewDataBuilder(metadata.Data.Name, request.ClusterDefinition).
@@ -73,22 +111,22 @@ func (Implementation) MutatePod(
 		return nil, err
 	}
 
-	mutatedPod := helper.GetPod().DeepCopy()
-	helper.InjectPluginVolume(mutatedPod)
+	configuration, err := config.FromParameters(helper.Parameters)
+	if err != nil {
+		return nil, err
+	}
 
-	// Inject sidecar
-	if len(mutatedPod.Spec.Containers) > 0 {
-		mutatedPod.Spec.Containers = append(
-			mutatedPod.Spec.Containers,
-			getSidecarContainer(mutatedPod, helper.Parameters))
+	// The cluster already exists when its Pods are created,
+	// so the PVC can be owned by it
+	if err := impl.ensureBackupPVC(ctx, helper.GetCluster(), configuration); err != nil {
+		return nil, err
 	}
 
-	// Inject backup volume
-	if len(mutatedPod.Spec.Volumes) > 0 {
-		mutatedPod.Spec.Volumes = append(
-			mutatedPod.Spec.Volumes,
-			getBackupVolume(helper.Parameters))
+	mutatedPod := helper.GetPod().DeepCopy()
+	if err := mutatePod(mutatedPod, helper.GetCluster().Name, configuration); err != nil {
+		return nil, err
 	}
+	helper.InjectPluginVolume(mutatedPod)
 
 	patch, err := helper.CreatePodJSONPatch(*mutatedPod)
 	if err != nil {
@@ -99,3 +137,78 @@ func (Implementation) MutatePod(
 		JsonPatch: patch,
 	}, nil
 }
+
+// mutatePod injects the sidecar and its volumes into a Pod, replacing
+// any container or volume with the same name
+func mutatePod(pod *corev1.Pod, clusterName string, configuration *config.Configuration) error {
+	postgresContainer := findContainer(pod, specs.PostgresContainerName)
+	if postgresContainer == nil {
+		return fmt.Errorf(
+			"cannot inject the %s sidecar: container %q not found in pod %s",
+			sidecarContainerName, specs.PostgresContainerName, pod.Name)
+	}
+
+	pod.Spec.Containers = setContainer(
+		pod.Spec.Containers,
+		getSidecarContainer(postgresContainer, configuration))
+
+	pod.Spec.Volumes = setVolume(pod.Spec.Volumes, getBackupVolume(configuration.GetPVCName(clusterName)))
+	pod.Spec.Volumes = setVolume(pod.Spec.Volumes, getTmpVolume())
+	pod.Spec.Volumes = setVolume(pod.Spec.Volumes, getRepositorySecretVolume(configuration))
+	if len(configuration.PreviousPVCName) > 0 {
+		pod.Spec.Volumes = setVolume(pod.Spec.Volumes, getPreviousBackupVolume(configuration.PreviousPVCName))
+	} else {
+		pod.Spec.Volumes = removeVolume(pod.Spec.Volumes, previousBackupsVolumeName)
+	}
+	if configuration.Storage.Type == storage.BackendTypeS3 && len(configuration.S3CASecret) > 0 {
+		pod.Spec.Volumes = setVolume(pod.Spec.Volumes, getS3CAVolume(configuration))
+	} else {
+		pod.Spec.Volumes = removeVolume(pod.Spec.Volumes, s3CAVolumeName)
+	}
+
+	return nil
+}
+
+// findContainer finds a container of a Pod by name
+func findContainer(pod *corev1.Pod, name string) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			return &pod.Spec.Containers[i]
+		}
+	}
+
+	return nil
+}
+
+// setContainer replaces the container with the same name,
+// or appends the container when there's none
+func setContainer(containers []corev1.Container, container corev1.Container) []corev1.Container {
+	for i := range containers {
+		if containers[i].Name == container.Name {
+			containers[i] = container
+			return containers
+		}
+	}
+
+	return append(containers, container)
+}
+
+// setVolume replaces the volume with the same name,
+// or appends the volume when there's none
+func setVolume(volumes []corev1.Volume, volume corev1.Volume) []corev1.Volume {
+	for i := range volumes {
+		if volumes[i].Name == volume.Name {
+			volumes[i] = volume
+			return volumes
+		}
+	}
+
+	return append(volumes, volume)
+}
+
+// removeVolume removes the volume with the passed name, if any
+func removeVolume(volumes []corev1.Volume, name string) []corev1.Volume {
+	return slices.DeleteFunc(volumes, func(volume corev1.Volume) bool {
+		return volume.Name == name
+	})
+}
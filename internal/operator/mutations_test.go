@@ -0,0 +1,212 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/specs"
+	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+// testParameters are the minimal parameters of a valid configuration
+func testParameters(extra map[string]string) map[string]string {
+	result := map[string]string{
+		config.ImageParameter:      "plugin-pvc-backup:latest",
+		config.SecretNameParameter: "kopia",
+		config.SecretKeyParameter:  "password",
+		config.PVCParameter:        "cluster-backups",
+	}
+	for key, value := range extra {
+		result[key] = value
+	}
+
+	return result
+}
+
+func newTestConfiguration(t *testing.T, extra map[string]string) *config.Configuration {
+	t.Helper()
+
+	configuration, err := config.FromParameters(testParameters(extra))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configuration
+}
+
+func newTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: specs.PostgresContainerName},
+			},
+		},
+	}
+}
+
+func hasVolume(pod *corev1.Pod, name string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasSidecarMount(pod *corev1.Pod, name string) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name != sidecarContainerName {
+			continue
+		}
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func TestMutatePodOptionalVolumes(t *testing.T) {
+	pod := newTestPod()
+
+	s3Configuration := newTestConfiguration(t, map[string]string{
+		config.StorageBackendParameter:      "s3",
+		config.S3BucketParameter:            "backups",
+		config.S3CredentialsSecretParameter: "s3-credentials",
+		config.S3CASecretParameter:          "s3-ca",
+		config.PreviousPVCParameter:         "old-backups",
+	})
+	if err := mutatePod(pod, "cluster", s3Configuration); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{s3CAVolumeName, previousBackupsVolumeName} {
+		if !hasVolume(pod, name) || !hasSidecarMount(pod, name) {
+			t.Errorf("expected volume %s to be added and mounted", name)
+		}
+	}
+
+	// Mutating the same Pod again with the optional
+	// parameters removed drops the volumes
+	if err := mutatePod(pod, "cluster", newTestConfiguration(t, nil)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{s3CAVolumeName, previousBackupsVolumeName} {
+		if hasVolume(pod, name) || hasSidecarMount(pod, name) {
+			t.Errorf("expected volume %s to be removed", name)
+		}
+	}
+	if !hasVolume(pod, backupsVolumeName) {
+		t.Errorf("expected the backup volume to be kept")
+	}
+
+	containers := 0
+	for _, container := range pod.Spec.Containers {
+		if container.Name == sidecarContainerName {
+			containers++
+		}
+	}
+	if containers != 1 {
+		t.Errorf("expected a single sidecar after mutating twice, got %d", containers)
+	}
+}
+
+func TestMutatePodMountsRepositorySecret(t *testing.T) {
+	pod := newTestPod()
+	configuration := newTestConfiguration(t, map[string]string{config.NewSecretKeyParameter: "new-password"})
+	if err := mutatePod(pod, "cluster", configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasSidecarMount(pod, repositorySecretVolumeName) {
+		t.Fatalf("expected the repository Secret to be mounted")
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name != repositorySecretVolumeName {
+			continue
+		}
+
+		// The sidecars started before a rotation must be
+		// able to read the new key, so no key is selected
+		if volume.Secret == nil || volume.Secret.SecretName != "kopia" || len(volume.Secret.Items) > 0 {
+			t.Errorf("expected the whole kopia Secret to be mounted, got %+v", volume.VolumeSource)
+		}
+	}
+}
+
+func newTestManagedPVC(size string) *corev1.PersistentVolumeClaim {
+	pvc := newTestPVC("cluster-backups", corev1.ReadWriteOnce)
+	pvc.Labels = map[string]string{managedByLabel: metadata.Data.Name}
+	pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)}
+
+	return pvc
+}
+
+func getTestPVCSize(t *testing.T, impl Implementation) string {
+	t.Helper()
+
+	var pvc corev1.PersistentVolumeClaim
+	key := client.ObjectKey{Namespace: testNamespace, Name: "cluster-backups"}
+	if err := impl.Client.Get(context.Background(), key, &pvc); err != nil {
+		t.Fatal(err)
+	}
+
+	size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	return size.String()
+}
+
+func mutateTestCluster(t *testing.T, impl Implementation, parameters map[string]string) {
+	t.Helper()
+
+	_, err := impl.MutateCluster(context.Background(), &operator.OperatorMutateClusterRequest{
+		Definition: newTestClusterJSON(t, 1, testParameters(parameters)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutateClusterExpandsBackupPVC(t *testing.T) {
+	impl := newTestImplementation(newTestManagedPVC("1Gi"))
+
+	mutateTestCluster(t, impl, map[string]string{config.PVCSizeParameter: "2Gi"})
+	if size := getTestPVCSize(t, impl); size != "2Gi" {
+		t.Errorf("expected the backup PVC to be expanded to 2Gi, got %s", size)
+	}
+}
+
+func TestMutateClusterInvalidParametersKeepBackupPVC(t *testing.T) {
+	impl := newTestImplementation(newTestManagedPVC("1Gi"))
+
+	mutateTestCluster(t, impl, map[string]string{
+		config.PVCSizeParameter:         "2Gi",
+		config.ImagePullPolicyParameter: "always",
+	})
+	if size := getTestPVCSize(t, impl); size != "1Gi" {
+		t.Errorf("expected the backup PVC to be left at 1Gi, got %s", size)
+	}
+}
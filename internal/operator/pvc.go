@@ -0,0 +1,166 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cloudnative-pg/pkg/utils"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+// managedByLabel marks the backup PVCs provisioned by the plugin.
+// PVCs without it are never changed
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// ensureBackupPVC creates the backup PVC of the cluster from the template
+// in the configuration, or updates it when it has already been created
+// by the plugin. Nothing is done when the PVC is not provisioned by the plugin
+func (impl Implementation) ensureBackupPVC(
+	ctx context.Context,
+	cluster *apiv1.Cluster,
+	configuration *config.Configuration,
+) error {
+	if configuration.PVCTemplate == nil {
+		return nil
+	}
+
+	if impl.Client == nil {
+		return fmt.Errorf("cannot provision the backup PVC: Kubernetes API not available")
+	}
+
+	contextLogger := logging.FromContext(ctx)
+	pvcName := configuration.GetPVCName(cluster.Name)
+
+	var pvc corev1.PersistentVolumeClaim
+	err := impl.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: pvcName}, &pvc)
+	if apierrors.IsNotFound(err) {
+		contextLogger.Info("Creating backup PVC", "pvcName", pvcName)
+		err = impl.Client.Create(ctx, newBackupPVC(cluster, pvcName, configuration.PVCTemplate))
+		if apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("while getting backup PVC %s: %w", pvcName, err)
+	}
+
+	if pvc.Labels[managedByLabel] != metadata.Data.Name {
+		contextLogger.V(4).Info("Backup PVC not managed by the plugin, leaving it untouched", "pvcName", pvcName)
+		return nil
+	}
+
+	return impl.updateBackupPVC(ctx, cluster, &pvc, configuration.PVCTemplate)
+}
+
+// updateBackupPVC expands the backup PVC when the requested size has been
+// increased, and makes it owned by the cluster only when it should be
+// deleted together with it
+func (impl Implementation) updateBackupPVC(
+	ctx context.Context,
+	cluster *apiv1.Cluster,
+	pvc *corev1.PersistentVolumeClaim,
+	template *config.PVCTemplate,
+) error {
+	contextLogger := logging.FromContext(ctx)
+	updatedPVC := pvc.DeepCopy()
+
+	currentSize := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if currentSize.Cmp(template.Size) < 0 {
+		contextLogger.Info(
+			"Expanding backup PVC",
+			"pvcName", pvc.Name,
+			"currentSize", currentSize.String(),
+			"size", template.Size.String())
+		if updatedPVC.Spec.Resources.Requests == nil {
+			updatedPVC.Spec.Resources.Requests = make(corev1.ResourceList)
+		}
+		updatedPVC.Spec.Resources.Requests[corev1.ResourceStorage] = template.Size
+	}
+
+	updatedPVC.OwnerReferences = nil
+	for _, ownerReference := range pvc.OwnerReferences {
+		if ownerReference.UID != cluster.UID {
+			updatedPVC.OwnerReferences = append(updatedPVC.OwnerReferences, ownerReference)
+		}
+	}
+	if template.ReclaimPolicy == config.PVCReclaimPolicyDelete {
+		updatedPVC.OwnerReferences = append(updatedPVC.OwnerReferences, getClusterOwnerReference(cluster))
+	}
+
+	if equality.Semantic.DeepEqual(pvc, updatedPVC) {
+		return nil
+	}
+
+	return impl.Client.Patch(ctx, updatedPVC, client.MergeFrom(pvc))
+}
+
+func newBackupPVC(
+	cluster *apiv1.Cluster,
+	pvcName string,
+	template *config.PVCTemplate,
+) *corev1.PersistentVolumeClaim {
+	result := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcName,
+			Namespace: cluster.Namespace,
+			Labels: map[string]string{
+				utils.ClusterLabelName: cluster.Name,
+				managedByLabel:         metadata.Data.Name,
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{template.AccessMode},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: template.Size,
+				},
+			},
+		},
+	}
+
+	if len(template.StorageClass) > 0 {
+		storageClass := template.StorageClass
+		result.Spec.StorageClassName = &storageClass
+	}
+
+	if template.ReclaimPolicy == config.PVCReclaimPolicyDelete {
+		result.OwnerReferences = []metav1.OwnerReference{getClusterOwnerReference(cluster)}
+	}
+
+	return result
+}
+
+func getClusterOwnerReference(cluster *apiv1.Cluster) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: apiv1.GroupVersion.String(),
+		Kind:       apiv1.ClusterKind,
+		Name:       cluster.Name,
+		UID:        cluster.UID,
+	}
+}
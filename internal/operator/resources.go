@@ -0,0 +1,239 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/pluginhelper"
+	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+)
+
+// validateResources checks that the PVC and the Secrets referenced
+// by the configuration exist and are suitable for the cluster
+func (impl Implementation) validateResources(
+	ctx context.Context,
+	helper *pluginhelper.Data,
+	configuration *config.Configuration,
+) ([]*operator.ValidationError, error) {
+	if impl.Client == nil {
+		return nil, nil
+	}
+
+	cluster := helper.GetCluster()
+	result := make([]*operator.ValidationError, 0)
+
+	pvcErrors, err := impl.validatePVC(ctx, helper, cluster, configuration)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, pvcErrors...)
+
+	if len(configuration.PreviousPVCName) > 0 {
+		pvcErrors, err = impl.validatePreviousPVC(ctx, helper, cluster, configuration)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pvcErrors...)
+	}
+
+	passwordKeys := map[string]string{configuration.SecretKey: config.SecretKeyParameter}
+	if len(configuration.NewSecretKey) > 0 {
+		passwordKeys[configuration.NewSecretKey] = config.NewSecretKeyParameter
+	}
+	secretErrors, err := impl.validateSecret(
+		ctx, helper, cluster.Namespace, config.SecretNameParameter, configuration.SecretName, passwordKeys)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, secretErrors...)
+
+	if configuration.Storage.Type != storage.BackendTypeS3 {
+		return result, nil
+	}
+
+	secretErrors, err = impl.validateSecret(
+		ctx, helper, cluster.Namespace,
+		config.S3CredentialsSecretParameter, configuration.S3CredentialsSecret,
+		map[string]string{
+			storage.S3AccessKeyIDSecretKey:     config.S3CredentialsSecretParameter,
+			storage.S3SecretAccessKeySecretKey: config.S3CredentialsSecretParameter,
+		})
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, secretErrors...)
+
+	if len(configuration.S3CASecret) > 0 {
+		secretErrors, err = impl.validateSecret(
+			ctx, helper, cluster.Namespace,
+			config.S3CASecretParameter, configuration.S3CASecret,
+			map[string]string{storage.S3CASecretKey: config.S3CASecretParameter})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, secretErrors...)
+	}
+
+	return result, nil
+}
+
+// validatePVC checks that the backup PVC exists, unless it's provisioned
+// by the plugin, and, when the cluster has more than one instance, that
+// it can be mounted by every instance
+func (impl Implementation) validatePVC(
+	ctx context.Context,
+	helper *pluginhelper.Data,
+	cluster *apiv1.Cluster,
+	configuration *config.Configuration,
+) ([]*operator.ValidationError, error) {
+	pvcName := configuration.GetPVCName(cluster.Name)
+
+	if configuration.PVCTemplate != nil {
+		if cluster.Spec.Instances > 1 && configuration.PVCTemplate.AccessMode != corev1.ReadWriteMany {
+			return []*operator.ValidationError{
+				helper.ValidationErrorForParameter(
+					config.PVCAccessModeParameter,
+					fmt.Sprintf("must be %s, as the cluster has %d instances",
+						corev1.ReadWriteMany, cluster.Spec.Instances)),
+			}, nil
+		}
+		return nil, nil
+	}
+
+	var pvc corev1.PersistentVolumeClaim
+	err := impl.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: pvcName}, &pvc)
+	if apierrors.IsNotFound(err) {
+		return []*operator.ValidationError{
+			helper.ValidationErrorForParameter(
+				config.PVCParameter,
+				fmt.Sprintf("PersistentVolumeClaim %q not found in namespace %q", pvcName, cluster.Namespace)),
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while getting PersistentVolumeClaim %s: %w", pvcName, err)
+	}
+
+	if cluster.Spec.Instances > 1 && !slices.Contains(pvc.Spec.AccessModes, corev1.ReadWriteMany) {
+		return []*operator.ValidationError{
+			helper.ValidationErrorForParameter(
+				config.PVCParameter,
+				fmt.Sprintf(
+					"PersistentVolumeClaim %q must have the %s access mode, as the cluster has %d instances",
+					pvcName, corev1.ReadWriteMany, cluster.Spec.Instances)),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// validatePreviousPVC checks that the PVC the backups are being migrated
+// from is not the backup PVC, that it exists and, when the cluster has
+// more than one instance, that it can be mounted by every instance
+func (impl Implementation) validatePreviousPVC(
+	ctx context.Context,
+	helper *pluginhelper.Data,
+	cluster *apiv1.Cluster,
+	configuration *config.Configuration,
+) ([]*operator.ValidationError, error) {
+	pvcName := configuration.PreviousPVCName
+
+	if pvcName == configuration.GetPVCName(cluster.Name) {
+		return []*operator.ValidationError{
+			helper.ValidationErrorForParameter(
+				config.PreviousPVCParameter,
+				fmt.Sprintf("PersistentVolumeClaim %q is already the backup PVC", pvcName)),
+		}, nil
+	}
+
+	var pvc corev1.PersistentVolumeClaim
+	err := impl.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: pvcName}, &pvc)
+	if apierrors.IsNotFound(err) {
+		return []*operator.ValidationError{
+			helper.ValidationErrorForParameter(
+				config.PreviousPVCParameter,
+				fmt.Sprintf("PersistentVolumeClaim %q not found in namespace %q", pvcName, cluster.Namespace)),
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while getting PersistentVolumeClaim %s: %w", pvcName, err)
+	}
+
+	// The WAL files are archived in the previous PVC too,
+	// until the migration has been completed
+	if cluster.Spec.Instances > 1 && !slices.Contains(pvc.Spec.AccessModes, corev1.ReadWriteMany) {
+		return []*operator.ValidationError{
+			helper.ValidationErrorForParameter(
+				config.PreviousPVCParameter,
+				fmt.Sprintf(
+					"PersistentVolumeClaim %q must have the %s access mode, as the cluster has %d instances",
+					pvcName, corev1.ReadWriteMany, cluster.Spec.Instances)),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// validateSecret checks that a Secret exists and contains the passed keys.
+// The keys are mapped to the parameter reported when they are missing
+func (impl Implementation) validateSecret(
+	ctx context.Context,
+	helper *pluginhelper.Data,
+	namespace string,
+	secretParameter string,
+	secretName string,
+	keys map[string]string,
+) ([]*operator.ValidationError, error) {
+	var secret corev1.Secret
+	err := impl.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: secretName}, &secret)
+	if apierrors.IsNotFound(err) {
+		return []*operator.ValidationError{
+			helper.ValidationErrorForParameter(
+				secretParameter,
+				fmt.Sprintf("Secret %q not found in namespace %q", secretName, namespace)),
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while getting Secret %s: %w", secretName, err)
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	slices.Sort(sortedKeys)
+
+	result := make([]*operator.ValidationError, 0)
+	for _, key := range sortedKeys {
+		if _, ok := secret.Data[key]; !ok {
+			result = append(result, helper.ValidationErrorForParameter(
+				keys[key],
+				fmt.Sprintf("key %q not found in Secret %q", key, secretName)))
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,264 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/pluginhelper"
+	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+const testNamespace = "default"
+
+func newTestClusterJSON(t *testing.T, instances int, parameters map[string]string) []byte {
+	t.Helper()
+
+	cluster := apiv1.Cluster{
+		TypeMeta: metav1.TypeMeta{APIVersion: apiv1.GroupVersion.String(), Kind: apiv1.ClusterKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-example",
+			Namespace: testNamespace,
+			UID:       "cluster-example-uid",
+		},
+		Spec: apiv1.ClusterSpec{
+			Instances: instances,
+			Plugins: apiv1.PluginConfigurationList{
+				{Name: metadata.Data.Name, Parameters: parameters},
+			},
+		},
+	}
+	clusterJSON, err := json.Marshal(&cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return clusterJSON
+}
+
+func newTestHelper(t *testing.T, instances int, parameters map[string]string) *pluginhelper.Data {
+	t.Helper()
+
+	helper, err := pluginhelper.NewDataBuilder(metadata.Data.Name, newTestClusterJSON(t, instances, parameters)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return helper
+}
+
+func newTestPVC(name string, accessMode corev1.PersistentVolumeAccessMode) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{accessMode},
+		},
+	}
+}
+
+func newTestSecret(name string, keys ...string) *corev1.Secret {
+	data := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		data[key] = []byte("value")
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Data:       data,
+	}
+}
+
+func newTestImplementation(objects ...client.Object) Implementation {
+	return Implementation{
+		Client: fake.NewClientBuilder().
+			WithScheme(clientgoscheme.Scheme).
+			WithObjects(objects...).
+			Build(),
+	}
+}
+
+func validateTestResources(
+	t *testing.T,
+	impl Implementation,
+	instances int,
+	extra map[string]string,
+) []*operator.ValidationError {
+	t.Helper()
+
+	parameters := testParameters(extra)
+	configuration, err := config.FromParameters(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := impl.validateResources(context.Background(), newTestHelper(t, instances, parameters), configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+// expectValidationErrors checks that every validation error is
+// reported for the expected parameter, in order
+func expectValidationErrors(t *testing.T, result []*operator.ValidationError, parameters ...string) {
+	t.Helper()
+
+	if len(result) != len(parameters) {
+		t.Fatalf("expected %d validation errors, got %v", len(parameters), result)
+	}
+	for i, parameter := range parameters {
+		components := result[i].PathComponents
+		if len(components) == 0 || components[len(components)-1] != parameter {
+			t.Errorf("expected a validation error for %q, got %v", parameter, result[i])
+		}
+	}
+}
+
+func TestValidateResources(t *testing.T) {
+	impl := newTestImplementation(
+		newTestPVC("cluster-backups", corev1.ReadWriteMany),
+		newTestSecret("kopia", "password"),
+	)
+
+	expectValidationErrors(t, validateTestResources(t, impl, 3, nil))
+}
+
+func TestValidateResourcesWithoutClient(t *testing.T) {
+	expectValidationErrors(t, validateTestResources(t, Implementation{}, 3, nil))
+}
+
+func TestValidateResourcesMissingPVC(t *testing.T) {
+	impl := newTestImplementation(newTestSecret("kopia", "password"))
+
+	result := validateTestResources(t, impl, 1, nil)
+	expectValidationErrors(t, result, config.PVCParameter)
+	if !strings.Contains(result[0].Message, `"cluster-backups" not found`) {
+		t.Errorf("unexpected message %q", result[0].Message)
+	}
+}
+
+func TestValidateResourcesPVCAccessMode(t *testing.T) {
+	impl := newTestImplementation(
+		newTestPVC("cluster-backups", corev1.ReadWriteOnce),
+		newTestSecret("kopia", "password"),
+	)
+
+	expectValidationErrors(t, validateTestResources(t, impl, 1, nil))
+	expectValidationErrors(t, validateTestResources(t, impl, 3, nil), config.PVCParameter)
+}
+
+func TestValidateResourcesMissingSecretKey(t *testing.T) {
+	impl := newTestImplementation(
+		newTestPVC("cluster-backups", corev1.ReadWriteMany),
+		newTestSecret("kopia", "other"),
+	)
+
+	result := validateTestResources(t, impl, 1, nil)
+	expectValidationErrors(t, result, config.SecretKeyParameter)
+	if !strings.Contains(result[0].Message, `key "password" not found in Secret "kopia"`) {
+		t.Errorf("unexpected message %q", result[0].Message)
+	}
+}
+
+func TestValidateResourcesS3Secrets(t *testing.T) {
+	s3Parameters := map[string]string{
+		config.StorageBackendParameter:      string(storage.BackendTypeS3),
+		config.S3BucketParameter:            "backups",
+		config.S3CredentialsSecretParameter: "s3-credentials",
+		config.S3CASecretParameter:          "s3-ca",
+	}
+	objects := []client.Object{
+		newTestPVC("cluster-backups", corev1.ReadWriteMany),
+		newTestSecret("kopia", "password"),
+	}
+
+	impl := newTestImplementation(objects...)
+	expectValidationErrors(t, validateTestResources(t, impl, 1, s3Parameters),
+		config.S3CredentialsSecretParameter, config.S3CASecretParameter)
+
+	impl = newTestImplementation(append(objects,
+		newTestSecret("s3-credentials", storage.S3AccessKeyIDSecretKey),
+		newTestSecret("s3-ca", storage.S3CASecretKey),
+	)...)
+	expectValidationErrors(t, validateTestResources(t, impl, 1, s3Parameters),
+		config.S3CredentialsSecretParameter)
+
+	impl = newTestImplementation(append(objects,
+		newTestSecret("s3-credentials", storage.S3AccessKeyIDSecretKey, storage.S3SecretAccessKeySecretKey),
+		newTestSecret("s3-ca", storage.S3CASecretKey),
+	)...)
+	expectValidationErrors(t, validateTestResources(t, impl, 1, s3Parameters))
+}
+
+func TestValidateResourcesAPIError(t *testing.T) {
+	errAPI := errors.New("connection refused")
+	impl := Implementation{
+		Client: fake.NewClientBuilder().
+			WithScheme(runtime.NewScheme()).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+					return errAPI
+				},
+			}).
+			Build(),
+	}
+
+	parameters := testParameters(nil)
+	configuration, err := config.FromParameters(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := impl.validateResources(context.Background(), newTestHelper(t, 1, parameters), configuration)
+	if !errors.Is(err, errAPI) {
+		t.Fatalf("expected the API error to be returned, got %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected no validation errors, got %v", result)
+	}
+}
+
+func TestValidateResourcesPreviousPVCAccessMode(t *testing.T) {
+	previousParameters := map[string]string{config.PreviousPVCParameter: "previous-backups"}
+	objects := []client.Object{
+		newTestPVC("cluster-backups", corev1.ReadWriteMany),
+		newTestSecret("kopia", "password"),
+	}
+
+	impl := newTestImplementation(append(objects, newTestPVC("previous-backups", corev1.ReadOnlyMany))...)
+	expectValidationErrors(t, validateTestResources(t, impl, 3, previousParameters), config.PreviousPVCParameter)
+
+	impl = newTestImplementation(append(objects, newTestPVC("previous-backups", corev1.ReadWriteMany))...)
+	expectValidationErrors(t, validateTestResources(t, impl, 3, previousParameters))
+}
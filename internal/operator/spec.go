@@ -17,16 +17,44 @@ limitations under the License.
 package operator
 
 import (
+	"os"
+	"slices"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/identity"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/metrics"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing"
 )
 
-const pgPath = "/var/lib/postgresql"
+const (
+	sidecarContainerName = "plugin-pvc-backup"
+
+	pgPath            = "/var/lib/postgresql"
+	s3CAVolumeName    = "s3-ca"
+	backupsVolumeName = "backups"
+
+	// previousBackupsVolumeName is the volume of the PVC the
+	// backups are being migrated from
+	previousBackupsVolumeName = "backups-previous"
+
+	// repositorySecretVolumeName is the volume of the
+	// Secret holding the repository passwords
+	repositorySecretVolumeName = "repository-secret"
+
+	// tmpVolumeName is the volume mounted on /tmp, as the root
+	// filesystem of the sidecar is read-only
+	tmpVolumeName = "plugin-pvc-backup-tmp"
+	tmpPath       = "/tmp"
+)
 
-func getSidecarContainer(pgPod *corev1.Pod, parameters map[string]string) corev1.Container {
+func getSidecarContainer(postgresContainer *corev1.Container, configuration *config.Configuration) corev1.Container {
 	result := corev1.Container{
-		Name: "plugin-pvc-backup",
+		Name: sidecarContainerName,
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      "scratch-data",
@@ -37,28 +65,65 @@ func getSidecarContainer(pgPod *corev1.Pod, parameters map[string]string) corev1
 				MountPath: "/plugins",
 			},
 			{
-				Name:      "backups",
+				Name:      backupsVolumeName,
 				MountPath: "/backup",
 			},
+			{
+				Name:      tmpVolumeName,
+				MountPath: tmpPath,
+			},
+			{
+				Name:      repositorySecretVolumeName,
+				MountPath: executor.PasswordMountPath,
+				ReadOnly:  true,
+			},
 		},
-		Image:           parameters["image"],
-		ImagePullPolicy: corev1.PullPolicy(parameters[imagePullPolicyParameter]),
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "metrics",
+				ContainerPort: metrics.DefaultPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+		Image:           configuration.Image,
+		ImagePullPolicy: configuration.ImagePullPolicy,
+		Resources:       configuration.SidecarResources,
+		SecurityContext: getSidecarSecurityContext(),
 		Env: []corev1.EnvVar{
 			{
-				Name: "KOPIA_PASSWORD",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: parameters["secretName"],
-						},
-						Key: parameters["secretKey"],
-					},
-				},
+				// Tools looking for a writable home directory
+				// can only write into the temporary volume
+				Name:  "HOME",
+				Value: tmpPath,
+			},
+			{
+				Name:  identity.InstanceSidecarEnvironment,
+				Value: "true",
 			},
 		},
 	}
 
-	volumeMounts := pgPod.Spec.Containers[0].VolumeMounts
+	result.Env = append(result.Env, getTracingEnv()...)
+
+	if len(configuration.PreviousPVCName) > 0 {
+		result.VolumeMounts = append(result.VolumeMounts, corev1.VolumeMount{
+			Name:      previousBackupsVolumeName,
+			MountPath: storage.PreviousBasePath,
+		})
+	}
+
+	if configuration.Storage.Type == storage.BackendTypeS3 {
+		result.Env = append(result.Env, getS3CredentialsEnv(configuration)...)
+		if len(configuration.S3CASecret) > 0 {
+			result.VolumeMounts = append(result.VolumeMounts, corev1.VolumeMount{
+				Name:      s3CAVolumeName,
+				MountPath: storage.S3CAMountPath,
+				ReadOnly:  true,
+			})
+		}
+	}
+
+	volumeMounts := postgresContainer.VolumeMounts
 	for i := range volumeMounts {
 		if strings.HasPrefix(volumeMounts[i].MountPath, pgPath) {
 			result.VolumeMounts = append(result.VolumeMounts, volumeMounts[i])
@@ -68,12 +133,126 @@ func getSidecarContainer(pgPod *corev1.Pod, parameters map[string]string) corev1
 	return result
 }
 
-func getBackupVolume(parameters map[string]string) corev1.Volume {
+// getTracingEnv gets the OpenTelemetry environment variables of the
+// plugin, so that the sidecars export their traces to the same collector
+func getTracingEnv() []corev1.EnvVar {
+	var result []corev1.EnvVar
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, tracing.EnvironmentPrefix) {
+			result = append(result, corev1.EnvVar{Name: name, Value: value})
+		}
+	}
+
+	// The environment is not sorted, while the Pod
+	// must be the same every time it's mutated
+	slices.SortFunc(result, func(a, b corev1.EnvVar) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result
+}
+
+func getSidecarSecurityContext() *corev1.SecurityContext {
+	runAsNonRoot := true
+	readOnlyRootFilesystem := true
+	allowPrivilegeEscalation := false
+
+	return &corev1.SecurityContext{
+		RunAsNonRoot:             &runAsNonRoot,
+		ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+func getTmpVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: tmpVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+}
+
+func getRepositorySecretVolume(configuration *config.Configuration) corev1.Volume {
+	return corev1.Volume{
+		Name: repositorySecretVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: configuration.SecretName,
+			},
+		},
+	}
+}
+
+func getBackupVolume(pvcName string) corev1.Volume {
 	return corev1.Volume{
-		Name: "backups",
+		Name: backupsVolumeName,
 		VolumeSource: corev1.VolumeSource{
 			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-				ClaimName: parameters[pvcNameParameter],
+				ClaimName: pvcName,
+			},
+		},
+	}
+}
+
+func getPreviousBackupVolume(pvcName string) corev1.Volume {
+	return corev1.Volume{
+		Name: previousBackupsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: pvcName,
+			},
+		},
+	}
+}
+
+func getS3CredentialsEnv(configuration *config.Configuration) []corev1.EnvVar {
+	secretKeyRef := func(key string, optional bool) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: configuration.S3CredentialsSecret,
+				},
+				Key:      key,
+				Optional: &optional,
+			},
+		}
+	}
+
+	return []corev1.EnvVar{
+		{
+			Name:      storage.AccessKeyIDEnvironment,
+			ValueFrom: secretKeyRef(storage.S3AccessKeyIDSecretKey, false),
+		},
+		{
+			Name:      storage.SecretAccessKeyEnvironment,
+			ValueFrom: secretKeyRef(storage.S3SecretAccessKeySecretKey, false),
+		},
+		{
+			Name:      storage.SessionTokenEnvironment,
+			ValueFrom: secretKeyRef(storage.S3SessionTokenSecretKey, true),
+		},
+	}
+}
+
+func getS3CAVolume(configuration *config.Configuration) corev1.Volume {
+	return corev1.Volume{
+		Name: s3CAVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: configuration.S3CASecret,
+				Items: []corev1.KeyToPath{
+					{
+						Key:  storage.S3CASecretKey,
+						Path: storage.S3CASecretKey,
+					},
+				},
 			},
 		},
 	}
@@ -18,25 +18,19 @@ package operator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/pluginhelper"
 	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
 
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
 	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
 )
 
-const (
-	imagePullPolicyParameter = "imagePullPolicy"
-	imageNameParameter       = "image"
-	pvcNameParameter         = "pvc"
-	secretNameParameter      = "secretName"
-	secretKeyParameter       = "secretKey"
-)
-
 // ValidateClusterCreate validates a cluster that is being created
-func (Implementation) ValidateClusterCreate(
-	_ context.Context,
+func (impl Implementation) ValidateClusterCreate(
+	ctx context.Context,
 	request *operator.OperatorValidateClusterCreateRequest,
 ) (*operator.OperatorValidateClusterCreateResult, error) {
 	result := &operator.OperatorValidateClusterCreateResult{}
@@ -46,14 +40,24 @@ func (Implementation) ValidateClusterCreate(
 		return nil, err
 	}
 
-	result.ValidationErrors = append(result.ValidationErrors, validateParameters(helper)...)
+	configuration, err := config.ValidateParameters(helper.Parameters)
+	if err != nil {
+		result.ValidationErrors = append(result.ValidationErrors, validationErrorsFor(helper, err)...)
+		return result, nil
+	}
+
+	resourceErrors, err := impl.validateResources(ctx, helper, configuration)
+	if err != nil {
+		return nil, err
+	}
+	result.ValidationErrors = append(result.ValidationErrors, resourceErrors...)
 
 	return result, nil
 }
 
 // ValidateClusterChange validates a cluster that is being changed
-func (Implementation) ValidateClusterChange(
-	_ context.Context,
+func (impl Implementation) ValidateClusterChange(
+	ctx context.Context,
 	request *operator.OperatorValidateClusterChangeRequest,
 ) (*operator.OperatorValidateClusterChangeResult, error) {
 	result := &operator.OperatorValidateClusterChangeResult{}
@@ -68,43 +72,44 @@ func (Implementation) ValidateClusterChange(
 		return nil, fmt.Errorf("while parsing new cluster: %w", err)
 	}
 
-	result.ValidationErrors = append(result.ValidationErrors, validateParameters(newClusterHelper)...)
+	newConfiguration, err := config.ValidateParameters(newClusterHelper.Parameters)
+	if err != nil {
+		result.ValidationErrors = append(result.ValidationErrors, validationErrorsFor(newClusterHelper, err)...)
+		return result, nil
+	}
+
+	err = newConfiguration.ValidateChange(newClusterHelper.GetCluster().Name, oldClusterHelper.Parameters)
+	result.ValidationErrors = append(result.ValidationErrors, validationErrorsFor(newClusterHelper, err)...)
 
-	if newClusterHelper.Parameters[pvcNameParameter] != oldClusterHelper.Parameters[pvcNameParameter] {
-		result.ValidationErrors = append(
-			result.ValidationErrors,
-			newClusterHelper.ValidationErrorForParameter(pvcNameParameter, "cannot be changed"))
+	resourceErrors, err := impl.validateResources(ctx, newClusterHelper, newConfiguration)
+	if err != nil {
+		return nil, err
 	}
+	result.ValidationErrors = append(result.ValidationErrors, resourceErrors...)
 
 	return result, nil
 }
 
-func validateParameters(helper *pluginhelper.Data) []*operator.ValidationError {
-	result := make([]*operator.ValidationError, 0)
-
-	if len(helper.Parameters[pvcNameParameter]) == 0 {
-		result = append(
-			result,
-			helper.ValidationErrorForParameter(pvcNameParameter, "cannot be empty"))
-	}
-
-	if len(helper.Parameters[imageNameParameter]) == 0 {
-		result = append(
-			result,
-			helper.ValidationErrorForParameter(imageNameParameter, "cannot be empty"))
+// validationErrorsFor creates the validation errors corresponding
+// to an error returned while parsing the plugin parameters
+func validationErrorsFor(helper *pluginhelper.Data, err error) []*operator.ValidationError {
+	if err == nil {
+		return nil
 	}
 
-	if len(helper.Parameters[secretNameParameter]) == 0 {
-		result = append(
-			result,
-			helper.ValidationErrorForParameter(secretNameParameter, "cannot be empty"))
+	var validationErrors config.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []*operator.ValidationError{
+			{
+				PathComponents: []string{"spec", "plugins"},
+				Message:        err.Error(),
+			},
+		}
 	}
 
-	if len(helper.Parameters[secretKeyParameter]) == 0 {
-		result = append(
-			result,
-			helper.ValidationErrorForParameter(secretKeyParameter, "cannot be empty"))
+	result := make([]*operator.ValidationError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		result = append(result, helper.ValidationErrorForParameter(fieldError.Parameter, fieldError.Message))
 	}
-
 	return result
 }
@@ -0,0 +1,56 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+)
+
+func validateTestClusterChange(
+	t *testing.T,
+	impl Implementation,
+	oldParameters map[string]string,
+	newParameters map[string]string,
+) []*operator.ValidationError {
+	t.Helper()
+
+	result, err := impl.ValidateClusterChange(context.Background(), &operator.OperatorValidateClusterChangeRequest{
+		OldCluster: newTestClusterJSON(t, 1, testParameters(oldParameters)),
+		NewCluster: newTestClusterJSON(t, 1, testParameters(newParameters)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result.ValidationErrors
+}
+
+func TestValidateClusterChangeKeepsBackupPVC(t *testing.T) {
+	impl := newTestImplementation(newTestManagedPVC("1Gi"), newTestSecret("kopia", "password"))
+
+	expectValidationErrors(t, validateTestClusterChange(t, impl,
+		map[string]string{config.PVCSizeParameter: "1Gi"},
+		map[string]string{config.PVCSizeParameter: "2Gi"}))
+	if size := getTestPVCSize(t, impl); size != "1Gi" {
+		t.Errorf("expected the validation to leave the backup PVC at 1Gi, got %s", size)
+	}
+}
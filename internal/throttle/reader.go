@@ -0,0 +1,97 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package throttle
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Budget is a bandwidth budget that can be shared by many readers.
+// The zero value is an unlimited budget
+type Budget struct {
+	mu      sync.Mutex
+	limiter *rate.Limiter
+}
+
+// SetLimit changes the number of bytes per second allowed
+// by this budget. Zero means unlimited
+func (budget *Budget) SetLimit(bytesPerSecond int64) {
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+
+	if bytesPerSecond <= 0 {
+		budget.limiter = nil
+		return
+	}
+
+	if budget.limiter == nil {
+		budget.limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+		return
+	}
+
+	budget.limiter.SetLimit(rate.Limit(bytesPerSecond))
+	budget.limiter.SetBurst(int(bytesPerSecond))
+}
+
+func (budget *Budget) getLimiter() *rate.Limiter {
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+
+	return budget.limiter
+}
+
+// NewReader creates a reader whose throughput is limited by the budget.
+// The reader stops waiting for the budget when the context is cancelled
+func (budget *Budget) NewReader(ctx context.Context, reader io.Reader) io.Reader {
+	return &throttledReader{
+		ctx:    ctx,
+		reader: reader,
+		budget: budget,
+	}
+}
+
+type throttledReader struct {
+	ctx    context.Context
+	reader io.Reader
+	budget *Budget
+}
+
+// Read implements the io.Reader interface
+func (reader *throttledReader) Read(p []byte) (int, error) {
+	limiter := reader.budget.getLimiter()
+	if limiter == nil {
+		return reader.reader.Read(p)
+	}
+
+	// We can't wait for more tokens than the burst size
+	if len(p) > limiter.Burst() {
+		p = p[:limiter.Burst()]
+	}
+
+	n, err := reader.reader.Read(p)
+	if n > 0 {
+		if waitErr := limiter.WaitN(reader.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
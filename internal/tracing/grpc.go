@@ -0,0 +1,90 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+)
+
+// WithServerInterceptor gets a copy of the description of a gRPC service
+// whose unary methods run the tracing interceptor before the interceptors
+// of the server. The server is created by the plugin helper, which
+// doesn't accept additional interceptors
+func WithServerInterceptor(desc *grpc.ServiceDesc) *grpc.ServiceDesc {
+	tracingInterceptor := otelgrpc.UnaryServerInterceptor()
+
+	result := *desc
+	result.Methods = make([]grpc.MethodDesc, len(desc.Methods))
+	for i := range desc.Methods {
+		handler := desc.Methods[i].Handler
+		result.Methods[i] = grpc.MethodDesc{
+			MethodName: desc.Methods[i].MethodName,
+			Handler: func(
+				srv any,
+				ctx context.Context,
+				dec func(any) error,
+				interceptor grpc.UnaryServerInterceptor,
+			) (any, error) {
+				return handler(srv, ctx, dec, chainUnaryInterceptors(tracingInterceptor, interceptor))
+			},
+		}
+	}
+
+	return &result
+}
+
+// chainUnaryInterceptors creates an interceptor running first and then second
+func chainUnaryInterceptors(first, second grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	if second == nil {
+		return first
+	}
+
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		return first(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return second(ctx, req, info, handler)
+		})
+	}
+}
+
+// UnaryServerCall runs the handler of a unary method inside the span of
+// the gRPC call. It's used by the services registered by the plugin helper
+// itself, whose description can't be replaced by WithServerInterceptor
+func UnaryServerCall[Request, Response any](
+	ctx context.Context,
+	fullMethod string,
+	req Request,
+	handler func(context.Context, Request) (Response, error),
+) (Response, error) {
+	info := &grpc.UnaryServerInfo{FullMethod: fullMethod}
+	result, err := otelgrpc.UnaryServerInterceptor()(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+		return handler(ctx, req.(Request))
+	})
+	if err != nil {
+		var empty Response
+		return empty, err
+	}
+
+	return result.(Response), nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing/tracingtest"
+)
+
+const testFullMethod = "/test.Service/Call"
+
+// newTestServiceDesc creates the description of a service whose only
+// method is served like the ones generated by protoc, returning the
+// passed error
+func newTestServiceDesc(result error) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "test.Service",
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Call",
+				Handler: func(
+					srv any,
+					ctx context.Context,
+					_ func(any) error,
+					interceptor grpc.UnaryServerInterceptor,
+				) (any, error) {
+					handler := func(context.Context, any) (any, error) {
+						return nil, result
+					}
+					if interceptor == nil {
+						return handler(ctx, nil)
+					}
+					info := &grpc.UnaryServerInfo{Server: srv, FullMethod: testFullMethod}
+					return interceptor(ctx, nil, info, handler)
+				},
+			},
+		},
+	}
+}
+
+func TestWithServerInterceptor(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	serviceDesc := newTestServiceDesc(nil)
+	tracedDesc := WithServerInterceptor(serviceDesc)
+	if &tracedDesc.Methods[0] == &serviceDesc.Methods[0] {
+		t.Fatal("expected the methods of the service description to be copied")
+	}
+
+	// The interceptor of the server runs inside the span
+	// of the call, so it can start its own spans
+	serverInterceptorCalled := false
+	serverInterceptor := func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		serverInterceptorCalled = true
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			t.Error("expected the server interceptor to run inside the span of the call")
+		}
+		return handler(ctx, req)
+	}
+
+	if _, err := tracedDesc.Methods[0].Handler(nil, context.Background(), nil, serverInterceptor); err != nil {
+		t.Fatal(err)
+	}
+	if !serverInterceptorCalled {
+		t.Error("expected the server interceptor to be called")
+	}
+
+	span := tracingtest.FindSpan(t, recorder, "test.Service/Call")
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("unexpected span kind %v", span.SpanKind())
+	}
+	if value := tracingtest.GetAttribute(t, span, semconv.RPCServiceKey); value.AsString() != "test.Service" {
+		t.Errorf("unexpected rpc.service attribute %q", value.AsString())
+	}
+	if value := tracingtest.GetAttribute(t, span, semconv.RPCMethodKey); value.AsString() != "Call" {
+		t.Errorf("unexpected rpc.method attribute %q", value.AsString())
+	}
+	if span.Status().Code != codes.Unset {
+		t.Errorf("unexpected status %v", span.Status())
+	}
+}
+
+func TestWithServerInterceptorError(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	tracedDesc := WithServerInterceptor(newTestServiceDesc(status.Error(grpccodes.Internal, "backup failed")))
+	if _, err := tracedDesc.Methods[0].Handler(nil, context.Background(), nil, nil); err == nil {
+		t.Fatal("expected the error of the handler to be returned")
+	}
+
+	span := tracingtest.FindSpan(t, recorder, "test.Service/Call")
+	statusCode := tracingtest.GetAttribute(t, span, semconv.RPCGRPCStatusCodeKey)
+	if statusCode.AsInt64() != int64(grpccodes.Internal) {
+		t.Errorf("unexpected rpc.grpc.status_code attribute %d", statusCode.AsInt64())
+	}
+	if status := span.Status(); status.Code != codes.Error || status.Description != "backup failed" {
+		t.Errorf("unexpected status %v", status)
+	}
+}
+
+func TestUnaryServerCallError(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	response, err := UnaryServerCall(context.Background(), testFullMethod, "request",
+		func(context.Context, string) (*string, error) {
+			return nil, status.Error(grpccodes.Unavailable, "not ready")
+		})
+	if err == nil || response != nil {
+		t.Fatalf("expected the error of the handler to be returned, got %v, %v", response, err)
+	}
+
+	span := tracingtest.FindSpan(t, recorder, "test.Service/Call")
+	if status := span.Status(); status.Code != codes.Error || status.Description != "not ready" {
+		t.Errorf("unexpected status %v", status)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+// tracerName is the name of the instrumentation library
+const tracerName = "github.com/cloudnative-pg/plugin-pvc-backup"
+
+// Options are the options of the OTLP exporter
+type Options struct {
+	// Endpoint is the host and port of the OTLP collector. When empty,
+	// the standard OTEL_EXPORTER_OTLP_* environment variables are used
+	Endpoint string
+
+	// Insecure disables TLS when connecting to the collector
+	Insecure bool
+}
+
+// EnvironmentPrefix is the prefix of the standard
+// OpenTelemetry environment variables
+const EnvironmentPrefix = "OTEL_"
+
+// endpointEnvironment are the environment variables configuring the
+// collector endpoint, any of which enables the export of the traces
+var endpointEnvironment = []string{
+	"OTEL_EXPORTER_OTLP_ENDPOINT",
+	"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+}
+
+// IsConfiguredByEnvironment checks if a collector endpoint
+// is set in the standard environment variables
+func IsConfiguredByEnvironment() bool {
+	for _, name := range endpointEnvironment {
+		if len(os.Getenv(name)) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Setup starts exporting the traces to an OTLP collector, and
+// returns the function flushing and stopping the exporter
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	var exporterOptions []otlptracegrpc.Option
+	if len(options.Endpoint) > 0 {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithEndpoint(options.Endpoint))
+	}
+	if options.Insecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(metadata.Data.Name),
+			semconv.ServiceVersion(metadata.Data.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span, that is a no-op when tracing is not enabled
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends a span, recording the error that made the operation fail, if any
+func End(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,169 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing/tracingtest"
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+func TestStartEnd(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	ctx, parent := Start(context.Background(), "parent", attribute.String("cluster.name", "cluster-example"))
+	_, child := Start(ctx, "child")
+	End(child, nil)
+	End(parent, nil)
+
+	parentSpan := tracingtest.FindSpan(t, recorder, "parent")
+	childSpan := tracingtest.FindSpan(t, recorder, "child")
+	if value := tracingtest.GetAttribute(t, parentSpan, "cluster.name"); value.AsString() != "cluster-example" {
+		t.Errorf("unexpected cluster.name attribute %q", value.AsString())
+	}
+	if childSpan.Parent().SpanID() != parentSpan.SpanContext().SpanID() {
+		t.Error("expected the child span to be started inside the parent one")
+	}
+	if parentSpan.Status().Code != codes.Unset {
+		t.Errorf("unexpected status %v", parentSpan.Status())
+	}
+}
+
+func TestEndWithError(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	_, span := Start(context.Background(), "failed")
+	End(span, errors.New("disk full"))
+
+	failedSpan := tracingtest.FindSpan(t, recorder, "failed")
+	if status := failedSpan.Status(); status.Code != codes.Error || status.Description != "disk full" {
+		t.Errorf("unexpected status %v", status)
+	}
+	if events := failedSpan.Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("expected the error to be recorded, got %v", events)
+	}
+}
+
+func TestEndCanceled(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	_, span := Start(context.Background(), "canceled")
+	End(span, fmt.Errorf("while archiving: %w", context.Canceled))
+
+	canceledSpan := tracingtest.FindSpan(t, recorder, "canceled")
+	if status := canceledSpan.Status(); status.Code != codes.Unset {
+		t.Errorf("expected a canceled operation not to be an error, got %v", status)
+	}
+}
+
+// testCollector is an OTLP collector keeping the exported spans in memory
+type testCollector struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu    sync.Mutex
+	spans map[string]*tracepb.ResourceSpans
+}
+
+func (collector *testCollector) Export(
+	_ context.Context,
+	req *collectortrace.ExportTraceServiceRequest,
+) (*collectortrace.ExportTraceServiceResponse, error) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	for _, resourceSpans := range req.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				collector.spans[span.Name] = resourceSpans
+			}
+		}
+	}
+
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+// newTestCollector starts an OTLP collector, returning its endpoint
+func newTestCollector(t *testing.T) (*testCollector, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &testCollector{spans: make(map[string]*tracepb.ResourceSpans)}
+	server := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(server, collector)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	return collector, listener.Addr().String()
+}
+
+func TestSetup(t *testing.T) {
+	previousProvider := otel.GetTracerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+	})
+
+	collector, endpoint := newTestCollector(t)
+	shutdown, err := Setup(context.Background(), Options{Endpoint: endpoint, Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Start(context.Background(), "backup", attribute.String("cluster.name", "cluster-example"))
+	End(span, nil)
+
+	// Shutting down flushes the spans to the collector
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	resourceSpans, ok := collector.spans["backup"]
+	if !ok {
+		t.Fatalf("expected the span to be exported, got %v", collector.spans)
+	}
+
+	var serviceName string
+	for _, kv := range resourceSpans.Resource.Attributes {
+		if kv.Key == string(semconv.ServiceNameKey) {
+			serviceName = kv.Value.GetStringValue()
+		}
+	}
+	if serviceName != metadata.Data.Name {
+		t.Errorf("expected the service name %q, got %q", metadata.Data.Name, serviceName)
+	}
+}
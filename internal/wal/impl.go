@@ -20,11 +20,16 @@ import (
 	"context"
 
 	"github.com/cloudnative-pg/cnpg-i/pkg/wal"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/events"
 )
 
 // Implementation is the implementation of the identity service
 type Implementation struct {
 	wal.WALServer
+
+	// Events emits the Events reporting the archiving failures
+	Events *events.Recorder
 }
 
 // GetCapabilities gets the capabilities of the WAL service
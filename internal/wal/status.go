@@ -18,9 +18,6 @@ package wal
 
 import (
 	"context"
-	"fmt"
-	"io/fs"
-	"os"
 	"path"
 
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
@@ -28,16 +25,10 @@ import (
 	"github.com/cloudnative-pg/cnpg-i/pkg/wal"
 
 	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
 	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
 )
 
-type walStatMode string
-
-const (
-	walStatModeFirst = "first"
-	walStatModeLast  = "last"
-)
-
 // Status gets the statistics of the WAL file archive
 func (Implementation) Status(
 	ctx context.Context,
@@ -51,73 +42,37 @@ func (Implementation) Status(
 		return nil, err
 	}
 
-	walPath := storage.GetWALPath(helper.GetCluster().Name)
-	contextLogger = contextLogger.WithValues(
-		"walPath", walPath,
-		"clusterName", helper.GetCluster().Name,
-	)
-
-	walDirEntries, err := os.ReadDir(walPath)
-	if err != nil {
-		contextLogger.Error(err, "Error while reading WALs directory")
-		return nil, err
-	}
-
-	firstWal, err := getWALStat(helper.GetCluster().Name, walDirEntries, walStatModeFirst)
+	configuration, err := config.WALFromParameters(helper.Parameters)
 	if err != nil {
-		contextLogger.Error(err, "Error while reading WALs directory (getting first WAL)")
+		contextLogger.Error(err, "Error while parsing the plugin parameters")
 		return nil, err
 	}
 
-	lastWal, err := getWALStat(helper.GetCluster().Name, walDirEntries, walStatModeLast)
+	backend, err := storage.NewBackend(configuration.Storage)
 	if err != nil {
-		contextLogger.Error(err, "Error while reading WALs directory (getting first WAL)")
+		contextLogger.Error(err, "Error while creating the storage backend")
 		return nil, err
 	}
 
-	return &wal.WALStatusResult{
-		FirstWal: firstWal,
-		LastWal:  lastWal,
-	}, nil
-}
-
-func getWALStat(clusterName string, entries []fs.DirEntry, mode walStatMode) (string, error) {
-	entry, ok := getEntry(entries, mode)
-	if !ok {
-		return "", nil
-	}
-
-	if !entry.IsDir() {
-		return "", fmt.Errorf("%s is not a directory", entry)
-	}
+	walPrefix := storage.GetWALPrefixKey(helper.GetCluster().Name)
+	contextLogger = contextLogger.WithValues(
+		"walPrefix", walPrefix,
+		"clusterName", helper.GetCluster().Name,
+	)
 
-	entryAbsolutePath := path.Join(storage.GetWALPath(clusterName), entry.Name())
-	subFolderEntries, err := os.ReadDir(entryAbsolutePath)
+	walObjects, err := backend.List(ctx, walPrefix)
 	if err != nil {
-		return "", fmt.Errorf("while reading %s entries: %w", entry, err)
-	}
-
-	selectSubFolderEntry, ok := getEntry(subFolderEntries, mode)
-	if !ok {
-		return "", nil
+		contextLogger.Error(err, "Error while listing WALs")
+		return nil, err
 	}
 
-	return selectSubFolderEntry.Name(), nil
-}
-
-func getEntry(entries []fs.DirEntry, mode walStatMode) (fs.DirEntry, bool) {
-	if len(entries) == 0 {
-		return nil, false
+	// WAL objects are listed in lexicographical order, which
+	// is also the order in which they were generated
+	result := &wal.WALStatusResult{}
+	if len(walObjects) > 0 {
+		result.FirstWal = path.Base(walObjects[0].Key)
+		result.LastWal = path.Base(walObjects[len(walObjects)-1].Key)
 	}
 
-	switch mode {
-	case walStatModeFirst:
-		return entries[0], true
-
-	case walStatModeLast:
-		return entries[len(entries)-1], true
-
-	default:
-		return nil, false
-	}
+	return result, nil
 }
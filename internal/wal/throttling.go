@@ -0,0 +1,26 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wal
+
+import (
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/throttle"
+)
+
+// archiveBudget is shared by every WAL file being archived by this
+// sidecar. It is separate from the base backup limits, so archiving
+// is never blocked behind a running backup
+var archiveBudget throttle.Budget
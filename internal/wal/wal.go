@@ -18,19 +18,28 @@ package wal
 
 import (
 	"context"
+	"errors"
+	"os"
 	"path"
+	"time"
 
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/pluginhelper"
 	"github.com/cloudnative-pg/cnpg-i/pkg/wal"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/executor"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/migration"
 	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
 	"github.com/cloudnative-pg/plugin-pvc-backup/internal/fileutils"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/metrics"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing"
 	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
 )
 
 // Archive copies one WAL file into the archive
-func (Implementation) Archive(
+func (impl Implementation) Archive(
 	ctx context.Context,
 	request *wal.WALArchiveRequest,
 ) (*wal.WALArchiveResult, error) {
@@ -42,22 +51,111 @@ func (Implementation) Archive(
 		return nil, err
 	}
 
-	walName := path.Base(request.SourceFileName)
-	destinationPath := storage.GetWALFilePath(helper.GetCluster().Name, walName)
+	spanCtx, span := tracing.Start(ctx, "archive WAL file",
+		attribute.String("cluster.name", helper.GetCluster().Name),
+		attribute.String("wal.name", path.Base(request.SourceFileName)))
+	startedAt := time.Now()
+	walSize, err := archive(spanCtx, helper, request.SourceFileName)
+	span.SetAttributes(attribute.Int64("wal.size_bytes", walSize))
+	tracing.End(span, err)
+	metrics.ObserveWALArchive(helper.GetCluster().Name, time.Since(startedAt), walSize, err == nil)
+	if err != nil {
+		impl.Events.WALArchiveFailed(helper.GetCluster(), path.Base(request.SourceFileName), err)
+		return nil, err
+	}
+
+	return &wal.WALArchiveResult{}, nil
+}
+
+// archive copies one WAL file into the archive, returning its size
+func archive(ctx context.Context, helper *pluginhelper.Data, sourceFileName string) (int64, error) {
+	contextLogger := logging.FromContext(ctx)
+
+	configuration, err := config.WALFromParameters(helper.Parameters)
+	if err != nil {
+		contextLogger.Error(err, "Error while parsing the plugin parameters")
+		return 0, err
+	}
+
+	backend, err := storage.NewBackend(configuration.Storage)
+	if err != nil {
+		contextLogger.Error(err, "Error while creating the storage backend")
+		return 0, err
+	}
+
+	walName := path.Base(sourceFileName)
+	walKey := storage.GetWALKey(helper.GetCluster().Name, walName)
 
 	contextLogger = contextLogger.WithValues(
-		"sourceFileName", request.SourceFileName,
-		"destinationPath", destinationPath,
+		"sourceFileName", sourceFileName,
+		"walKey", walKey,
 		"clusterName", helper.GetCluster().Name,
 	)
 
+	archiveBudget.SetLimit(configuration.WALArchiveRate)
+
+	if configuration.Storage.Type == storage.BackendTypePVC {
+		if err := checkArchiveSpace(
+			ctx,
+			helper.GetCluster().Name,
+			configuration.SpaceThresholds,
+			sourceFileName,
+		); err != nil {
+			contextLogger.Error(err, "Cannot archive WAL file")
+			return 0, err
+		}
+	}
+
 	contextLogger.Info("Archiving WAL File")
-	err = fileutils.CopyFile(request.SourceFileName, destinationPath)
+	walSize, err := archiveWALFile(ctx, backend, sourceFileName, walKey)
 	if err != nil {
 		contextLogger.Error(err, "Error archiving WAL file")
+		return walSize, err
+	}
+
+	if configuration.Storage.Type == storage.BackendTypePVC && len(configuration.PreviousPVCName) > 0 {
+		if err := archivePreviousWALFile(
+			ctx,
+			helper.GetCluster().Name,
+			configuration.PreviousPVCName,
+			sourceFileName,
+			walKey,
+		); err != nil {
+			contextLogger.Error(err, "Error archiving WAL file in the previous PVC")
+			return walSize, err
+		}
+	}
+
+	return walSize, nil
+}
+
+// archivePreviousWALFile stores a WAL file in the previous PVC too, until
+// the migration from it has been completed. This way the previous PVC
+// keeps a complete WAL archive until its copy has been verified
+func archivePreviousWALFile(
+	ctx context.Context,
+	clusterName string,
+	previousPVCName string,
+	sourceFileName string,
+	walKey string,
+) error {
+	completed, err := migration.IsCompleted(clusterName, previousPVCName)
+	if err != nil || completed {
+		return err
 	}
 
-	return &wal.WALArchiveResult{}, err
+	previous, err := storage.NewPreviousBackend()
+	if errors.Is(err, storage.ErrNotFound) {
+		// The Pod predates the migration, which will
+		// start once it has been recreated
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = archiveWALFile(ctx, previous, sourceFileName, walKey)
+	return err
 }
 
 // Restore copies WAL file from the archive to the data directory
@@ -73,19 +171,117 @@ func (Implementation) Restore(
 		return nil, err
 	}
 
-	walFilePath := storage.GetWALFilePath(helper.GetCluster().Name, request.SourceWalName)
+	spanCtx, span := tracing.Start(ctx, "restore WAL file",
+		attribute.String("cluster.name", helper.GetCluster().Name),
+		attribute.String("wal.name", request.SourceWalName))
+	startedAt := time.Now()
+	err = restore(spanCtx, helper, request.SourceWalName, request.DestinationFileName)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Not finding a WAL file in the archive is expected
+		// at the end of a recovery
+		span.SetAttributes(attribute.Bool("wal.found", false))
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+	metrics.ObserveWALRestore(
+		helper.GetCluster().Name,
+		time.Since(startedAt),
+		err != nil && !errors.Is(err, storage.ErrNotFound))
+
+	return &wal.WALRestoreResult{}, err
+}
+
+// restore copies a WAL file from the archive to the passed destination
+func restore(ctx context.Context, helper *pluginhelper.Data, walName string, destinationFileName string) error {
+	contextLogger := logging.FromContext(ctx)
+
+	configuration, err := config.WALFromParameters(helper.Parameters)
+	if err != nil {
+		contextLogger.Error(err, "Error while parsing the plugin parameters")
+		return err
+	}
+
+	backend, err := storage.NewBackend(configuration.Storage)
+	if err != nil {
+		contextLogger.Error(err, "Error while creating the storage backend")
+		return err
+	}
+
+	walKey := storage.GetWALKey(helper.GetCluster().Name, walName)
 	contextLogger = contextLogger.WithValues(
 		"clusterName", helper.GetCluster().Name,
-		"walName", request.SourceWalName,
-		"walFilePath", walFilePath,
-		"destinationPath", request.DestinationFileName,
+		"walName", walName,
+		"walKey", walKey,
+		"destinationPath", destinationFileName,
 	)
 
 	contextLogger.Info("Restoring WAL File")
-	err = fileutils.CopyFile(walFilePath, request.DestinationFileName)
+	err = restoreWALFile(ctx, backend, walKey, destinationFileName)
+	if errors.Is(err, storage.ErrNotFound) && len(configuration.PreviousPVCName) > 0 &&
+		configuration.Storage.Type == storage.BackendTypePVC {
+		// The WAL file may have been archived before the migration
+		// from the previous PVC, and not copied yet
+		if previous, previousErr := storage.NewPreviousBackend(); previousErr == nil {
+			contextLogger.Info("Restoring WAL File from the previous PVC")
+			err = restoreWALFile(ctx, previous, walKey, destinationFileName)
+		}
+	}
 	if err != nil {
 		contextLogger.Info("Restored WAL File", "err", err)
 	}
 
-	return &wal.WALRestoreResult{}, err
+	return err
+}
+
+// archiveWALFile stores a WAL file into the backend, returning its size
+func archiveWALFile(
+	ctx context.Context,
+	backend storage.Backend,
+	sourceFileName string,
+	walKey string,
+) (int64, error) {
+	walFile, err := os.Open(sourceFileName) // nolint:gosec
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = walFile.Close()
+	}()
+
+	walFileInfo, err := walFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return walFileInfo.Size(), backend.Put(
+		ctx, walKey, archiveBudget.NewReader(ctx, walFile), walFileInfo.Size())
+}
+
+// checkArchiveSpace checks that a WAL file fits in the backup volume
+func checkArchiveSpace(
+	ctx context.Context,
+	clusterName string,
+	thresholds executor.SpaceThresholds,
+	sourceFileName string,
+) error {
+	walFileInfo, err := os.Stat(sourceFileName)
+	if err != nil {
+		return err
+	}
+
+	return executor.CheckArchiveSpace(ctx, clusterName, thresholds, walFileInfo.Size())
+}
+
+// restoreWALFile retrieves a WAL file from the backend
+func restoreWALFile(ctx context.Context, backend storage.Backend, walKey string, destinationFileName string) error {
+	content, err := backend.Get(ctx, walKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	return fileutils.WriteFileAtomic(destinationFileName, content)
 }
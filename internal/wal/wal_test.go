@@ -0,0 +1,209 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i/pkg/wal"
+	"go.opentelemetry.io/otel/codes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/backup/storage"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/config"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing/tracingtest"
+	"github.com/cloudnative-pg/plugin-pvc-backup/pkg/metadata"
+)
+
+const testWALName = "000000010000000000000001"
+
+// objectStore is an in-memory stand-in for an object store,
+// storing the objects by their path
+type objectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (store *objectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		store.objects[r.URL.Path] = content
+
+	case http.MethodGet:
+		content, ok := store.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newTestClusterDefinition creates the definition of a cluster
+// archiving its WAL files in an in-memory object store
+func newTestClusterDefinition(t *testing.T) []byte {
+	t.Helper()
+
+	server := httptest.NewServer(&objectStore{objects: make(map[string][]byte)})
+	t.Cleanup(server.Close)
+	t.Setenv(storage.AccessKeyIDEnvironment, "access-key")
+	t.Setenv(storage.SecretAccessKeyEnvironment, "secret-key")
+
+	cluster := apiv1.Cluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: apiv1.GroupVersion.String(), Kind: apiv1.ClusterKind},
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-example", Namespace: "default"},
+		Spec: apiv1.ClusterSpec{
+			Instances: 1,
+			Plugins: apiv1.PluginConfigurationList{
+				{
+					Name: metadata.Data.Name,
+					Parameters: map[string]string{
+						config.ImageParameter:               "plugin-pvc-backup:latest",
+						config.SecretNameParameter:          "kopia",
+						config.SecretKeyParameter:           "password",
+						config.PVCParameter:                 "cluster-backups",
+						config.StorageBackendParameter:      string(storage.BackendTypeS3),
+						config.S3BucketParameter:            "backups",
+						config.S3EndpointParameter:          server.URL,
+						config.S3CredentialsSecretParameter: "s3-credentials",
+					},
+				},
+			},
+		},
+	}
+
+	result, err := json.Marshal(&cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestArchiveRestoreSpans(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+	clusterDefinition := newTestClusterDefinition(t)
+
+	sourceFileName := filepath.Join(t.TempDir(), testWALName)
+	if err := os.WriteFile(sourceFileName, []byte("wal content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	impl := Implementation{}
+	if _, err := impl.Archive(context.Background(), &wal.WALArchiveRequest{
+		ClusterDefinition: clusterDefinition,
+		SourceFileName:    sourceFileName,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	destinationFileName := filepath.Join(t.TempDir(), "RECOVERYXLOG")
+	if _, err := impl.Restore(context.Background(), &wal.WALRestoreRequest{
+		ClusterDefinition:   clusterDefinition,
+		SourceWalName:       testWALName,
+		DestinationFileName: destinationFileName,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(destinationFileName); err != nil || string(content) != "wal content" {
+		t.Fatalf("unexpected restored WAL file %q: %v", content, err)
+	}
+
+	archiveSpan := tracingtest.FindSpan(t, recorder, "archive WAL file")
+	if value := tracingtest.GetAttribute(t, archiveSpan, "cluster.name"); value.AsString() != "cluster-example" {
+		t.Errorf("unexpected cluster.name attribute %q", value.AsString())
+	}
+	if value := tracingtest.GetAttribute(t, archiveSpan, "wal.name"); value.AsString() != testWALName {
+		t.Errorf("unexpected wal.name attribute %q", value.AsString())
+	}
+	if value := tracingtest.GetAttribute(t, archiveSpan, "wal.size_bytes"); value.AsInt64() != int64(len("wal content")) {
+		t.Errorf("unexpected wal.size_bytes attribute %d", value.AsInt64())
+	}
+	if archiveSpan.Status().Code != codes.Unset {
+		t.Errorf("unexpected status %v", archiveSpan.Status())
+	}
+
+	restoreSpan := tracingtest.FindSpan(t, recorder, "restore WAL file")
+	if value := tracingtest.GetAttribute(t, restoreSpan, "wal.name"); value.AsString() != testWALName {
+		t.Errorf("unexpected wal.name attribute %q", value.AsString())
+	}
+	if restoreSpan.Status().Code != codes.Unset {
+		t.Errorf("unexpected status %v", restoreSpan.Status())
+	}
+}
+
+func TestArchiveFailureSpan(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	impl := Implementation{}
+	_, err := impl.Archive(context.Background(), &wal.WALArchiveRequest{
+		ClusterDefinition: newTestClusterDefinition(t),
+		SourceFileName:    filepath.Join(t.TempDir(), testWALName),
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected archiving a missing WAL file to fail, got %v", err)
+	}
+
+	span := tracingtest.FindSpan(t, recorder, "archive WAL file")
+	if status := span.Status(); status.Code != codes.Error || status.Description != err.Error() {
+		t.Errorf("unexpected status %v", status)
+	}
+}
+
+func TestRestoreMissingWALSpan(t *testing.T) {
+	recorder := tracingtest.NewSpanRecorder(t)
+
+	impl := Implementation{}
+	if _, err := impl.Restore(context.Background(), &wal.WALRestoreRequest{
+		ClusterDefinition:   newTestClusterDefinition(t),
+		SourceWalName:       testWALName,
+		DestinationFileName: filepath.Join(t.TempDir(), "RECOVERYXLOG"),
+	}); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected restoring a missing WAL file to fail, got %v", err)
+	}
+
+	// Not finding a WAL file is expected at the end of a
+	// recovery, and is not reported as an error
+	span := tracingtest.FindSpan(t, recorder, "restore WAL file")
+	if value := tracingtest.GetAttribute(t, span, "wal.found"); value.AsBool() {
+		t.Error("expected the wal.found attribute to be false")
+	}
+	if span.Status().Code != codes.Unset {
+		t.Errorf("unexpected status %v", span.Status())
+	}
+}
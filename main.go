@@ -18,30 +18,169 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 
+	apiv1 "github.com/cloudnative-pg/cloudnative-pg/api/v1"
+	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/logging"
 	"github.com/cloudnative-pg/cnpg-i-machinery/pkg/pluginhelper"
 	"github.com/cloudnative-pg/cnpg-i/pkg/backup"
 	"github.com/cloudnative-pg/cnpg-i/pkg/operator"
 	"github.com/cloudnative-pg/cnpg-i/pkg/wal"
+	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	backupImpl "github.com/cloudnative-pg/plugin-pvc-backup/internal/backup"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/cli"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/events"
 	"github.com/cloudnative-pg/plugin-pvc-backup/internal/identity"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/metrics"
 	operatorImpl "github.com/cloudnative-pg/plugin-pvc-backup/internal/operator"
+	"github.com/cloudnative-pg/plugin-pvc-backup/internal/tracing"
 	walImpl "github.com/cloudnative-pg/plugin-pvc-backup/internal/wal"
 )
 
 func main() {
-	cmd := pluginhelper.CreateMainCmd(identity.Implementation{}, func(server *grpc.Server) {
-		operator.RegisterOperatorServer(server, operatorImpl.Implementation{})
-		wal.RegisterWALServer(server, walImpl.Implementation{})
-		backup.RegisterBackupServer(server, backupImpl.Implementation{})
+	cmd := pluginhelper.CreateMainCmd(identity.Implementation{}.Traced(), func(server *grpc.Server) {
+		kubernetesClient, eventRecorder := newKubernetesClients()
+		recorder := events.NewRecorder(eventRecorder)
+
+		server.RegisterService(tracing.WithServerInterceptor(&operator.Operator_ServiceDesc), operatorImpl.Implementation{
+			Client: kubernetesClient,
+		})
+		server.RegisterService(tracing.WithServerInterceptor(&wal.WAL_ServiceDesc), walImpl.Implementation{
+			Events: recorder,
+		})
+		server.RegisterService(tracing.WithServerInterceptor(&backup.Backup_ServiceDesc), backupImpl.Implementation{
+			Client: kubernetesClient,
+			Events: recorder,
+		})
 	})
+	addMetricsServer(cmd)
+	addTracing(cmd)
+	cmd.AddCommand(
+		cli.NewBackupCmd(),
+		cli.NewWALCmd(),
+		cli.NewRepoCmd(),
+	)
+
 	err := cmd.Execute()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
+
+// addMetricsServer makes the command publish the plugin
+// metrics while the plugin is running
+func addMetricsServer(cmd *cobra.Command) {
+	cmd.Flags().String(
+		"metrics-bind-address",
+		":"+strconv.Itoa(metrics.DefaultPort),
+		"The address where the metrics are published, empty to disable them",
+	)
+
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		address, err := cmd.Flags().GetString("metrics-bind-address")
+		if err != nil {
+			return err
+		}
+
+		if len(address) > 0 {
+			go func() {
+				if err := metrics.Serve(cmd.Context(), address); err != nil {
+					logging.FromContext(cmd.Context()).Error(err, "While running the metrics server")
+				}
+			}()
+		}
+
+		return run(cmd, args)
+	}
+}
+
+// addTracing makes the command export traces to an OTLP collector,
+// when an endpoint is configured either with the flags or with the
+// standard OpenTelemetry environment variables
+func addTracing(cmd *cobra.Command) {
+	cmd.Flags().String(
+		"otlp-endpoint",
+		"",
+		"The host and port of the OTLP collector receiving the traces",
+	)
+	cmd.Flags().Bool(
+		"otlp-insecure",
+		false,
+		"Disable TLS when connecting to the OTLP collector",
+	)
+
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		endpoint, err := cmd.Flags().GetString("otlp-endpoint")
+		if err != nil {
+			return err
+		}
+		insecure, err := cmd.Flags().GetBool("otlp-insecure")
+		if err != nil {
+			return err
+		}
+
+		if len(endpoint) == 0 && !tracing.IsConfiguredByEnvironment() {
+			return run(cmd, args)
+		}
+
+		shutdown, err := tracing.Setup(cmd.Context(), tracing.Options{
+			Endpoint: endpoint,
+			Insecure: insecure,
+		})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := shutdown(context.WithoutCancel(cmd.Context())); err != nil {
+				logging.FromContext(cmd.Context()).Error(err, "While flushing the traces")
+			}
+		}()
+
+		return run(cmd, args)
+	}
+}
+
+// newKubernetesClients creates the client used to validate the objects
+// referenced by the plugin parameters and to annotate the Backup objects,
+// and the recorder of the Events reporting the plugin activity. When the
+// plugin can't reach the Kubernetes API both are nil, and the validations,
+// the annotations and the Events are skipped
+func newKubernetesClients() (client.Client, record.EventRecorder) {
+	restConfig, err := ctrlconfig.GetConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Kubernetes API not available, skipping resource validation and events:", err)
+		return nil, nil
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiv1.AddToScheme(scheme))
+
+	kubernetesClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot create Kubernetes client, skipping resource validation:", err)
+		kubernetesClient = nil
+	}
+
+	eventRecorder, err := events.NewEventRecorder(restConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot create the event recorder, skipping events:", err)
+		eventRecorder = nil
+	}
+
+	return kubernetesClient, eventRecorder
+}